@@ -0,0 +1,140 @@
+package drifterdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/LaJunkai/drifterdb/common"
+	"sort"
+)
+
+type batchOp struct {
+	kt    uint8
+	key   []byte
+	value []byte
+}
+
+// writeBatch buffers the writes of an optimistic transaction, only the latest write of each key is kept.
+type writeBatch struct {
+	ops   []*batchOp
+	index map[string]int
+}
+
+func newWriteBatch() *writeBatch {
+	return &writeBatch{
+		ops:   make([]*batchOp, 0, 8),
+		index: make(map[string]int),
+	}
+}
+
+// set copies the key and the value since the caller may reuse the buffers before the batch is committed.
+func (b *writeBatch) set(kt uint8, key, value []byte) {
+	op := &batchOp{kt: kt, key: common.CopyBytes(key), value: common.CopyBytes(value)}
+	if i, ok := b.index[string(key)]; ok {
+		b.ops[i] = op
+		return
+	}
+	b.index[string(key)] = len(b.ops)
+	b.ops = append(b.ops, op)
+}
+
+func (b *writeBatch) Put(key, value []byte) {
+	b.set(common.OpPut, key, value)
+}
+
+func (b *writeBatch) Delete(key []byte) {
+	b.set(common.OpDelete, key, []byte(""))
+}
+
+// Get returns the latest write of the key, nil is returned if the key is not written by the batch.
+func (b *writeBatch) Get(key []byte) *batchOp {
+	if i, ok := b.index[string(key)]; ok {
+		return b.ops[i]
+	}
+	return nil
+}
+
+// Range returns the writes in the [start, end) range in the order of the keys.
+func (b *writeBatch) Range(start, end []byte) []*batchOp {
+	result := make([]*batchOp, 0)
+	for _, op := range b.ops {
+		if bytes.Compare(start, op.key) <= 0 && bytes.Compare(op.key, end) < 0 {
+			result = append(result, op)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].key, result[j].key) < 0
+	})
+	return result
+}
+
+func (b *writeBatch) Keys() [][]byte {
+	keys := make([][]byte, 0, len(b.ops))
+	for _, op := range b.ops {
+		keys = append(keys, op.key)
+	}
+	return keys
+}
+
+// Size returns the bytes of the keys and the values of the batch.
+func (b *writeBatch) Size() int {
+	size := 0
+	for _, op := range b.ops {
+		size += len(op.key) + len(op.value)
+	}
+	return size
+}
+
+func (b *writeBatch) Clone() *writeBatch {
+	clone := &writeBatch{
+		ops:   make([]*batchOp, len(b.ops)),
+		index: make(map[string]int, len(b.index)),
+	}
+	copy(clone.ops, b.ops)
+	for key, i := range b.index {
+		clone.index[key] = i
+	}
+	return clone
+}
+
+func (b *writeBatch) Len() int {
+	return len(b.ops)
+}
+
+// Encode dumps the batch as the value of the OpBatch WAL record:
+// count | [ kt | key length | key | value length | value ] ...
+func (b *writeBatch) Encode() []byte {
+	size := binary.MaxVarintLen64
+	for _, op := range b.ops {
+		size += 1 + 2*binary.MaxVarintLen64 + len(op.key) + len(op.value)
+	}
+	buf := make([]byte, size)
+	i := binary.PutUvarint(buf, uint64(len(b.ops)))
+	for _, op := range b.ops {
+		buf[i] = op.kt
+		i += 1
+		i += binary.PutUvarint(buf[i:], uint64(len(op.key)))
+		i += copy(buf[i:], op.key)
+		i += binary.PutUvarint(buf[i:], uint64(len(op.value)))
+		i += copy(buf[i:], op.value)
+	}
+	return buf[:i]
+}
+
+func decodeWriteBatch(src []byte) *writeBatch {
+	b := newWriteBatch()
+	count, i := binary.Uvarint(src)
+	for ; count > 0; count-- {
+		kt := src[i]
+		i += 1
+		keyLength, n := binary.Uvarint(src[i:])
+		i += n
+		key := src[i : i+int(keyLength)]
+		i += int(keyLength)
+		valueLength, n := binary.Uvarint(src[i:])
+		i += n
+		value := src[i : i+int(valueLength)]
+		i += int(valueLength)
+		b.set(kt, key, value)
+	}
+	return b
+}
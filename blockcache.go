@@ -0,0 +1,103 @@
+package drifterdb
+
+import (
+	"container/list"
+	"sync"
+)
+
+/*
+BlockCache is a LRU cache shared by the tables of the db.
+Values are parsed block objects (index partitions, filters...) so that a cache hit costs no decoding,
+and each value is charged by the byte size of the block it is parsed from.
+*/
+type BlockCache struct {
+	capacity int
+	usage    int
+	lru      *list.List
+	entries  map[blockCacheKey]*list.Element
+	lock     sync.Mutex
+	hits     uint64
+	misses   uint64
+}
+
+type blockCacheKey struct {
+	path   string
+	offset uint64
+}
+
+type blockCacheEntry struct {
+	key    blockCacheKey
+	value  interface{}
+	charge int
+}
+
+func NewBlockCache(capacity int) *BlockCache {
+	return &BlockCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[blockCacheKey]*list.Element),
+	}
+}
+
+func (c *BlockCache) Get(path string, offset uint64) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, existed := c.entries[blockCacheKey{path: path, offset: offset}]; existed {
+		c.lru.MoveToFront(e)
+		c.hits += 1
+		return e.Value.(*blockCacheEntry).value, true
+	}
+	c.misses += 1
+	return nil, false
+}
+
+// Put insert the value into the cache and evict the least recently used values until the usage fits the capacity.
+func (c *BlockCache) Put(path string, offset uint64, value interface{}, charge int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := blockCacheKey{path: path, offset: offset}
+	if e, existed := c.entries[key]; existed {
+		entry := e.Value.(*blockCacheEntry)
+		c.usage += charge - entry.charge
+		entry.value, entry.charge = value, charge
+		c.lru.MoveToFront(e)
+	} else {
+		c.entries[key] = c.lru.PushFront(&blockCacheEntry{key: key, value: value, charge: charge})
+		c.usage += charge
+	}
+	for c.usage > c.capacity && c.lru.Len() > 1 {
+		oldest := c.lru.Back()
+		entry := oldest.Value.(*blockCacheEntry)
+		c.lru.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.usage -= entry.charge
+	}
+}
+
+// Erase remove all the cached values of the table, it is supposed to be called when the table file is removed.
+func (c *BlockCache) Erase(path string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, e := range c.entries {
+		if key.path == path {
+			c.lru.Remove(e)
+			delete(c.entries, key)
+			c.usage -= e.Value.(*blockCacheEntry).charge
+		}
+	}
+}
+
+func (c *BlockCache) Usage() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.usage
+}
+
+func (c *BlockCache) HitRatio() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.hits+c.misses == 0 {
+		return 0
+	}
+	return float64(c.hits) / float64(c.hits+c.misses)
+}
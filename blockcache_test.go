@@ -0,0 +1,26 @@
+package drifterdb
+
+import (
+	"testing"
+)
+
+func TestBlockCache_Put(t *testing.T) {
+	cache := NewBlockCache(100)
+	cache.Put("a.sst", 0, "block-0", 40)
+	cache.Put("a.sst", 40, "block-1", 40)
+	if _, found := cache.Get("a.sst", 0); !found {
+		t.Errorf("block-0 is supposed to be cached")
+	}
+	// block-1 is the least recently used one now
+	cache.Put("b.sst", 0, "block-2", 40)
+	if _, found := cache.Get("a.sst", 40); found {
+		t.Errorf("block-1 is supposed to be evicted")
+	}
+	if v, found := cache.Get("a.sst", 0); !found || v.(string) != "block-0" {
+		t.Errorf("block-0 is supposed to be cached")
+	}
+	cache.Erase("a.sst")
+	if cache.Usage() != 40 {
+		t.Errorf("wrong usage after erasing: %v", cache.Usage())
+	}
+}
@@ -0,0 +1,113 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+/*
+BlockedBloomFilter splits the bits into the blocks of 64 bytes (a cache line), all the k probes of a key fall in the
+block chosen by the key so that a lookup touches one cache line instead of k. The probes are collected into a mask of
+the 8 words of the block which is compared word by word, no SIMD instruction is needed. The keys are not spread as
+evenly as the standard filter, so the blocked filter takes a little more false positives with the same bits per key.
+
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+| tag  |  k   |family|                        counter                        |            nblocks...
+| 16   | 17   | 18   | 19   |
+| ---- | ---- | ---- | ---- |
+       nblocks      |  data......
+*/
+
+const (
+	blockedHeaderLength = 19
+	blockWords          = 8
+	blockBits           = blockWords * 64
+)
+
+type BlockedBloomFilter struct {
+	// blocks holds nblocks * 8 words, the block i takes the words [8i, 8i + 8)
+	// the large slices are page aligned by the allocator, so the blocks of the table filters match the cache lines
+	blocks     []uint64
+	counter    uint64
+	nblocks    uint64
+	k          int
+	hashFamily byte
+}
+
+// NewBlockedFilterWithBitsPerKey creates a blocked filter sized for n keys with bitsPerKey bits per key and the optimal k.
+func NewBlockedFilterWithBitsPerKey(n int, bitsPerKey int) *BlockedBloomFilter {
+	nblocks := (uint64(n*bitsPerKey) + blockBits - 1) / blockBits
+	if nblocks < 1 {
+		nblocks = 1
+	}
+	return &BlockedBloomFilter{
+		blocks:     make([]uint64, nblocks*blockWords),
+		nblocks:    nblocks,
+		k:          OptimalK(bitsPerKey, HashFamilyXXHash64),
+		hashFamily: HashFamilyXXHash64,
+	}
+}
+
+// probe returns the block of the key and the mask of its probes in the block.
+func (f *BlockedBloomFilter) probe(key interface{}) ([]uint64, [blockWords]uint64) {
+	h := XXHash64(keyToBytes(key), 0)
+	// the high bits of h * nblocks map h to [0, nblocks) without the division
+	block, _ := bits.Mul64(h, f.nblocks)
+	var mask [blockWords]uint64
+	g := fmix64(h)
+	for i := 0; i < f.k; i += 1 {
+		// the top 9 bits choose one of the 512 bits of the block, the multiplication brings new bits to the top
+		position := g >> (64 - 9)
+		mask[position>>6] |= 1 << (position & 0x3f)
+		g *= 0x9e3779b97f4a7c13
+	}
+	return f.blocks[block*blockWords : block*blockWords+blockWords], mask
+}
+
+func (f *BlockedBloomFilter) Add(key interface{}) {
+	block, mask := f.probe(key)
+	for i := range mask {
+		block[i] |= mask[i]
+	}
+	f.counter++
+}
+
+func (f *BlockedBloomFilter) Exists(key interface{}) bool {
+	block, mask := f.probe(key)
+	var missed uint64 = 0
+	for i := range mask {
+		missed |= mask[i] &^ block[i]
+	}
+	return missed == 0
+}
+
+func (f *BlockedBloomFilter) Count() uint64 {
+	return f.counter
+}
+
+func (f *BlockedBloomFilter) DumpBytes() []byte {
+	fullBytes := make([]byte, len(f.blocks)*8+blockedHeaderLength)
+	fullBytes[0] = FormatBlocked
+	fullBytes[1] = byte(f.k)
+	fullBytes[2] = f.hashFamily
+	binary.LittleEndian.PutUint64(fullBytes[3:11], f.counter)
+	binary.LittleEndian.PutUint64(fullBytes[11:19], f.nblocks)
+	dumpBits(fullBytes[blockedHeaderLength:], f.blocks)
+	return fullBytes
+}
+
+func LoadBlockedFilterFromBytes(src []byte) *BlockedBloomFilter {
+	f := &BlockedBloomFilter{
+		k:          int(src[1]),
+		hashFamily: src[2],
+		counter:    binary.LittleEndian.Uint64(src[3:11]),
+		nblocks:    binary.LittleEndian.Uint64(src[11:19]),
+		blocks:     loadBits(src[blockedHeaderLength:]),
+	}
+	if f.hashFamily != HashFamilyXXHash64 {
+		panic(fmt.Sprintf("unsupported hash family [%#x] of the blocked filter", f.hashFamily))
+	}
+	return f
+}
@@ -0,0 +1,70 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBlockedBloomFilter(t *testing.T) {
+	for _, total := range []int{0, 1, 7, 1000, 100000} {
+		filter := NewBlockedFilterWithBitsPerKey(total, 10)
+		for i := 0; i < total; i++ {
+			filter.Add(fmt.Sprintf("key-%v", i))
+		}
+		loaded := Load(filter.DumpBytes())
+		if loaded.Count() != uint64(total) {
+			t.Errorf("wrong count %v of %v keys", loaded.Count(), total)
+		}
+		for i := 0; i < total; i++ {
+			if !loaded.Exists(fmt.Sprintf("key-%v", i)) {
+				t.Fatalf("key-%v is supposed to be existed", i)
+			}
+		}
+		if total < 1000 {
+			continue
+		}
+		wrong := 0
+		for i := total; i < total*11; i++ {
+			if loaded.Exists(fmt.Sprintf("key-%v", i)) {
+				wrong += 1
+			}
+		}
+		if rate := float64(wrong) / float64(total*10); rate > 0.02 {
+			t.Errorf("false positive rate %v of %v keys is too high", rate, total)
+		}
+	}
+}
+
+const benchmarkFilterKeys = 1 << 20
+
+func benchmarkKeys() [][]byte {
+	keys := make([][]byte, benchmarkFilterKeys)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%v", i))
+	}
+	return keys
+}
+
+func BenchmarkBloomFilter_Exists(b *testing.B) {
+	keys := benchmarkKeys()
+	filter := NewFilterWithBitsPerKey(len(keys), 10)
+	for _, key := range keys {
+		filter.Add(key)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.Exists(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkBlockedBloomFilter_Exists(b *testing.B) {
+	keys := benchmarkKeys()
+	filter := NewBlockedFilterWithBitsPerKey(len(keys), 10)
+	for _, key := range keys {
+		filter.Add(key)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.Exists(keys[i%len(keys)])
+	}
+}
@@ -8,117 +8,266 @@ import (
 	"github.com/steakknife/hamming"
 	"log"
 	"math"
-	"reflect"
 )
 /*
+legacy format (the size of the filter must be power of 2)
 | 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
 | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
 |  k   |                        counter                        |                      data                      |
 
+tagged format (the first byte of the legacy format is always less than 0x80)
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+| tag  |  k   |                        counter                        |                    nbits...
+| 16   | 17   | 18   |
+| ---- | ---- | ---- |
+   nbits    |  data......
+
+tagged format v3 (the hash family is recorded)
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+| tag  |  k   |family|                        counter                        |             nbits...
+| 16   | 17   | 18   | 19   |
+| ---- | ---- | ---- | ---- |
+       nbits        |  data......
 */
-type Filter struct {
+
+const (
+	FormatTagMask     byte = 0x80
+	FormatBloomV2     byte = 0x81
+	FormatBinaryFuse8 byte = 0x82
+	FormatRibbon      byte = 0x83
+	FormatCounting    byte = 0x84
+	FormatScalable    byte = 0x85
+	FormatBloomV3     byte = 0x86
+	FormatBlocked     byte = 0x87
+
+	legacyHeaderLength  = 9
+	bloomV2HeaderLength = 18
+	bloomV3HeaderLength = 19
+)
+
+type BloomFilter struct {
 	// k is the number of the hash functions
-	// 2 ** m is the max number of the elements
+	// nbits is the number of the bits, it is 2 ** m for the filters created by NewFrozenFilter
 	// counter is the current number of the elements
-	bits     []uint64
-	counter  uint64
-	m        int
-	mask     uint64
-	k        int
-	hashPool *HashFunctionsPool
-}
-
-func (f *Filter) hashes(key interface{}) []uint64 {
-	var keyBytes []byte
-
-	switch key.(type) {
-	case string:
-		keyBytes = []byte(key.(string))
-	case []byte:
-		keyBytes = key.([]byte)
-	default:
-		panic(fmt.Sprintf("Invalid type [%v] of the key\n", reflect.TypeOf(key)))
-	}
+	// hashFamily is always HashFamilyClassic for the filters of the legacy format and the format v2
+	bits       []uint64
+	counter    uint64
+	nbits      uint64
+	k          int
+	format     byte
+	hashFamily byte
+	hashPool   *HashFunctionsPool
+}
 
-	hashValues := make([]uint64, f.k)
-	for i := 0; i < f.k; i += 1 {
-		hashValues[i] = f.hashPool.GetHashFunctionByIndex(i)(keyBytes)
-	}
-	return hashValues
+func (f *BloomFilter) hashes(key interface{}) []uint64 {
+	return hashValues(f.hashFamily, f.hashPool, keyToBytes(key), f.k)
 }
 
-func (f *Filter) Add(key interface{}) {
+func (f *BloomFilter) Add(key interface{}) {
 	for _, i := range f.hashes(key) {
-		i &= f.mask
+		i %= f.nbits
 		f.bits[i>>6] |= 1 << (i & uint64(0x3f))
 	}
 	f.counter++
 }
 
-func (f *Filter) Exists(key interface{}) bool {
+func (f *BloomFilter) Exists(key interface{}) bool {
 	found := true
 	for _, i := range f.hashes(key) {
-		i &= f.mask
+		i %= f.nbits
 		found = found && (f.bits[i>>6]&(1<<(i&0x3f))) != 0
 	}
 	return found
 }
 
-func (f *Filter) PreciseFilledRatio() float64 {
-	return float64(hamming.CountBitsUint64s(f.bits)) / float64(f.m)
-
+func (f *BloomFilter) PreciseFilledRatio() float64 {
+	return float64(hamming.CountBitsUint64s(f.bits)) / float64(f.nbits)
 }
 
-func (f *Filter) Count() uint64 {
+func (f *BloomFilter) Count() uint64 {
 	return f.counter
 }
 
-func (f *Filter) DumpBytes() []byte {
-	fullBytes := make([]byte, len(f.bits) * 8 + 9)
-	binary.PutUvarint(fullBytes[:1], uint64(f.k))
-	binary.LittleEndian.PutUint64(fullBytes[1:9], f.counter)
-	buffer := fullBytes[9:]
-	for i, value := range f.bits {
-		binary.BigEndian.PutUint64(buffer[i*8: i*8+8], value)
+// Legacy reports whether the filter is dumped with the legacy format.
+func (f *BloomFilter) Legacy() bool {
+	return f.format&FormatTagMask == 0
+}
+
+func (f *BloomFilter) DumpBytes() []byte {
+	if f.Legacy() {
+		fullBytes := make([]byte, len(f.bits) * 8 + legacyHeaderLength)
+		binary.PutUvarint(fullBytes[:1], uint64(f.k))
+		binary.LittleEndian.PutUint64(fullBytes[1:9], f.counter)
+		dumpBits(fullBytes[legacyHeaderLength:], f.bits)
+		return fullBytes
 	}
+	if f.format == FormatBloomV3 {
+		fullBytes := make([]byte, len(f.bits)*8+bloomV3HeaderLength)
+		fullBytes[0] = f.format
+		fullBytes[1] = byte(f.k)
+		fullBytes[2] = f.hashFamily
+		binary.LittleEndian.PutUint64(fullBytes[3:11], f.counter)
+		binary.LittleEndian.PutUint64(fullBytes[11:19], f.nbits)
+		dumpBits(fullBytes[bloomV3HeaderLength:], f.bits)
+		return fullBytes
+	}
+	fullBytes := make([]byte, len(f.bits)*8+bloomV2HeaderLength)
+	fullBytes[0] = f.format
+	fullBytes[1] = byte(f.k)
+	binary.LittleEndian.PutUint64(fullBytes[2:10], f.counter)
+	binary.LittleEndian.PutUint64(fullBytes[10:18], f.nbits)
+	dumpBits(fullBytes[bloomV2HeaderLength:], f.bits)
 	return fullBytes
 }
 
-func LoadFilterFromBytes(src []byte) *Filter {
-	uintArrayLength := (len(src) - 9) / 8
-	m := int(math.Log2(float64(uintArrayLength)))
-	pool := NewHashFunctionsPool()
-	bitsArray := make([]uint64, uintArrayLength)
-	dataPart := src[9:]
-	for i := 0; i < uintArrayLength; i++ {
-		bitsArray[i] = binary.BigEndian.Uint64(dataPart[i*8: i*8+8])
-	}
-	k, err := binary.ReadUvarint(bytes.NewReader(src[:1]))
-	counter := binary.LittleEndian.Uint64(src[1:9])
-	common.Throw(err)
-	return &Filter{
-		m:        m,
-		mask:     0xFFFFFFFFFFFFFFFF >> (64 - m),
-		counter:  counter,
-		bits:     bitsArray,
-		k:        int(k),
-		hashPool: pool,
+func dumpBits(buffer []byte, bits []uint64) {
+	for i, value := range bits {
+		binary.BigEndian.PutUint64(buffer[i*8: i*8+8], value)
+	}
+}
+
+func loadBits(buffer []byte) []uint64 {
+	bits := make([]uint64, len(buffer)/8)
+	for i := range bits {
+		bits[i] = binary.BigEndian.Uint64(buffer[i*8 : i*8+8])
+	}
+	return bits
+}
 
+// IsLegacyFormat reports whether the bytes are dumped by a filter of the legacy format.
+func IsLegacyFormat(src []byte) bool {
+	return len(src) > 0 && src[0]&FormatTagMask == 0
+}
+
+// LoadFilterFromBytes load the filter of both the legacy format and the tagged format.
+func LoadFilterFromBytes(src []byte) *BloomFilter {
+	if IsLegacyFormat(src) {
+		k, err := binary.ReadUvarint(bytes.NewReader(src[:1]))
+		common.Throw(err)
+		bits := loadBits(src[legacyHeaderLength:])
+		return &BloomFilter{
+			nbits:    uint64(len(bits)) * 64,
+			counter:  binary.LittleEndian.Uint64(src[1:9]),
+			bits:     bits,
+			k:        int(k),
+			hashPool: NewHashFunctionsPool(),
+		}
+	}
+	switch src[0] {
+	case FormatBloomV2:
+		return &BloomFilter{
+			nbits:    binary.LittleEndian.Uint64(src[10:18]),
+			counter:  binary.LittleEndian.Uint64(src[2:10]),
+			bits:     loadBits(src[bloomV2HeaderLength:]),
+			k:        int(src[1]),
+			format:   src[0],
+			hashPool: NewHashFunctionsPool(),
+		}
+	case FormatBloomV3:
+		return &BloomFilter{
+			nbits:      binary.LittleEndian.Uint64(src[11:19]),
+			counter:    binary.LittleEndian.Uint64(src[3:11]),
+			bits:       loadBits(src[bloomV3HeaderLength:]),
+			k:          int(src[1]),
+			format:     src[0],
+			hashFamily: src[2],
+			hashPool:   NewHashFunctionsPool(),
+		}
+	default:
+		panic(fmt.Sprintf("unsupported filter format [%#x]", src[0]))
 	}
 }
 
-func NewFrozenFilter(m int, k int) *Filter {
+// NewFrozenFilter create a filter of 2 ** m bits with the legacy format.
+func NewFrozenFilter(m int, k int) *BloomFilter {
 	pool := NewHashFunctionsPool()
 	if k > pool.Size() {
 		log.Panicf("unsupported k value of %v, k should no larger than (%v)", k, pool.Size())
 	}
 	//fmt.Println("filter size:", 1<<(m-6), "uint64")
-	return &Filter{
-		m:        m,
-		mask:     0xFFFFFFFFFFFFFFFF >> (64 - m),
+	return &BloomFilter{
+		nbits:    1 << m,
 		counter:  0,
 		bits:     make([]uint64, 1<<(m-6)),
 		k:        k,
 		hashPool: pool,
 	}
 }
+
+// OptimalK returns the number of hash functions which minimizes the false positive rate with bitsPerKey bits per key,
+// k is capped by the size of the HashFunctionsPool for the HashFamilyClassic and by the byte of the header otherwise.
+func OptimalK(bitsPerKey int, family byte) int {
+	k := int(math.Round(float64(bitsPerKey) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	limit := math.MaxUint8
+	if family == HashFamilyClassic {
+		limit = NewHashFunctionsPool().Size()
+	}
+	if k > limit {
+		k = limit
+	}
+	return k
+}
+
+// NewFilterWithBitsPerKey create a filter sized for n keys with bitsPerKey bits per key and the optimal k,
+// the filter is probed by the double hashing of xxHash64 and dumped with the format v3.
+func NewFilterWithBitsPerKey(n int, bitsPerKey int) *BloomFilter {
+	nbits := uint64(n * bitsPerKey)
+	// round up to the whole uint64 and keep at least 64 bits to bound the false positive rate of tiny filters
+	nbits = (nbits + 63) / 64 * 64
+	if nbits < 64 {
+		nbits = 64
+	}
+	return &BloomFilter{
+		nbits:      nbits,
+		counter:    0,
+		bits:       make([]uint64, nbits/64),
+		k:          OptimalK(bitsPerKey, HashFamilyXXHash64),
+		format:     FormatBloomV3,
+		hashFamily: HashFamilyXXHash64,
+		hashPool:   NewHashFunctionsPool(),
+	}
+}
+
+// compatible reports whether the bits of the filters are set by the same hash functions.
+func (f *BloomFilter) compatible(other *BloomFilter) bool {
+	return f.nbits == other.nbits && f.k == other.k && f.hashFamily == other.hashFamily && len(f.bits) == len(other.bits)
+}
+
+// Union sets the bits of the other filter, the keys of either filter exist in the filter after the union.
+// ErrIncompatibleFilters is returned if the filters are of different sizes or different hash functions.
+func (f *BloomFilter) Union(other *BloomFilter) error {
+	if !f.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	for i := range f.bits {
+		f.bits[i] |= other.bits[i]
+	}
+	f.counter = estimateCount(hamming.CountBitsUint64s(f.bits), f.nbits, f.k)
+	return nil
+}
+
+// Intersect keeps the bits set in both filters, the keys of both filters exist in the filter after the intersection
+// while the false positive rate is no better than the one of the filter before the intersection.
+func (f *BloomFilter) Intersect(other *BloomFilter) error {
+	if !f.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	for i := range f.bits {
+		f.bits[i] &= other.bits[i]
+	}
+	f.counter = estimateCount(hamming.CountBitsUint64s(f.bits), f.nbits, f.k)
+	return nil
+}
+
+// estimateCount estimates the number of the keys by the number of the set bits, n = -m/k * ln(1 - x/m).
+func estimateCount(set int, nbits uint64, k int) uint64 {
+	if uint64(set) >= nbits {
+		return nbits
+	}
+	return uint64(math.Round(-float64(nbits) / float64(k) * math.Log(1-float64(set)/float64(nbits))))
+}
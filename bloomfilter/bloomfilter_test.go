@@ -77,4 +77,62 @@ func TestFilter_DumpBytes(t *testing.T) {
 func TestLoadFilterFromBytes(t *testing.T) {
 	var a string
 	fmt.Println(a)
-}
\ No newline at end of file
+}
+
+func TestNewFilterWithBitsPerKey(t *testing.T) {
+	total := 10000
+	filter := NewFilterWithBitsPerKey(total, 10)
+	for i := 0; i < total; i++ {
+		filter.Add(fmt.Sprintf("key-%v", i))
+	}
+	loaded := LoadFilterFromBytes(filter.DumpBytes())
+	if loaded.Legacy() || loaded.k != OptimalK(10, HashFamilyXXHash64) || loaded.nbits != filter.nbits {
+		t.Fatalf("wrong filter loaded, k: %v, nbits: %v", loaded.k, loaded.nbits)
+	}
+	for i := 0; i < total; i++ {
+		if !loaded.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed", i)
+		}
+	}
+	wrong := 0
+	for i := total; i < total*11; i++ {
+		if loaded.Exists(fmt.Sprintf("key-%v", i)) {
+			wrong += 1
+		}
+	}
+	if rate := float64(wrong) / float64(total*10); rate > 0.05 {
+		t.Errorf("false positive rate %v is too high", rate)
+	}
+}
+
+func TestLoadFilterFromBytes_Legacy(t *testing.T) {
+	filter := NewFrozenFilter(10, 4)
+	for i := 0; i < 100; i++ {
+		filter.Add(fmt.Sprintf("key-%v", i))
+	}
+	src := filter.DumpBytes()
+	if !IsLegacyFormat(src) {
+		t.Fatalf("the filter is supposed to be dumped with the legacy format")
+	}
+	loaded := LoadFilterFromBytes(src)
+	for i := 0; i < 100; i++ {
+		if !loaded.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed", i)
+		}
+	}
+}
+
+func TestOptimalK(t *testing.T) {
+	if k := OptimalK(20, HashFamilyXXHash64); k != 14 {
+		t.Errorf("k of the xxHash64 family is supposed to be 14 with 20 bits per key, got %v", k)
+	}
+	if k, size := OptimalK(20, HashFamilyClassic), NewHashFunctionsPool().Size(); k != size {
+		t.Errorf("k of the classic family is supposed to be capped by the pool size %v, got %v", size, k)
+	}
+	if k := OptimalK(10, HashFamilyClassic); k != 7 {
+		t.Errorf("k is supposed to be 7 with 10 bits per key, got %v", k)
+	}
+	if k := OptimalK(0, HashFamilyXXHash64); k != 1 {
+		t.Errorf("k is supposed to be at least 1, got %v", k)
+	}
+}
@@ -0,0 +1,170 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+)
+
+/*
+CountingBloomFilter replaces each bit of the bloom filter with a 4 bits counter so that the keys can be removed.
+The counters are saturated at 15 and never decreased once saturated, which keeps the filter free of false negatives.
+
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+| tag  |  k   |family|                        counter                        |           ncounters...
+| 16   | 17   | 18   | 19   |
+| ---- | ---- | ---- | ---- |
+     ncounters      |  data......
+*/
+
+const (
+	countingHeaderLength = 19
+	countersPerWord      = 16
+	maxCounterValue      = 0xf
+)
+
+type CountingBloomFilter struct {
+	// counters packs 16 counters of 4 bits into each uint64
+	counters   []uint64
+	counter    uint64
+	ncounters  uint64
+	k          int
+	hashFamily byte
+	hashPool   *HashFunctionsPool
+}
+
+// NewCountingFilter creates a counting filter sized for n keys with cellsPerKey counters per key and the optimal k.
+func NewCountingFilter(n int, cellsPerKey int) *CountingBloomFilter {
+	ncounters := uint64(n * cellsPerKey)
+	ncounters = (ncounters + countersPerWord - 1) / countersPerWord * countersPerWord
+	if ncounters < countersPerWord {
+		ncounters = countersPerWord
+	}
+	return &CountingBloomFilter{
+		counters:   make([]uint64, ncounters/countersPerWord),
+		ncounters:  ncounters,
+		k:          OptimalK(cellsPerKey, HashFamilyXXHash64),
+		hashFamily: HashFamilyXXHash64,
+		hashPool:   NewHashFunctionsPool(),
+	}
+}
+
+// indexes returns the indexes of the counters of the key, the same hash functions as the BloomFilter are used.
+func (f *CountingBloomFilter) indexes(key interface{}) []uint64 {
+	indexes := hashValues(f.hashFamily, f.hashPool, keyToBytes(key), f.k)
+	for i := range indexes {
+		indexes[i] %= f.ncounters
+	}
+	return indexes
+}
+
+func (f *CountingBloomFilter) get(i uint64) uint64 {
+	return (f.counters[i/countersPerWord] >> (i % countersPerWord * 4)) & maxCounterValue
+}
+
+func (f *CountingBloomFilter) set(i uint64, value uint64) {
+	shift := i % countersPerWord * 4
+	word := &f.counters[i/countersPerWord]
+	*word = *word&^(maxCounterValue<<shift) | value<<shift
+}
+
+func (f *CountingBloomFilter) Add(key interface{}) {
+	for _, i := range f.indexes(key) {
+		if value := f.get(i); value < maxCounterValue {
+			f.set(i, value+1)
+		}
+	}
+	f.counter++
+}
+
+// Remove decreases the counters of the key, false is returned and nothing is changed if the key does not exist.
+// Removing a key which is never added may remove other keys.
+func (f *CountingBloomFilter) Remove(key interface{}) bool {
+	indexes := f.indexes(key)
+	for _, i := range indexes {
+		if f.get(i) == 0 {
+			return false
+		}
+	}
+	for _, i := range indexes {
+		if value := f.get(i); value < maxCounterValue {
+			f.set(i, value-1)
+		}
+	}
+	if f.counter > 0 {
+		f.counter--
+	}
+	return true
+}
+
+func (f *CountingBloomFilter) Exists(key interface{}) bool {
+	for _, i := range f.indexes(key) {
+		if f.get(i) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *CountingBloomFilter) Count() uint64 {
+	return f.counter
+}
+
+func (f *CountingBloomFilter) compatible(other *CountingBloomFilter) bool {
+	return f.ncounters == other.ncounters && f.k == other.k && f.hashFamily == other.hashFamily
+}
+
+// Union adds the counters of the other filter, the counters are saturated at 15.
+func (f *CountingBloomFilter) Union(other *CountingBloomFilter) error {
+	if !f.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	for i := uint64(0); i < f.ncounters; i++ {
+		value := f.get(i) + other.get(i)
+		if value > maxCounterValue {
+			value = maxCounterValue
+		}
+		f.set(i, value)
+	}
+	f.counter += other.counter
+	return nil
+}
+
+// Intersect keeps the smaller counter of the filters.
+func (f *CountingBloomFilter) Intersect(other *CountingBloomFilter) error {
+	if !f.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	set := 0
+	for i := uint64(0); i < f.ncounters; i++ {
+		if value := other.get(i); value < f.get(i) {
+			f.set(i, value)
+		}
+		if f.get(i) != 0 {
+			set += 1
+		}
+	}
+	f.counter = estimateCount(set, f.ncounters, f.k)
+	return nil
+}
+
+func (f *CountingBloomFilter) DumpBytes() []byte {
+	fullBytes := make([]byte, len(f.counters)*8+countingHeaderLength)
+	fullBytes[0] = FormatCounting
+	fullBytes[1] = byte(f.k)
+	fullBytes[2] = f.hashFamily
+	binary.LittleEndian.PutUint64(fullBytes[3:11], f.counter)
+	binary.LittleEndian.PutUint64(fullBytes[11:19], f.ncounters)
+	dumpBits(fullBytes[countingHeaderLength:], f.counters)
+	return fullBytes
+}
+
+func LoadCountingFilterFromBytes(src []byte) *CountingBloomFilter {
+	return &CountingBloomFilter{
+		k:          int(src[1]),
+		hashFamily: src[2],
+		counter:    binary.LittleEndian.Uint64(src[3:11]),
+		ncounters:  binary.LittleEndian.Uint64(src[11:19]),
+		counters:   loadBits(src[countingHeaderLength:]),
+		hashPool:   NewHashFunctionsPool(),
+	}
+}
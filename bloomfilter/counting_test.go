@@ -0,0 +1,97 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCountingBloomFilter_Remove(t *testing.T) {
+	filter := NewCountingFilter(1000, 10)
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("key-%v", i))
+	}
+	for i := 0; i < 500; i++ {
+		if !filter.Remove(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be removed", i)
+		}
+	}
+	if filter.Count() != 500 {
+		t.Errorf("wrong count %v", filter.Count())
+	}
+	for i := 500; i < 1000; i++ {
+		if !filter.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed", i)
+		}
+	}
+	wrong := 0
+	for i := 0; i < 500; i++ {
+		if filter.Exists(fmt.Sprintf("key-%v", i)) {
+			wrong += 1
+		}
+	}
+	if rate := float64(wrong) / 500; rate > 0.05 {
+		t.Errorf("false positive rate %v of the removed keys is too high", rate)
+	}
+}
+
+func TestCountingBloomFilter_Saturated(t *testing.T) {
+	filter := NewCountingFilter(10, 10)
+	for i := 0; i < 20; i++ {
+		filter.Add("key")
+	}
+	for i := 0; i < 20; i++ {
+		filter.Remove("key")
+	}
+	if !filter.Exists("key") {
+		t.Errorf("the saturated counters are not supposed to be decreased")
+	}
+}
+
+func TestCountingBloomFilter_DumpBytes(t *testing.T) {
+	filter := NewCountingFilter(1000, 10)
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("key-%v", i))
+	}
+	loaded := Load(filter.DumpBytes()).(*CountingBloomFilter)
+	if loaded.Count() != filter.Count() {
+		t.Errorf("wrong count %v", loaded.Count())
+	}
+	for i := 0; i < 1000; i++ {
+		if !loaded.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed", i)
+		}
+	}
+	if !loaded.Remove("key-0") || loaded.Count() != 999 {
+		t.Errorf("the loaded filter is supposed to support removing")
+	}
+}
+
+func TestCountingBloomFilter_UnionIntersect(t *testing.T) {
+	a, b := NewCountingFilter(1000, 10), NewCountingFilter(1000, 10)
+	for i := 0; i < 600; i++ {
+		a.Add(fmt.Sprintf("key-%v", i))
+	}
+	for i := 400; i < 1000; i++ {
+		b.Add(fmt.Sprintf("key-%v", i))
+	}
+	union := LoadCountingFilterFromBytes(a.DumpBytes())
+	if err := union.Union(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if !union.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed in the union", i)
+		}
+	}
+	if err := a.Intersect(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 400; i < 600; i++ {
+		if !a.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed in the intersection", i)
+		}
+	}
+	if err := a.Union(NewCountingFilter(100, 10)); err != ErrIncompatibleFilters {
+		t.Errorf("unexpected error %v", err)
+	}
+}
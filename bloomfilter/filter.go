@@ -0,0 +1,98 @@
+package bloomfilter
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+)
+
+// ErrIncompatibleFilters is returned by the union and the intersection of the filters built by different parameters.
+var ErrIncompatibleFilters = errors.New("bloomfilter: incompatible filters")
+
+// Filter is the common interface of the filters.
+// Static filters (binary fuse, ribbon) are built from the full key set at once and can not be added to.
+type Filter interface {
+	Exists(key interface{}) bool
+	DumpBytes() []byte
+	Count() uint64
+}
+
+// Load load the filter of any format by the format tag of the bytes.
+func Load(src []byte) Filter {
+	if IsLegacyFormat(src) {
+		return LoadFilterFromBytes(src)
+	}
+	switch src[0] {
+	case FormatBloomV2, FormatBloomV3:
+		return LoadFilterFromBytes(src)
+	case FormatBinaryFuse8:
+		return LoadBinaryFuseFilterFromBytes(src)
+	case FormatRibbon:
+		return LoadRibbonFilterFromBytes(src)
+	case FormatCounting:
+		return LoadCountingFilterFromBytes(src)
+	case FormatScalable:
+		return LoadScalableFilterFromBytes(src)
+	case FormatBlocked:
+		return LoadBlockedFilterFromBytes(src)
+	default:
+		panic(fmt.Sprintf("unsupported filter format [%#x]", src[0]))
+	}
+}
+
+func keyToBytes(key interface{}) []byte {
+	switch key.(type) {
+	case string:
+		return []byte(key.(string))
+	case []byte:
+		return key.([]byte)
+	default:
+		panic(fmt.Sprintf("Invalid type [%v] of the key\n", reflect.TypeOf(key)))
+	}
+}
+
+// keyHash is the 64 bits hash of the key used by the static filters.
+func keyHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return fmix64(h.Sum64())
+}
+
+// fmix64 is the finalizer of murmur3, it spreads the entropy of the input to all the bits.
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+func splitmix64(seed *uint64) uint64 {
+	*seed += 0x9E3779B97F4A7C15
+	z := *seed
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// uniqueHashes returns the sorted distinct hashes of the keys, the static filters can not be built with duplicated keys.
+func uniqueHashes(keys [][]byte) []uint64 {
+	hashes := make([]uint64, len(keys))
+	for i, key := range keys {
+		hashes[i] = keyHash(key)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i] < hashes[j]
+	})
+	n := 0
+	for i, h := range hashes {
+		if i == 0 || h != hashes[n-1] {
+			hashes[n] = h
+			n++
+		}
+	}
+	return hashes[:n]
+}
@@ -0,0 +1,60 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testStaticFilter(t *testing.T, build func(keys [][]byte) Filter, maxBitsPerKey float64) {
+	for _, total := range []int{0, 1, 7, 1000, 100000} {
+		keys := make([][]byte, total)
+		for i := range keys {
+			keys[i] = []byte(fmt.Sprintf("key-%v", i))
+		}
+		filter := Load(build(keys).DumpBytes())
+		if filter.Count() != uint64(total) {
+			t.Errorf("wrong count %v of %v keys", filter.Count(), total)
+		}
+		for _, key := range keys {
+			if !filter.Exists(key) {
+				t.Fatalf("%v is supposed to be existed", string(key))
+			}
+		}
+		if total < 1000 {
+			continue
+		}
+		wrong := 0
+		for i := total; i < total*11; i++ {
+			if filter.Exists(fmt.Sprintf("key-%v", i)) {
+				wrong += 1
+			}
+		}
+		if rate := float64(wrong) / float64(total*10); rate > 0.01 {
+			t.Errorf("false positive rate %v of %v keys is too high", rate, total)
+		}
+		// small filters take larger space overhead
+		if bitsPerKey := float64(len(filter.DumpBytes())*8) / float64(total); total >= 100000 && bitsPerKey > maxBitsPerKey {
+			t.Errorf("%v bits per key of %v keys is too large", bitsPerKey, total)
+		}
+	}
+}
+
+func TestBinaryFuseFilter(t *testing.T) {
+	testStaticFilter(t, func(keys [][]byte) Filter {
+		return NewBinaryFuseFilter(keys)
+	}, 10)
+}
+
+func TestRibbonFilter(t *testing.T) {
+	testStaticFilter(t, func(keys [][]byte) Filter {
+		return NewRibbonFilter(keys)
+	}, 10)
+}
+
+func TestRibbonFilter_DuplicatedKeys(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("a")}
+	filter := NewRibbonFilter(keys)
+	if filter.Count() != 2 || !filter.Exists("a") || !filter.Exists("b") {
+		t.Errorf("duplicated keys are supposed to be ignored")
+	}
+}
@@ -0,0 +1,242 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+/*
+BinaryFuseFilter is a static 3-wise binary fuse filter with 8 bits fingerprints,
+it takes about 9 bits per key with the false positive rate of 1/256.
+
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+| tag  |                          seed                         |      segment length       |  segment count...
+| 16   | 17   | 18   | 19   | 20   | 21   | 22   | 23   | 24   | 25   | 26   | 27   | 28   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+   segment count    |                        counter                        | fingerprints......
+*/
+
+const (
+	binaryFuseHeaderLength    = 25
+	binaryFuseMaxSegment      = 1 << 18
+	binaryFuseMaxConstruction = 100
+)
+
+type BinaryFuseFilter struct {
+	seed               uint64
+	segmentLength      uint32
+	segmentLengthMask  uint32
+	segmentCount       uint32
+	segmentCountLength uint32
+	counter            uint64
+	fingerprints       []uint8
+}
+
+func (f *BinaryFuseFilter) initialize(size uint32) {
+	f.segmentLength = 4
+	if size > 0 {
+		f.segmentLength = 1 << uint(math.Floor(math.Log(float64(size))/math.Log(3.33)+2.25))
+	}
+	if f.segmentLength > binaryFuseMaxSegment {
+		f.segmentLength = binaryFuseMaxSegment
+	}
+	sizeFactor := 1.125
+	if size > 1 {
+		sizeFactor = math.Max(1.125, 0.875+0.25*math.Log(1000000)/math.Log(float64(size)))
+	}
+	capacity := 0
+	if size > 1 {
+		capacity = int(math.Round(float64(size) * sizeFactor))
+	}
+	segmentLength := int(f.segmentLength)
+	segmentCount := (capacity+segmentLength-1)/segmentLength - 2
+	if segmentCount < 1 {
+		segmentCount = 1
+	}
+	f.segmentCount = uint32(segmentCount)
+	f.segmentLengthMask = f.segmentLength - 1
+	f.segmentCountLength = f.segmentCount * f.segmentLength
+	f.fingerprints = make([]uint8, (segmentCount+2)*segmentLength)
+}
+
+func (f *BinaryFuseFilter) positions(hash uint64) (uint32, uint32, uint32) {
+	hi, _ := bits.Mul64(hash, uint64(f.segmentCountLength))
+	h0 := uint32(hi)
+	h1 := h0 + f.segmentLength
+	h2 := h1 + f.segmentLength
+	h1 ^= uint32(hash>>18) & f.segmentLengthMask
+	h2 ^= uint32(hash) & f.segmentLengthMask
+	return h0, h1, h2
+}
+
+func fuseFingerprint(hash uint64) uint8 {
+	return uint8(hash ^ (hash >> 32))
+}
+
+func mod3(x uint8) uint8 {
+	if x > 2 {
+		x -= 3
+	}
+	return x
+}
+
+// populate build the filter by peeling the 3-hypergraph of the hashes, the hashes must be distinct.
+func (f *BinaryFuseFilter) populate(keys []uint64) {
+	size := uint32(len(keys))
+	f.initialize(size)
+	f.counter = uint64(size)
+	var rng uint64 = 1
+	f.seed = splitmix64(&rng)
+	capacity := uint32(len(f.fingerprints))
+	alone := make([]uint32, capacity)
+	t2count := make([]uint8, capacity)
+	t2hash := make([]uint64, capacity)
+	reverseH := make([]uint8, size)
+	reverseOrder := make([]uint64, size+1)
+	reverseOrder[size] = 1
+	blockBits := uint(1)
+	for (uint32(1) << blockBits) < f.segmentCount {
+		blockBits += 1
+	}
+	block := uint32(1) << blockBits
+	startPos := make([]uint32, block)
+	h012 := make([]uint32, 5)
+	for attempt := 0; ; attempt++ {
+		if attempt >= binaryFuseMaxConstruction {
+			panic(fmt.Sprintf("failed to build the binary fuse filter of %v keys", size))
+		}
+		// sort the hashes by the segment roughly to make the construction cache friendly
+		for i := uint32(0); i < block; i++ {
+			startPos[i] = uint32((uint64(i) * uint64(size)) >> blockBits)
+		}
+		for _, key := range keys {
+			hash := fmix64(key + f.seed)
+			segmentIndex := hash >> (64 - blockBits)
+			for reverseOrder[startPos[segmentIndex]] != 0 {
+				segmentIndex = (segmentIndex + 1) & uint64(block-1)
+			}
+			reverseOrder[startPos[segmentIndex]] = hash
+			startPos[segmentIndex] += 1
+		}
+		overflow := false
+		for i := uint32(0); i < size; i++ {
+			hash := reverseOrder[i]
+			h0, h1, h2 := f.positions(hash)
+			t2count[h0] += 4
+			t2hash[h0] ^= hash
+			t2count[h1] += 4
+			t2count[h1] ^= 1
+			t2hash[h1] ^= hash
+			t2count[h2] += 4
+			t2count[h2] ^= 2
+			t2hash[h2] ^= hash
+			if t2count[h0] < 4 || t2count[h1] < 4 || t2count[h2] < 4 {
+				overflow = true
+			}
+		}
+		stackSize := uint32(0)
+		if !overflow {
+			// peel the slots which are mapped by exactly one key
+			queueSize := 0
+			for i := uint32(0); i < capacity; i++ {
+				alone[queueSize] = i
+				if (t2count[i] >> 2) == 1 {
+					queueSize++
+				}
+			}
+			for queueSize > 0 {
+				queueSize--
+				index := alone[queueSize]
+				if (t2count[index] >> 2) != 1 {
+					continue
+				}
+				hash := t2hash[index]
+				found := t2count[index] & 3
+				reverseH[stackSize] = found
+				reverseOrder[stackSize] = hash
+				stackSize++
+				h0, h1, h2 := f.positions(hash)
+				h012[1], h012[2], h012[3], h012[4] = h1, h2, h0, h1
+				other := h012[found+1]
+				alone[queueSize] = other
+				if (t2count[other] >> 2) == 2 {
+					queueSize++
+				}
+				t2count[other] -= 4
+				t2count[other] ^= mod3(found + 1)
+				t2hash[other] ^= hash
+				other = h012[found+2]
+				alone[queueSize] = other
+				if (t2count[other] >> 2) == 2 {
+					queueSize++
+				}
+				t2count[other] -= 4
+				t2count[other] ^= mod3(found + 2)
+				t2hash[other] ^= hash
+			}
+		}
+		if stackSize == size {
+			break
+		}
+		for i := uint32(0); i < size; i++ {
+			reverseOrder[i] = 0
+		}
+		for i := range t2count {
+			t2count[i] = 0
+			t2hash[i] = 0
+		}
+		f.seed = splitmix64(&rng)
+	}
+	for i := int(size) - 1; i >= 0; i-- {
+		hash := reverseOrder[i]
+		h0, h1, h2 := f.positions(hash)
+		found := reverseH[i]
+		h012[0], h012[1], h012[2], h012[3], h012[4] = h0, h1, h2, h0, h1
+		f.fingerprints[h012[found]] = fuseFingerprint(hash) ^ f.fingerprints[h012[found+1]] ^ f.fingerprints[h012[found+2]]
+	}
+}
+
+func (f *BinaryFuseFilter) Exists(key interface{}) bool {
+	hash := fmix64(keyHash(keyToBytes(key)) + f.seed)
+	h0, h1, h2 := f.positions(hash)
+	return fuseFingerprint(hash) == f.fingerprints[h0]^f.fingerprints[h1]^f.fingerprints[h2]
+}
+
+func (f *BinaryFuseFilter) Count() uint64 {
+	return f.counter
+}
+
+func (f *BinaryFuseFilter) DumpBytes() []byte {
+	fullBytes := make([]byte, binaryFuseHeaderLength+len(f.fingerprints))
+	fullBytes[0] = FormatBinaryFuse8
+	binary.LittleEndian.PutUint64(fullBytes[1:9], f.seed)
+	binary.LittleEndian.PutUint32(fullBytes[9:13], f.segmentLength)
+	binary.LittleEndian.PutUint32(fullBytes[13:17], f.segmentCount)
+	binary.LittleEndian.PutUint64(fullBytes[17:25], f.counter)
+	copy(fullBytes[binaryFuseHeaderLength:], f.fingerprints)
+	return fullBytes
+}
+
+func LoadBinaryFuseFilterFromBytes(src []byte) *BinaryFuseFilter {
+	f := &BinaryFuseFilter{
+		seed:          binary.LittleEndian.Uint64(src[1:9]),
+		segmentLength: binary.LittleEndian.Uint32(src[9:13]),
+		segmentCount:  binary.LittleEndian.Uint32(src[13:17]),
+		counter:       binary.LittleEndian.Uint64(src[17:25]),
+		fingerprints:  make([]uint8, len(src)-binaryFuseHeaderLength),
+	}
+	f.segmentLengthMask = f.segmentLength - 1
+	f.segmentCountLength = f.segmentCount * f.segmentLength
+	copy(f.fingerprints, src[binaryFuseHeaderLength:])
+	return f
+}
+
+// NewBinaryFuseFilter build the filter from the full key set.
+func NewBinaryFuseFilter(keys [][]byte) *BinaryFuseFilter {
+	f := &BinaryFuseFilter{}
+	f.populate(uniqueHashes(keys))
+	return f
+}
@@ -1,5 +1,40 @@
 package bloomfilter
 
+import (
+	"fmt"
+)
+
+// The hash families of the filters, the family is recorded in the header of the filters so that the filters dumped
+// by the older versions are always probed by the same hash functions.
+const (
+	// HashFamilyClassic takes the i-th function of the HashFunctionsPool as the i-th hash function,
+	// k is limited by the size of the pool.
+	HashFamilyClassic byte = 0
+	// HashFamilyXXHash64 derives the i-th hash from one xxHash64 by the double hashing h1 + i * h2.
+	HashFamilyXXHash64 byte = 1
+)
+
+// hashValues returns the k hash values of the key with the hash family.
+func hashValues(family byte, pool *HashFunctionsPool, keyBytes []byte, k int) []uint64 {
+	values := make([]uint64, k)
+	switch family {
+	case HashFamilyClassic:
+		for i := 0; i < k; i += 1 {
+			values[i] = pool.GetHashFunctionByIndex(i)(keyBytes)
+		}
+	case HashFamilyXXHash64:
+		h1 := XXHash64(keyBytes, 0)
+		// h2 is odd so that the probes do not collapse into one bit with the even sizes
+		h2 := fmix64(h1) | 1
+		for i := 0; i < k; i += 1 {
+			values[i] = h1 + uint64(i)*h2
+		}
+	default:
+		panic(fmt.Sprintf("unsupported hash family [%#x]", family))
+	}
+	return values
+}
+
 type HashFunctionsPool struct {
 	pool        []func(str []byte) (hash uint64)
 	functionMap map[string]func(str []byte) (hash uint64)
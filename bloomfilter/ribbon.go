@@ -0,0 +1,142 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+/*
+RibbonFilter is a static standard ribbon filter with 64 bits wide coefficient rows and 8 bits results,
+it takes about 8.5 bits per key with the false positive rate of 1/256.
+Every key is mapped to a start slot, a coefficient row and a result, and the solution is built by the on-the-fly
+gaussian elimination of the banded linear system followed by the back substitution.
+
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+| tag  |                          seed                         |       number of slots     |      counter...
+| 16   | 17   | 18   | 19   | 20   | 21   |
+| ---- | ---- | ---- | ---- | ---- | ---- |
+            counter        | solution......
+*/
+
+const (
+	ribbonHeaderLength    = 21
+	ribbonWidth           = 64
+	ribbonMaxConstruction = 32
+)
+
+type RibbonFilter struct {
+	seed     uint64
+	slots    uint32
+	counter  uint64
+	solution []uint8
+}
+
+// ribbonSlots returns the number of slots for n keys, the overhead is increased along with the failed attempts.
+func ribbonSlots(n int, attempt int) uint32 {
+	overhead := n/12 + n*attempt/16
+	return uint32(n + overhead + ribbonWidth)
+}
+
+func (f *RibbonFilter) row(hash uint64) (start uint32, coefficient uint64, result uint8) {
+	h := fmix64(hash + f.seed)
+	hi, _ := bits.Mul64(h, uint64(f.slots-ribbonWidth+1))
+	coefficient = fmix64(h^0x9E3779B97F4A7C15) | 1
+	return uint32(hi), coefficient, uint8(h)
+}
+
+func (f *RibbonFilter) populate(keys []uint64) {
+	f.counter = uint64(len(keys))
+	var rng uint64 = 1
+	for attempt := 0; attempt < ribbonMaxConstruction; attempt++ {
+		f.seed = splitmix64(&rng)
+		f.slots = ribbonSlots(len(keys), attempt)
+		coefficients := make([]uint64, f.slots)
+		results := make([]uint8, f.slots)
+		succeeded := true
+		for _, key := range keys {
+			start, coefficient, result := f.row(key)
+			for {
+				if coefficients[start] == 0 {
+					coefficients[start], results[start] = coefficient, result
+					break
+				}
+				coefficient ^= coefficients[start]
+				result ^= results[start]
+				if coefficient == 0 {
+					// the row is linear dependent on the others, it is consistent only if the result is eliminated too
+					succeeded = result == 0
+					break
+				}
+				shift := bits.TrailingZeros64(coefficient)
+				start += uint32(shift)
+				coefficient >>= uint(shift)
+			}
+			if !succeeded {
+				break
+			}
+		}
+		if !succeeded {
+			continue
+		}
+		// back substitution
+		f.solution = make([]uint8, f.slots)
+		for i := int(f.slots) - 1; i >= 0; i-- {
+			if coefficients[i] == 0 {
+				continue
+			}
+			f.solution[i] = results[i] ^ f.dot(uint32(i), coefficients[i]&^1)
+		}
+		return
+	}
+	panic(fmt.Sprintf("failed to build the ribbon filter of %v keys", len(keys)))
+}
+
+// dot returns the xor of the solution of the slots selected by the coefficient row.
+func (f *RibbonFilter) dot(start uint32, coefficient uint64) uint8 {
+	var result uint8 = 0
+	for coefficient != 0 {
+		shift := bits.TrailingZeros64(coefficient)
+		result ^= f.solution[start+uint32(shift)]
+		coefficient &= coefficient - 1
+	}
+	return result
+}
+
+func (f *RibbonFilter) Exists(key interface{}) bool {
+	start, coefficient, result := f.row(keyHash(keyToBytes(key)))
+	return f.dot(start, coefficient) == result
+}
+
+func (f *RibbonFilter) Count() uint64 {
+	return f.counter
+}
+
+func (f *RibbonFilter) DumpBytes() []byte {
+	fullBytes := make([]byte, ribbonHeaderLength+len(f.solution))
+	fullBytes[0] = FormatRibbon
+	binary.LittleEndian.PutUint64(fullBytes[1:9], f.seed)
+	binary.LittleEndian.PutUint32(fullBytes[9:13], f.slots)
+	binary.LittleEndian.PutUint64(fullBytes[13:21], f.counter)
+	copy(fullBytes[ribbonHeaderLength:], f.solution)
+	return fullBytes
+}
+
+func LoadRibbonFilterFromBytes(src []byte) *RibbonFilter {
+	f := &RibbonFilter{
+		seed:     binary.LittleEndian.Uint64(src[1:9]),
+		slots:    binary.LittleEndian.Uint32(src[9:13]),
+		counter:  binary.LittleEndian.Uint64(src[13:21]),
+		solution: make([]uint8, len(src)-ribbonHeaderLength),
+	}
+	copy(f.solution, src[ribbonHeaderLength:])
+	return f
+}
+
+// NewRibbonFilter build the filter from the full key set.
+func NewRibbonFilter(keys [][]byte) *RibbonFilter {
+	f := &RibbonFilter{}
+	f.populate(uniqueHashes(keys))
+	return f
+}
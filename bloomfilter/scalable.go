@@ -0,0 +1,202 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+/*
+ScalableBloomFilter keeps a target false positive rate for an unknown number of keys by adding slices as it fills.
+The slice i holds capacity * growth^i keys with the false positive rate p * (1 - r) * r^i, where r is the tightening
+ratio, so that the compound false positive rate of all the slices is bounded by p.
+
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+| tag  |growth|                        counter                        |                   capacity...
+| 16   | 17   | 18   | 19   | 20   | 21   | 22   | 23   | 24   | 25   | 26   | 27   | 28   | 29   | 30   | 31   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+|  capacity   |                        fp rate                        |                  tightening...
+| 32   | 33   | 34   | 35   | 36   | 37   |
+| ---- | ---- | ---- | ---- | ---- | ---- |
+| tightening  |          nslices          |  slices (the length of 4 bytes followed by the dumped slice)......
+*/
+
+const (
+	DefaultScalableGrowth     = 2
+	DefaultScalableTightening = 0.9
+
+	scalableHeaderLength = 38
+)
+
+type ScalableBloomFilter struct {
+	// capacity is the number of the keys of the first slice
+	// growth is the ratio of the capacity of a slice to the one of the slice before it
+	// tightening is the ratio of the false positive rate of a slice to the one of the slice before it
+	slices     []*BloomFilter
+	counter    uint64
+	capacity   uint64
+	growth     int
+	fpRate     float64
+	tightening float64
+}
+
+// NewScalableFilter creates a scalable filter whose first slice holds capacity keys, the false positive rate of
+// the filter is kept under fpRate however many keys are added.
+func NewScalableFilter(capacity int, fpRate float64) *ScalableBloomFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	f := &ScalableBloomFilter{
+		capacity:   uint64(capacity),
+		growth:     DefaultScalableGrowth,
+		fpRate:     fpRate,
+		tightening: DefaultScalableTightening,
+	}
+	f.addSlice()
+	return f
+}
+
+// sliceCapacity returns the number of the keys the slice i holds.
+func (f *ScalableBloomFilter) sliceCapacity(i int) uint64 {
+	return f.capacity * uint64(math.Pow(float64(f.growth), float64(i)))
+}
+
+func (f *ScalableBloomFilter) addSlice() {
+	i := len(f.slices)
+	fpRate := f.fpRate * (1 - f.tightening) * math.Pow(f.tightening, float64(i))
+	f.slices = append(f.slices, newFilterWithFalsePositiveRate(f.sliceCapacity(i), fpRate))
+}
+
+// newFilterWithFalsePositiveRate creates a filter of m = -n * ln(p) / ln(2)^2 bits and k = log2(1 / p).
+func newFilterWithFalsePositiveRate(n uint64, fpRate float64) *BloomFilter {
+	nbits := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	nbits = (nbits + 63) / 64 * 64
+	if nbits < 64 {
+		nbits = 64
+	}
+	k := int(math.Ceil(math.Log2(1 / fpRate)))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		nbits:      nbits,
+		bits:       make([]uint64, nbits/64),
+		k:          k,
+		format:     FormatBloomV3,
+		hashFamily: HashFamilyXXHash64,
+		hashPool:   NewHashFunctionsPool(),
+	}
+}
+
+// Add adds the key into the last slice, a new slice is added once the last slice is full.
+// The keys already existed are skipped so that the slices are not filled by the duplicated keys.
+func (f *ScalableBloomFilter) Add(key interface{}) {
+	if f.Exists(key) {
+		return
+	}
+	last := f.slices[len(f.slices)-1]
+	if last.Count() >= f.sliceCapacity(len(f.slices)-1) {
+		f.addSlice()
+		last = f.slices[len(f.slices)-1]
+	}
+	last.Add(key)
+	f.counter++
+}
+
+func (f *ScalableBloomFilter) Exists(key interface{}) bool {
+	for i := len(f.slices) - 1; i >= 0; i-- {
+		if f.slices[i].Exists(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ScalableBloomFilter) Count() uint64 {
+	return f.counter
+}
+
+// Slices returns the number of the slices.
+func (f *ScalableBloomFilter) Slices() int {
+	return len(f.slices)
+}
+
+func (f *ScalableBloomFilter) compatible(other *ScalableBloomFilter) bool {
+	return f.capacity == other.capacity && f.growth == other.growth &&
+		f.fpRate == other.fpRate && f.tightening == other.tightening
+}
+
+// Union unions the slices of the filters one by one, the slices the other filter has more are copied.
+// ErrIncompatibleFilters is returned if the filters are created with different parameters.
+func (f *ScalableBloomFilter) Union(other *ScalableBloomFilter) error {
+	if !f.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	for i, slice := range other.slices {
+		if i == len(f.slices) {
+			f.slices = append(f.slices, LoadFilterFromBytes(slice.DumpBytes()))
+			continue
+		}
+		if err := f.slices[i].Union(slice); err != nil {
+			return err
+		}
+	}
+	f.counter += other.counter
+	return nil
+}
+
+// Intersect intersects the filters of a single slice. The keys of the filters of more slices are added into
+// different slices, ErrIncompatibleFilters is returned for them since intersecting the slices loses the keys.
+func (f *ScalableBloomFilter) Intersect(other *ScalableBloomFilter) error {
+	if !f.compatible(other) || len(f.slices) != 1 || len(other.slices) != 1 {
+		return ErrIncompatibleFilters
+	}
+	if err := f.slices[0].Intersect(other.slices[0]); err != nil {
+		return err
+	}
+	f.counter = f.slices[0].Count()
+	return nil
+}
+
+func (f *ScalableBloomFilter) DumpBytes() []byte {
+	dumped := make([][]byte, len(f.slices))
+	size := scalableHeaderLength
+	for i, slice := range f.slices {
+		dumped[i] = slice.DumpBytes()
+		size += 4 + len(dumped[i])
+	}
+	fullBytes := make([]byte, size)
+	fullBytes[0] = FormatScalable
+	fullBytes[1] = byte(f.growth)
+	binary.LittleEndian.PutUint64(fullBytes[2:10], f.counter)
+	binary.LittleEndian.PutUint64(fullBytes[10:18], f.capacity)
+	binary.LittleEndian.PutUint64(fullBytes[18:26], math.Float64bits(f.fpRate))
+	binary.LittleEndian.PutUint64(fullBytes[26:34], math.Float64bits(f.tightening))
+	binary.LittleEndian.PutUint32(fullBytes[34:38], uint32(len(f.slices)))
+	offset := scalableHeaderLength
+	for _, slice := range dumped {
+		binary.LittleEndian.PutUint32(fullBytes[offset:offset+4], uint32(len(slice)))
+		offset += 4
+		offset += copy(fullBytes[offset:], slice)
+	}
+	return fullBytes
+}
+
+func LoadScalableFilterFromBytes(src []byte) *ScalableBloomFilter {
+	f := &ScalableBloomFilter{
+		growth:     int(src[1]),
+		counter:    binary.LittleEndian.Uint64(src[2:10]),
+		capacity:   binary.LittleEndian.Uint64(src[10:18]),
+		fpRate:     math.Float64frombits(binary.LittleEndian.Uint64(src[18:26])),
+		tightening: math.Float64frombits(binary.LittleEndian.Uint64(src[26:34])),
+		slices:     make([]*BloomFilter, binary.LittleEndian.Uint32(src[34:38])),
+	}
+	offset := scalableHeaderLength
+	for i := range f.slices {
+		length := int(binary.LittleEndian.Uint32(src[offset : offset+4]))
+		offset += 4
+		f.slices[i] = LoadFilterFromBytes(src[offset : offset+length])
+		offset += length
+	}
+	return f
+}
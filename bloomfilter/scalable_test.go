@@ -0,0 +1,74 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScalableBloomFilter(t *testing.T) {
+	filter := NewScalableFilter(1000, 0.01)
+	for i := 0; i < 20000; i++ {
+		filter.Add(fmt.Sprintf("key-%v", i))
+	}
+	if filter.Slices() < 2 {
+		t.Errorf("slices are supposed to be added, got %v", filter.Slices())
+	}
+	loaded := Load(filter.DumpBytes())
+	if loaded.Count() != filter.Count() {
+		t.Errorf("wrong count %v of %v", loaded.Count(), filter.Count())
+	}
+	for i := 0; i < 20000; i++ {
+		if !loaded.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed", i)
+		}
+	}
+	wrong := 0
+	for i := 20000; i < 120000; i++ {
+		if loaded.Exists(fmt.Sprintf("key-%v", i)) {
+			wrong += 1
+		}
+	}
+	if rate := float64(wrong) / 100000; rate > 0.02 {
+		t.Errorf("false positive rate %v is too high", rate)
+	}
+}
+
+func TestScalableBloomFilter_UnionIntersect(t *testing.T) {
+	a, b := NewScalableFilter(1000, 0.01), NewScalableFilter(1000, 0.01)
+	for i := 0; i < 3000; i++ {
+		a.Add(fmt.Sprintf("key-%v", i))
+	}
+	for i := 3000; i < 4000; i++ {
+		b.Add(fmt.Sprintf("key-%v", i))
+	}
+	if err := b.Union(a); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4000; i++ {
+		if !b.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed in the union", i)
+		}
+	}
+	if err := a.Intersect(b); err != ErrIncompatibleFilters {
+		t.Errorf("intersecting the filters of several slices is supposed to fail, got %v", err)
+	}
+	if err := a.Union(NewScalableFilter(100, 0.01)); err != ErrIncompatibleFilters {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	c, d := NewScalableFilter(1000, 0.01), NewScalableFilter(1000, 0.01)
+	for i := 0; i < 600; i++ {
+		c.Add(fmt.Sprintf("key-%v", i))
+	}
+	for i := 400; i < 1000; i++ {
+		d.Add(fmt.Sprintf("key-%v", i))
+	}
+	if err := c.Intersect(d); err != nil {
+		t.Fatal(err)
+	}
+	for i := 400; i < 600; i++ {
+		if !c.Exists(fmt.Sprintf("key-%v", i)) {
+			t.Fatalf("key-%v is supposed to be existed in the intersection", i)
+		}
+	}
+}
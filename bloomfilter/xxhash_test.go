@@ -0,0 +1,47 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	tests := []struct {
+		data string
+		hash uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"hello, world", 0xb33a384e6d1b1242},
+		{"abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789$", 0x1032d841e824f998},
+	}
+	for _, test := range tests {
+		if got := XXHash64([]byte(test.data), 0); got != test.hash {
+			t.Errorf("xxHash64 of %q is %#x, expected %#x", test.data, got, test.hash)
+		}
+	}
+}
+
+func TestHashFamily_Compatible(t *testing.T) {
+	// the filters of the format v2 are always probed by the classic hash functions
+	v2 := NewFilterWithBitsPerKey(1000, 10)
+	v2.format, v2.hashFamily = FormatBloomV2, HashFamilyClassic
+	v3 := NewFilterWithBitsPerKey(1000, 10)
+	for i := 0; i < 1000; i++ {
+		v2.Add(fmt.Sprintf("key-%v", i))
+		v3.Add(fmt.Sprintf("key-%v", i))
+	}
+	for _, filter := range []*BloomFilter{v2, v3} {
+		loaded := LoadFilterFromBytes(filter.DumpBytes())
+		if loaded.format != filter.format || loaded.hashFamily != filter.hashFamily {
+			t.Fatalf("wrong format %#x and hash family %v loaded", loaded.format, loaded.hashFamily)
+		}
+		for i := 0; i < 1000; i++ {
+			if !loaded.Exists(fmt.Sprintf("key-%v", i)) {
+				t.Fatalf("key-%v is supposed to be existed", i)
+			}
+		}
+	}
+	if err := v3.Union(v2); err != ErrIncompatibleFilters {
+		t.Errorf("the filters of different hash families are not supposed to be unioned, got %v", err)
+	}
+}
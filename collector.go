@@ -24,17 +24,23 @@ collectMemtableLoop:
 					db.immutableMemtables = append(db.immutableMemtables, db.frozenMemtables[i])
 					db.frozenMemtables = append(db.frozenMemtables[:i], db.frozenMemtables[i+1:]...)
 					nFrozenMemtabls -= 1
-					db.dumpMemtableChan <- 1
+					// the pending signals already make the workers claim the memtable
+					select {
+					case db.dumpMemtableChan <- 1:
+					default:
+					}
 				} else {
 					i += 1
 				}
 			}
 			db.switchMemtableLock.Unlock()
-
+			db.updateWriteStall()
 		}
 	}
 }
 
+// dumpImmutableTables is the loop of a flush worker, each signal of the dumpMemtableChan makes the worker dump the
+// immutable memtables until all of them are claimed.
 func (db *DrifterDB) dumpImmutableTables() {
 	defer db.closeWait.Done()
 dumpImmutableLoop:
@@ -42,29 +48,13 @@ dumpImmutableLoop:
 		common.Debug("[dump memtable] start dump immutable table loop")
 		select {
 		case _ = <-db.dumpMemtableChan:
-			i := 0
-			tableToDump := db.immutableMemtables[i]
-			common.Debug("[dump memtable] before dump")
-
-			// dump table and update the version and add new table to level 0
-			newTable := db.storage.DumpMemtable(tableToDump, db.tableSeq)
-
-			common.Debug("[dump memtable] dump finish, ready to acquire the lock")
-			start := time.Now()
-
-			db.switchMemtableLock.Lock()
-			newVersion := CopyVersion(db.storage.currentVersion)
-			newVersion.levels[0] = append(newVersion.levels[0], newTable)
-			newVersion.walOffset = db.memtableWalOffsetMap[tableToDump]
-			delete(db.memtableWalOffsetMap, tableToDump)
-			db.storage.SetVersion(newVersion)
-			common.Debug("[dump memtable] offset:", db.memtableWalOffsetMap[tableToDump], newVersion.walOffset)
-			common.Debug("[dump memtable] dump got the lock, cost: ", time.Since(start).Seconds(), "s")
-			db.immutableMemtables = append(db.immutableMemtables[:i], db.immutableMemtables[i + 1:]...)
-
-			// setup every version
-			db.tableSeq += 1
-			db.switchMemtableLock.Unlock()
+			for job := db.claimFlushJob(); job != nil; job = db.claimFlushJob() {
+				common.Debug("[dump memtable] before dump", len(job.memtables), "memtables")
+				// dump table and install the new table to level 0 in the order of the jobs
+				job.run(db.storage)
+				common.Debug("[dump memtable] dump finish, ready to acquire the lock")
+				db.installFlushJob(job)
+			}
 		case _ = <-db.closerChan:
 			break dumpImmutableLoop
 		}
@@ -1,3 +1,11 @@
 package common
 
-
+// CopyBytes returns a copy of the bytes which is not affected once the caller reuses the source bytes.
+func CopyBytes(src []byte) []byte {
+	if src == nil {
+		return nil
+	}
+	dst := make([]byte, len(src))
+	copy(dst, src)
+	return dst
+}
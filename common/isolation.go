@@ -4,4 +4,5 @@ const (
 	ReadUncommitted = 1 << 0
 	ReadCommitted   = 1 << 1
 	RepeatableRead  = 1 << 2
+	Serializable    = 1 << 3
 )
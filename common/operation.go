@@ -12,6 +12,11 @@ const (
 	OpGet        = 1 << 3
 	OpRange      = 1 << 4
 	OpExists     = 1 << 5
+	OpBatch      = 1 << 6
+	// the records of the two-phase commit, OpPrepare is also the key type of their keys
+	OpPrepare          = 1 << 7
+	OpCommitPrepared   = 1 << 8
+	OpRollbackPrepared = 1 << 9
 )
 
 type Operation struct {
@@ -1,6 +1,7 @@
 package drifterdb
 
 import (
+	"context"
 	"fmt"
 	"github.com/LaJunkai/drifterdb/common"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 )
 
 /*
@@ -24,13 +26,26 @@ type BaseDB interface {
 	Get(key []byte) []byte
 	Delete(key []byte) bool
 	Range(s, e []byte, count, offset int) []*Element
-	WithTransaction(target func(trx *Transaction))
+	PrefixRange(prefix []byte, count, offset int) []*Element
+	GetSnapshot() *Snapshot
+	ReleaseSnapshot(snapshot *Snapshot)
+	GetWithOptions(opts *ReadOptions, key []byte) ([]byte, error)
+	RangeWithOptions(opts *ReadOptions, start, end []byte, count, offset int) ([]*Element, error)
+	PrefixRangeWithOptions(opts *ReadOptions, prefix []byte, count, offset int) ([]*Element, error)
+	WithTransaction(target func(trx *Transaction), opts ...*TransactionOptions) error
+	StartTransactionWithOptions(opts *TransactionOptions) *Transaction
 	StartTransaction() *Transaction
+	StartTransactionContext(ctx context.Context) *Transaction
+	WithOptimisticTransaction(target func(trx *Transaction)) error
+	StartOptimisticTransaction() *Transaction
 	MapTransaction(trxId uint32) *Transaction
-	CommitTransaction(trx *Transaction)
-	CommitTransactionByID(trxId uint32)
+	CommitTransaction(trx *Transaction) error
+	CommitTransactionByID(trxId uint32) error
 	RollbackTransaction(trx *Transaction)
 	RollbackTransactionByID(trxId uint32)
+	GetPreparedTransactions() []*Transaction
+	CommitPrepared(name string) error
+	RollbackPrepared(name string) error
 }
 
 type DrifterDB struct {
@@ -39,9 +54,11 @@ type DrifterDB struct {
 	option  *Option
 	storage *Storage
 
-	writeSlowDown bool
-	writePaused   bool
-	initializing  bool
+	// writeSlowDown and writePaused are set by the writeController which guards them.
+	writeSlowDown   bool
+	writePaused     bool
+	writeController *writeController
+	initializing    bool
 
 	//session to be implemented
 	wal       *WALWriter
@@ -58,8 +75,14 @@ type DrifterDB struct {
 	switchMemtableLock   sync.RWMutex
 	dumpMemtableChan     chan int
 	frozeMemtableChan    chan int
-	waitingForFreezing   bool
+	waitingForFreezing   int32
 	memtableWalOffsetMap map[Memtable]uint64
+	// claimedMemtables is the number of the oldest immutable memtables claimed by the flush jobs,
+	// the jobs are installed in the order of their seq. See flush.go.
+	claimedMemtables   int
+	flushJobSeq        uint64
+	installedFlushJobs uint64
+	finishedFlushJobs  map[uint64]*flushJob
 	// transaction
 	IsolationLevel uint8
 	transactionSet *TransactionSet
@@ -74,7 +97,7 @@ func New(path string, option *Option) *DrifterDB {
 
 	current, _ := ioutil.ReadFile(filepath.Join(path, "current"))
 	meta := LoadMeta(path, string(current))
-	walFile, err := os.OpenFile(filepath.Join(path, fmt.Sprintf("wal%08d.log", meta.WalSeq)), os.O_APPEND|os.O_CREATE, 0777)
+	walFile, err := os.OpenFile(filepath.Join(path, fmt.Sprintf("wal%08d.log", meta.WalSeq)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0777)
 	common.Throw(err)
 	walReaderFile, err := os.OpenFile(filepath.Join(path, fmt.Sprintf("wal%08d.log", meta.WalSeq)), os.O_APPEND, 0777)
 	common.Throw(err)
@@ -82,36 +105,53 @@ func New(path string, option *Option) *DrifterDB {
 		option = DefaultOption()
 	}
 	newDB := &DrifterDB{
-		storage:              NewStorage(path, option.Levels),
+		storage:              NewStorage(path, option),
 		meta:                 meta,
-		memtable:             NewSkiplistMemtable(common.TypeMVCCBytes),
 		needCompactionChan:   make(chan int, 16),
 		dumpMemtableChan:     make(chan int, 16),
 		frozeMemtableChan:    make(chan int, 16),
-		closerChan:           make(chan struct{}, 16),
-		waitingForFreezing:   false,
+		closerChan:           make(chan struct{}),
+		waitingForFreezing:   0,
 		wal:                  NewWALWriter(walFile),
 		walReader:            NewWALReader(walReaderFile),
 		option:               option,
 		IsolationLevel:       common.RepeatableRead,
 		memtableWalOffsetMap: make(map[Memtable]uint64),
+		writeController:      newWriteController(),
+		finishedFlushJobs:    make(map[uint64]*flushJob),
+	}
+	newDB.memtable = newDB.newMemtable()
+	if option.WriteBufferManager != nil {
+		option.WriteBufferManager.register(newDB)
 	}
 	// complete storage
 	newDB.storage.InitCurrentVersion(newDB.memtable)
 	//
 	newDB.transactionSet = NewTransactionSet(common.RepeatableRead, newDB)
 	// goroutines
-	// no wait timer
-	go newDB.transactionSet.StartTimer()
 	// need to wait
-	go newDB.FrozeMemtableLoop()   // 1
-	go newDB.collectMemtable()     // 2
-	go newDB.dumpImmutableTables() // 3
-	go newDB.CompactLoop()         // 4
+	go newDB.FrozeMemtableLoop() // 1
+	go newDB.collectMemtable()   // 2
+	go newDB.CompactLoop()       // 3
+	go newDB.ReapLoop()          // 4
 	newDB.closeWait.Add(4)
+	// flush workers
+	flushes := option.MaxBackgroundFlushes
+	if flushes < 1 {
+		flushes = 1
+	}
+	for i := 0; i < flushes; i++ {
+		go newDB.dumpImmutableTables()
+	}
+	newDB.closeWait.Add(flushes)
 	//
 	// set WAL file init offset
 	_, err = walReaderFile.Seek(int64(newDB.storage.currentVersion.walOffset), 0)
+	common.Throw(err)
+	// the records are appended to the end of the WAL file
+	walInfo, err := walFile.Stat()
+	common.Throw(err)
+	newDB.wal.SetOffset(uint64(walInfo.Size()))
 	// recover the tableSeq of the db
 	newDB.tableSeq = MaxSeqInVersion(newDB.storage.currentVersion) + 1
 	common.Throw(err)
@@ -123,27 +163,68 @@ func OpenDB(path string) *DrifterDB {
 	defer func() {
 		db.initializing = false
 	}()
-	db.wal.SetOffset(db.storage.currentVersion.walOffset)
 	common.Always("[recover from WAL] recovering memtable from the WAL (offset:", db.storage.currentVersion.walOffset, ").")
+	// the records are replayed after the prepared transactions are resolved
+	records := make([]*common.Operation, 0, 64)
 	for o := db.walReader.Next(); o != nil; o = db.walReader.Next() {
+		records = append(records, o)
+	}
+	prepared, committed, skipped := resolvePrepared(records)
+	for _, o := range records {
 		if o.KeyType() == common.OpPut {
 			mvccKey := o.Key().(*common.MVCCKey)
 			if db.seq < mvccKey.Seq {
 				db.seq = mvccKey.Seq
 			}
+			if skipped[mvccKey.Seq] {
+				continue
+			}
 			db.put(mvccKey, o.ValueBytes())
+		} else if o.KeyType() == common.OpBatch {
+			// all the records of the batch share the seq of the batch
+			batchKey := o.Key().(*common.MVCCKey)
+			if db.seq < batchKey.Seq {
+				db.seq = batchKey.Seq
+			}
+			for _, op := range decodeWriteBatch(o.ValueBytes()).ops {
+				db.put(common.MakeMVCCKey(op.key, batchKey.Seq, op.kt, 0), op.value)
+			}
+		}
+	}
+	for _, op := range committed {
+		if db.seq < op.seq {
+			db.seq = op.seq
 		}
+		db.put(common.MakeMVCCKey(op.key, op.seq, op.kt, 0), op.value)
+	}
+	for _, o := range prepared {
+		name := string(o.Key().(*common.MVCCKey).Content)
+		db.transactionSet.recoverPrepared(name, decodePrepared(o.ValueBytes()))
 	}
 	return db
 }
 
 func (db *DrifterDB) getSeq() uint64 {
-	//return atomic.AddUint64(&db.seq, 1)
-	db.seq += 1
-	return db.seq
+	return atomic.AddUint64(&db.seq, 1)
+}
+
+// newMemtable creates an active memtable by the MemtableFactory of the option, or of the type chosen by the option.
+func (db *DrifterDB) newMemtable() Memtable {
+	if db.option.MemtableFactory != nil {
+		return db.option.MemtableFactory()
+	}
+	if db.option.LockFreeMemtable {
+		return NewLockFreeMemtable(common.TypeMVCCBytes)
+	}
+	return NewSkiplistMemtable(common.TypeMVCCBytes)
 }
 
 func (db *DrifterDB) put(key *common.MVCCKey, value []byte) (*Element, bool) {
+	if m := db.option.WriteBufferManager; m != nil {
+		defer func() {
+			m.reserveActive(db, db.memtable.BytesSize())
+		}()
+	}
 	// no log writing during initializing
 	if db.initializing {
 		_, length := db.wal.Op2Log(common.OperationRecord(common.OpPut, key, value))
@@ -170,10 +251,13 @@ func (db *DrifterDB) put(key *common.MVCCKey, value []byte) (*Element, bool) {
 }
 
 func (db *DrifterDB) Put(key, value []byte) bool {
-	db.WithTransaction(func(trx *Transaction) {
-		trx.Put(key, value)
+	var err error
+	commitErr := db.WithTransaction(func(trx *Transaction) {
+		if err = trx.Put(key, value); err != nil {
+			trx.SetRollback()
+		}
 	})
-	return true
+	return err == nil && commitErr == nil
 }
 
 func (db *DrifterDB) Get(key []byte) (v []byte) {
@@ -221,8 +305,8 @@ func (db *DrifterDB) AtomicAdd(key []byte, delta int64) {
 
 // FrozeMemtable will froze current alive memtable to immutable memtable, and then flush im-table to the disk
 func (db *DrifterDB) FrozeMemtable() {
-	if !db.waitingForFreezing {
-		db.waitingForFreezing = true
+	// the writers of a LockFreeMemtable call it concurrently
+	if atomic.CompareAndSwapInt32(&db.waitingForFreezing, 0, 1) {
 		db.frozeMemtableChan <- 1
 	}
 }
@@ -234,14 +318,23 @@ freezeLoop:
 	for {
 		select {
 		case _ = <-db.frozeMemtableChan:
-			newMemtable := NewSkiplistMemtable(common.TypeMVCCBytes)
+			newMemtable := db.newMemtable()
 			db.switchMemtableLock.Lock()
 			common.Debug("[Froze memtable]", "frozen memtables:", len(db.frozenMemtables), ",immutable memtables:", len(db.immutableMemtables))
 			db.frozenMemtables = append(db.frozenMemtables, db.memtable)
+			// the memtables which reorganize the records once they are frozen, such as the VectorMemtable
+			if freezer, ok := db.memtable.(interface{ Freeze() }); ok {
+				freezer.Freeze()
+			}
 			db.memtableWalOffsetMap[db.memtable] = db.wal.cursor
 			db.memtable = newMemtable
-			db.waitingForFreezing = false
+			atomic.StoreInt32(&db.waitingForFreezing, 0)
+			// the writes into the new memtable are reserved after the frozen one is no longer active
+			if db.option.WriteBufferManager != nil {
+				db.option.WriteBufferManager.frozen(db)
+			}
 			db.switchMemtableLock.Unlock()
+			db.updateWriteStall()
 		case _ = <-db.closerChan:
 			break freezeLoop
 		}
@@ -268,19 +361,28 @@ compactLoop:
 }
 
 func (db *DrifterDB) Close() {
-	for i := 0; i < 16; i++ {
-		db.closerChan <- struct{}{}
-	}
+	// every loop receives from the closed channel
+	close(db.closerChan)
 	db.closeWait.Wait()
+	if db.option.WriteBufferManager != nil {
+		db.option.WriteBufferManager.unregister(db)
+	}
 }
 
-func (db *DrifterDB) WithTransaction(target func(trx *Transaction)) {
-	theTrx := db.transactionSet.GetTransaction()
+// WithTransaction run the target in a new transaction, the error of the commit is returned.
+// The transaction is controlled by the first options if any.
+func (db *DrifterDB) WithTransaction(target func(trx *Transaction), opts ...*TransactionOptions) error {
+	var opt *TransactionOptions = nil
+	if len(opts) != 0 {
+		opt = opts[0]
+	}
+	theTrx := db.transactionSet.GetTransactionWithOptions(context.Background(), opt)
 	target(theTrx)
 	if theTrx.needRollback {
 		db.transactionSet.RollbackTransaction(theTrx)
+		return nil
 	} else {
-		db.transactionSet.CommitTransaction(theTrx)
+		return db.transactionSet.CommitTransaction(theTrx)
 	}
 }
 
@@ -288,16 +390,44 @@ func (db *DrifterDB) StartTransaction() *Transaction {
 	return db.transactionSet.GetTransaction()
 }
 
+// WithOptimisticTransaction run the target in a new optimistic transaction,
+// ErrTransactionConflict is returned if the commit fails the validation.
+func (db *DrifterDB) WithOptimisticTransaction(target func(trx *Transaction)) error {
+	theTrx := db.transactionSet.GetOptimisticTransaction()
+	target(theTrx)
+	if theTrx.needRollback {
+		db.transactionSet.RollbackTransaction(theTrx)
+		return nil
+	} else {
+		return db.transactionSet.CommitTransaction(theTrx)
+	}
+}
+
+// StartTransactionWithOptions start a transaction controlled by the options.
+func (db *DrifterDB) StartTransactionWithOptions(opts *TransactionOptions) *Transaction {
+	return db.transactionSet.GetTransactionWithOptions(context.Background(), opts)
+}
+
+// StartTransactionContext start a transaction which expires once the ctx is done, the deadline of the ctx
+// is the deadline of the transaction if it is earlier than the transaction timeout.
+func (db *DrifterDB) StartTransactionContext(ctx context.Context) *Transaction {
+	return db.transactionSet.GetTransactionContext(ctx)
+}
+
+func (db *DrifterDB) StartOptimisticTransaction() *Transaction {
+	return db.transactionSet.GetOptimisticTransaction()
+}
+
 func (db *DrifterDB) MapTransaction(trxId uint32) *Transaction {
 	return db.transactionSet.MapTransaction(trxId)
 }
 
-func (db *DrifterDB) CommitTransaction(trx *Transaction) {
-	db.transactionSet.CommitTransaction(trx)
+func (db *DrifterDB) CommitTransaction(trx *Transaction) error {
+	return db.transactionSet.CommitTransaction(trx)
 }
 
-func (db *DrifterDB) CommitTransactionByID(trxId uint32) {
-	db.transactionSet.RollbackTransactionByID(trxId)
+func (db *DrifterDB) CommitTransactionByID(trxId uint32) error {
+	return db.transactionSet.CommitTransactionByID(trxId)
 }
 
 func (db *DrifterDB) RollbackTransaction(trx *Transaction) {
@@ -305,12 +435,19 @@ func (db *DrifterDB) RollbackTransaction(trx *Transaction) {
 }
 
 func (db *DrifterDB) RollbackTransactionByID(trxId uint32) {
-	db.transactionSet.CommitTransactionByID(trxId)
+	db.transactionSet.RollbackTransactionByID(trxId)
+}
+
+// GetDeadlockReports returns the recent deadlocks detected among the pessimistic transactions.
+func (db *DrifterDB) GetDeadlockReports() []*DeadlockReport {
+	return db.transactionSet.locks.graph.Reports()
 }
 
+// SetIsolationLevel sets the default isolation level of the new transactions, use TransactionOptions to set
+// the isolation level of a single transaction.
 func (db *DrifterDB) SetIsolationLevel(level uint8) {
 	db.IsolationLevel = level
-	db.transactionSet.IsolationLevel = level
+	db.transactionSet.SetIsolationLevel(level)
 }
 
 func (db *DrifterDB) PreviewAllMemtables() {
@@ -0,0 +1,137 @@
+package drifterdb
+
+import (
+	"sync"
+	"time"
+)
+
+// DeadlockReportCapacity is the number of the recent deadlock reports kept for debugging.
+const DeadlockReportCapacity = 32
+
+type DeadlockWaiter struct {
+	TrxId uint32
+	// Key is the key the transaction is waiting for
+	Key []byte
+}
+
+// DeadlockReport describes a cycle of the wait-for graph, Waiters[i] waits for the lock held by Waiters[i+1]
+// and the last one waits for Waiters[0]. The Victim is rolled back with ErrDeadlock.
+type DeadlockReport struct {
+	Time    time.Time
+	Waiters []DeadlockWaiter
+	Victim  uint32
+}
+
+// waitingEntry describes a blocking wait of a transaction, owners returns the transactions it waits for
+// (nil if it stops waiting) and abort wakes it up with ErrDeadlock and reports whether it was still waiting.
+type waitingEntry struct {
+	key    []byte
+	owners func() []uint32
+	abort  func() bool
+}
+
+// waitForGraph tracks the transactions waiting for the row locks and the range locks.
+// The lock of the graph is always acquired before the locks of the LockManager.
+type waitForGraph struct {
+	lock    sync.Mutex
+	waiting map[uint32]*waitingEntry
+	reports []*DeadlockReport
+	next    int
+}
+
+func newWaitForGraph() *waitForGraph {
+	return &waitForGraph{
+		waiting: make(map[uint32]*waitingEntry),
+		reports: make([]*DeadlockReport, 0, DeadlockReportCapacity),
+	}
+}
+
+// Wait adds the edges of the waiting transaction and breaks the cycles through it by aborting the youngest transaction
+// of each cycle, ErrDeadlock is returned if the waiting transaction itself is chosen as the victim.
+func (g *waitForGraph) Wait(trxId uint32, e *waitingEntry) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.waiting[trxId] = e
+	for {
+		cycle := g.findCycle(trxId)
+		if cycle == nil {
+			return nil
+		}
+		victim := cycle[0].TrxId
+		for _, w := range cycle {
+			if w.TrxId > victim {
+				victim = w.TrxId
+			}
+		}
+		g.report(&DeadlockReport{Time: time.Now(), Waiters: cycle, Victim: victim})
+		if g.abort(victim) && victim == trxId {
+			return ErrDeadlock
+		}
+	}
+}
+
+// Done removes the edges of the transaction which stops waiting.
+func (g *waitForGraph) Done(trxId uint32) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	delete(g.waiting, trxId)
+}
+
+// findCycle returns the cycle through the transaction, nil is returned if there is no such cycle.
+func (g *waitForGraph) findCycle(trxId uint32) []DeadlockWaiter {
+	visited := make(map[uint32]bool)
+	path := make([]DeadlockWaiter, 0)
+	var search func(current uint32) bool
+	search = func(current uint32) bool {
+		e, ok := g.waiting[current]
+		if !ok || visited[current] {
+			return false
+		}
+		visited[current] = true
+		path = append(path, DeadlockWaiter{TrxId: current, Key: e.key})
+		for _, owner := range e.owners() {
+			if owner == trxId || search(owner) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if search(trxId) {
+		return path
+	}
+	return nil
+}
+
+// abort wakes up the victim with ErrDeadlock and reports whether it is still waiting before.
+func (g *waitForGraph) abort(victim uint32) bool {
+	e, ok := g.waiting[victim]
+	if !ok {
+		return false
+	}
+	delete(g.waiting, victim)
+	return e.abort()
+}
+
+func (g *waitForGraph) report(r *DeadlockReport) {
+	if len(g.reports) < DeadlockReportCapacity {
+		g.reports = append(g.reports, r)
+	} else {
+		g.reports[g.next] = r
+	}
+	g.next = (g.next + 1) % DeadlockReportCapacity
+}
+
+// Reports returns the recent deadlock reports from the oldest to the newest.
+func (g *waitForGraph) Reports() []*DeadlockReport {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	result := make([]*DeadlockReport, 0, len(g.reports))
+	if len(g.reports) == DeadlockReportCapacity {
+		result = append(result, g.reports[g.next:]...)
+		result = append(result, g.reports[:g.next]...)
+	} else {
+		result = append(result, g.reports...)
+	}
+	return result
+}
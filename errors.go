@@ -0,0 +1,43 @@
+package drifterdb
+
+import "errors"
+
+var (
+	// ErrSerializationFailure is returned by the commit of a serializable transaction
+	// which may break the serializability, the transaction is rolled back and is supposed to be retried.
+	ErrSerializationFailure = errors.New("drifterdb: could not serialize access due to read/write dependencies among transactions")
+	// ErrTransactionConflict is returned by the commit of an optimistic transaction if any key it read
+	// was modified after its snapshot, the transaction is rolled back and is supposed to be retried.
+	ErrTransactionConflict = errors.New("drifterdb: transaction conflict, keys read by the transaction were modified after its snapshot")
+	// ErrLockTimeout is returned by the write of a transaction which fails to acquire the row lock in time.
+	ErrLockTimeout = errors.New("drifterdb: timeout waiting for the row lock")
+	// ErrDeadlock is returned by the write of the transaction chosen as the victim of a deadlock,
+	// the transaction is supposed to be rolled back and retried.
+	ErrDeadlock = errors.New("drifterdb: deadlock detected")
+	// ErrNoSavepoint is returned by RollbackToSavepoint and PopSavepoint if no savepoint is set.
+	ErrNoSavepoint = errors.New("drifterdb: no savepoint is set in the transaction")
+	// ErrReadOnlyTransaction is returned by the writes and the locks of a read-only transaction.
+	ErrReadOnlyTransaction = errors.New("drifterdb: the transaction is read-only")
+	// ErrWriteSetTooLarge is returned by the write which exceeds the max write set size of the transaction.
+	ErrWriteSetTooLarge = errors.New("drifterdb: the write set of the transaction exceeds the max size")
+	// ErrSnapshotReleased is returned by the reads with a snapshot which is already released.
+	ErrSnapshotReleased = errors.New("drifterdb: the snapshot is released")
+	// ErrTxnExpired is returned to the owner of a transaction which is rolled back since its deadline is exceeded
+	// or its ctx is canceled.
+	ErrTxnExpired = errors.New("drifterdb: the transaction is expired and rolled back")
+	// ErrWriteStall is returned by the write which is stalled until the ctx of its transaction is done,
+	// the transaction is not rolled back by the stall.
+	ErrWriteStall = errors.New("drifterdb: the write is stalled until the transaction is done")
+	// ErrTransactionPrepared is returned by the writes, the locks and the second Prepare of a prepared transaction.
+	ErrTransactionPrepared = errors.New("drifterdb: the transaction is prepared")
+	// ErrTransactionFinished is returned by the calls on a transaction which is committed or rolled back.
+	ErrTransactionFinished = errors.New("drifterdb: the transaction is committed or rolled back")
+	// ErrTransactionBusy is returned by the call on a transaction which is in the middle of another call.
+	ErrTransactionBusy = errors.New("drifterdb: the transaction is used by another call")
+	// ErrPrepareOptimistic is returned by the Prepare of an optimistic transaction.
+	ErrPrepareOptimistic = errors.New("drifterdb: the optimistic transaction can not be prepared")
+	// ErrDuplicatePreparedName is returned by the Prepare with the name of another prepared transaction.
+	ErrDuplicatePreparedName = errors.New("drifterdb: the name is used by another prepared transaction")
+	// ErrPreparedNotFound is returned by the commit and the rollback of a prepared transaction which does not exist.
+	ErrPreparedNotFound = errors.New("drifterdb: the prepared transaction is not found")
+)
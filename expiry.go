@@ -0,0 +1,114 @@
+package drifterdb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultTransactionTimeout is the default max lifetime of a transaction.
+	DefaultTransactionTimeout = TransactionTimeout * time.Second
+	// ReapInterval is the interval the reaper checks the open transactions for the expired ones.
+	ReapInterval = 100 * time.Millisecond
+)
+
+// the states of a transaction, the reaper only rolls back the active transactions, so a transaction is never
+// rolled back in the middle of a call of its owner, and the prepared transactions are left to their coordinators.
+const (
+	trxActive int32 = iota
+	trxBusy
+	trxPrepared
+	trxExpired
+	trxFinished
+)
+
+// Deadline returns the time the transaction expires, false is returned if it never expires by the time.
+func (trx *Transaction) Deadline() (time.Time, bool) {
+	return trx.ctx.Deadline()
+}
+
+// Expired returns whether the transaction is rolled back by the expiry.
+func (trx *Transaction) Expired() bool {
+	return atomic.LoadInt32(&trx.state) == trxExpired
+}
+
+// enter marks the transaction busy during a call of the owner, the transaction whose ctx is done is rolled back
+// and ErrTxnExpired is returned. The calls on a transaction which is not active fail with the error of its state.
+// leave is supposed to be deferred if enter succeeds.
+func (trx *Transaction) enter() error {
+	if trx.ctx.Err() != nil {
+		trx.db.transactionSet.expire(trx)
+	}
+	if atomic.CompareAndSwapInt32(&trx.state, trxActive, trxBusy) {
+		return nil
+	}
+	return trx.stateError()
+}
+
+// stateError returns the error of the state of the transaction which is not active.
+func (trx *Transaction) stateError() error {
+	switch atomic.LoadInt32(&trx.state) {
+	case trxExpired:
+		return ErrTxnExpired
+	case trxPrepared:
+		return ErrTransactionPrepared
+	case trxFinished:
+		return ErrTransactionFinished
+	default:
+		return ErrTransactionBusy
+	}
+}
+
+func (trx *Transaction) leave() {
+	atomic.CompareAndSwapInt32(&trx.state, trxBusy, trxActive)
+}
+
+// finish marks the active transaction finished before it is committed or rolled back by the owner, the error of
+// the state is returned otherwise, such as ErrTxnExpired if it is already rolled back by the expiry.
+// The prepared transactions are finished by their names.
+func (trx *Transaction) finish() error {
+	if trx.ctx.Err() != nil {
+		trx.db.transactionSet.expire(trx)
+	}
+	if atomic.CompareAndSwapInt32(&trx.state, trxActive, trxFinished) {
+		return nil
+	}
+	return trx.stateError()
+}
+
+// expire rolls back the active transaction whose ctx is done, false is returned if the transaction is busy,
+// prepared or finished.
+func (ts *TransactionSet) expire(trx *Transaction) bool {
+	if !atomic.CompareAndSwapInt32(&trx.state, trxActive, trxExpired) {
+		return false
+	}
+	ts.rollbackTransaction(trx)
+	return true
+}
+
+// reap rolls back the open transactions which are expired or whose ctx are canceled.
+func (ts *TransactionSet) reap() {
+	ts.Transactions.Range(func(key, value interface{}) bool {
+		trx := value.(*Transaction)
+		if trx.ctx.Err() != nil {
+			ts.expire(trx)
+		}
+		return true
+	})
+}
+
+// ReapLoop is supposed to run in a goroutine, and roll back the abandoned transactions periodically.
+func (db *DrifterDB) ReapLoop() {
+	defer db.closeWait.Done()
+	ticker := time.NewTicker(ReapInterval)
+	defer ticker.Stop()
+reapLoop:
+	for {
+		select {
+		case <-ticker.C:
+			db.transactionSet.reap()
+		case _ = <-db.closerChan:
+			break reapLoop
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package drifterdb
+
+import (
+	"context"
+	"github.com/LaJunkai/drifterdb/common"
+	"testing"
+	"time"
+)
+
+func TestTransaction_Expire(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	opts := NewTransactionOptions(common.ReadCommitted)
+	opts.Timeout = 20 * time.Millisecond
+	trx := db.StartTransactionWithOptions(opts)
+	if err := trx.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("the put is supposed to succeed, got %v", err)
+	}
+	time.Sleep(20*time.Millisecond + 2*ReapInterval)
+	if !trx.Expired() {
+		t.Fatalf("the abandoned transaction is supposed to be rolled back by the reaper")
+	}
+	// the lock of the expired transaction is released
+	other := db.StartTransaction()
+	other.SetLockTimeout(10 * time.Millisecond)
+	if err := other.Put([]byte("k"), []byte("other")); err != nil {
+		t.Errorf("the lock of the expired transaction is supposed to be released, got %v", err)
+	}
+	db.RollbackTransaction(other)
+	if err := trx.Put([]byte("k2"), []byte("v")); err != ErrTxnExpired {
+		t.Errorf("the put is supposed to fail with ErrTxnExpired, got %v", err)
+	}
+	if err := db.CommitTransaction(trx); err != ErrTxnExpired {
+		t.Errorf("the commit is supposed to fail with ErrTxnExpired, got %v", err)
+	}
+	if v := db.Get([]byte("k")); v != nil {
+		t.Errorf("the write of the expired transaction is supposed to be undone, got %s", v)
+	}
+}
+
+func TestTransaction_ExpireOnCancel(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	trx := db.StartTransactionContext(ctx)
+	trx.Put([]byte("k"), []byte("v"))
+	cancel()
+	if err := trx.Put([]byte("k"), []byte("v2")); err != ErrTxnExpired {
+		t.Errorf("the put after the cancel is supposed to fail with ErrTxnExpired, got %v", err)
+	}
+	if v := db.Get([]byte("k")); v != nil {
+		t.Errorf("the write of the canceled transaction is supposed to be undone, got %s", v)
+	}
+}
+
+func TestTransaction_PreparedNotExpired(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	opts := NewTransactionOptions(common.ReadCommitted)
+	opts.Timeout = 10 * time.Millisecond
+	trx := db.StartTransactionWithOptions(opts)
+	trx.Put([]byte("k"), []byte("v"))
+	if err := trx.Prepare("xid"); err != nil {
+		t.Fatalf("the prepare is supposed to succeed, got %v", err)
+	}
+	time.Sleep(10*time.Millisecond + 2*ReapInterval)
+	if trx.Expired() {
+		t.Fatalf("the prepared transaction is supposed to be left to the coordinator")
+	}
+	if err := db.CommitPrepared("xid"); err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	if v := db.Get([]byte("k")); string(v) != "v" {
+		t.Errorf("the write of the prepared transaction is supposed to be committed, got %s", v)
+	}
+}
+
+func TestTransaction_EnterInactive(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	committed := db.StartTransaction()
+	db.CommitTransaction(committed)
+	if err := committed.Put([]byte("k"), []byte("v")); err != ErrTransactionFinished {
+		t.Errorf("the put after the commit is supposed to fail with ErrTransactionFinished, got %v", err)
+	}
+	prepared := db.StartTransaction()
+	prepared.Put([]byte("k"), []byte("v"))
+	if err := prepared.Prepare("xid"); err != nil {
+		t.Fatalf("the prepare is supposed to succeed, got %v", err)
+	}
+	if err := prepared.enter(); err != ErrTransactionPrepared {
+		t.Errorf("the call on the prepared transaction is supposed to fail with ErrTransactionPrepared, got %v", err)
+	}
+	db.RollbackPrepared("xid")
+	busy := db.StartTransaction()
+	if err := busy.enter(); err != nil {
+		t.Fatalf("the call on the active transaction is supposed to succeed, got %v", err)
+	}
+	if err := busy.enter(); err != ErrTransactionBusy {
+		t.Errorf("the call in the middle of another call is supposed to fail with ErrTransactionBusy, got %v", err)
+	}
+	busy.leave()
+	db.RollbackTransaction(busy)
+}
+
+func TestTransaction_FinishOnce(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	trx := db.StartTransaction()
+	trx.Put([]byte("a"), []byte("1"))
+	if err := db.CommitTransaction(trx); err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	if err := db.CommitTransaction(trx); err != ErrTransactionFinished {
+		t.Errorf("the second commit is supposed to fail with ErrTransactionFinished, got %v", err)
+	}
+	db.RollbackTransaction(trx)
+	if v := db.Get([]byte("a")); string(v) != "1" {
+		t.Errorf("the rollback after the commit is not supposed to undo the writes, got %s", v)
+	}
+	rolledBack := db.StartTransaction()
+	rolledBack.Put([]byte("b"), []byte("1"))
+	db.RollbackTransaction(rolledBack)
+	if err := db.CommitTransaction(rolledBack); err != ErrTransactionFinished {
+		t.Errorf("the commit after the rollback is supposed to fail with ErrTransactionFinished, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package drifterdb
+
+import (
+	"fmt"
+	"github.com/LaJunkai/drifterdb/bloomfilter"
+)
+
+const DefaultBloomBitsPerKey = 10
+
+// FilterPolicy builds the filter block of the tables from the user keys (the content of the MVCC keys).
+// The filter bytes carry their own format tag, so that the tables can be read regardless of the policy in the option.
+type FilterPolicy interface {
+	Name() string
+	CreateFilter(keys [][]byte) []byte
+}
+
+type BloomFilterPolicy struct {
+	bitsPerKey int
+}
+
+func NewBloomFilterPolicy(bitsPerKey int) *BloomFilterPolicy {
+	if bitsPerKey <= 0 {
+		bitsPerKey = DefaultBloomBitsPerKey
+	}
+	return &BloomFilterPolicy{bitsPerKey: bitsPerKey}
+}
+
+func (p *BloomFilterPolicy) Name() string {
+	return fmt.Sprintf("bloomfilter.v3(%d)", p.bitsPerKey)
+}
+
+func (p *BloomFilterPolicy) CreateFilter(keys [][]byte) []byte {
+	filter := bloomfilter.NewFilterWithBitsPerKey(len(keys), p.bitsPerKey)
+	for _, key := range keys {
+		filter.Add(key)
+	}
+	return filter.DumpBytes()
+}
+
+// BlockedBloomFilterPolicy builds the blocked bloom filters whose probes of a key fall in one cache line, which makes
+// the point lookups faster than the standard bloom filters at the cost of a little higher false positive rate.
+type BlockedBloomFilterPolicy struct {
+	bitsPerKey int
+}
+
+func NewBlockedBloomFilterPolicy(bitsPerKey int) *BlockedBloomFilterPolicy {
+	if bitsPerKey <= 0 {
+		bitsPerKey = DefaultBloomBitsPerKey
+	}
+	return &BlockedBloomFilterPolicy{bitsPerKey: bitsPerKey}
+}
+
+func (p *BlockedBloomFilterPolicy) Name() string {
+	return fmt.Sprintf("blockedbloom(%d)", p.bitsPerKey)
+}
+
+func (p *BlockedBloomFilterPolicy) CreateFilter(keys [][]byte) []byte {
+	filter := bloomfilter.NewBlockedFilterWithBitsPerKey(len(keys), p.bitsPerKey)
+	for _, key := range keys {
+		filter.Add(key)
+	}
+	return filter.DumpBytes()
+}
+
+// XorFilterPolicy builds the binary fuse filters, which take about 9 bits per key with the false positive rate of 1/256.
+type XorFilterPolicy struct{}
+
+func NewXorFilterPolicy() *XorFilterPolicy {
+	return &XorFilterPolicy{}
+}
+
+func (p *XorFilterPolicy) Name() string {
+	return "binaryfuse8"
+}
+
+func (p *XorFilterPolicy) CreateFilter(keys [][]byte) []byte {
+	return bloomfilter.NewBinaryFuseFilter(keys).DumpBytes()
+}
+
+// RibbonFilterPolicy builds the ribbon filters, which take about 8.5 bits per key with the false positive rate of 1/256.
+type RibbonFilterPolicy struct{}
+
+func NewRibbonFilterPolicy() *RibbonFilterPolicy {
+	return &RibbonFilterPolicy{}
+}
+
+func (p *RibbonFilterPolicy) Name() string {
+	return "ribbon64.r8"
+}
+
+func (p *RibbonFilterPolicy) CreateFilter(keys [][]byte) []byte {
+	return bloomfilter.NewRibbonFilter(keys).DumpBytes()
+}
+
+// loadTableFilter parse the filter bytes, filters of the legacy format are ignored
+// since the legacy tables added the whole MVCC keys into the filter.
+func loadTableFilter(filterBytes []byte) bloomfilter.Filter {
+	if len(filterBytes) == 0 || bloomfilter.IsLegacyFormat(filterBytes) {
+		return nil
+	}
+	return bloomfilter.Load(filterBytes)
+}
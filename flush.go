@@ -0,0 +1,107 @@
+package drifterdb
+
+import (
+	"github.com/LaJunkai/drifterdb/common"
+	"time"
+)
+
+/*
+Parallel Flush
+The immutable memtables are dumped by MaxBackgroundFlushes workers. A worker claims the oldest unclaimed memtables as
+a flush job, the small memtables claimed together are merged into one level-0 table. The jobs are numbered in the
+order they are claimed and installed into the level 0 in the same order whichever finishes first, so the newer tables
+always follow the older ones and the WAL offset of the version only moves forward.
+*/
+
+const (
+	DefaultMaxBackgroundFlushes = 2
+)
+
+type flushJob struct {
+	seq       uint64
+	tableSeq  int
+	memtables []Memtable
+	table     *Table
+}
+
+// claimFlushJob claims the oldest unclaimed immutable memtables whose total bytes size is within the MemtableSize,
+// at least one memtable is claimed if any. It returns nil if all the immutable memtables are claimed.
+func (db *DrifterDB) claimFlushJob() *flushJob {
+	db.switchMemtableLock.Lock()
+	defer db.switchMemtableLock.Unlock()
+	unclaimed := db.immutableMemtables[db.claimedMemtables:]
+	if len(unclaimed) == 0 {
+		return nil
+	}
+	n, size := 1, unclaimed[0].BytesSize()
+	for ; n < len(unclaimed) && size+unclaimed[n].BytesSize() <= db.option.MemtableSize; n++ {
+		size += unclaimed[n].BytesSize()
+	}
+	job := &flushJob{
+		seq:       db.flushJobSeq,
+		tableSeq:  db.tableSeq,
+		memtables: append([]Memtable(nil), unclaimed[:n]...),
+	}
+	db.claimedMemtables += n
+	db.flushJobSeq += 1
+	db.tableSeq += 1
+	return job
+}
+
+// run dumps the memtables of the job into one table.
+func (job *flushJob) run(storage *Storage) {
+	if len(job.memtables) == 1 {
+		job.table = storage.DumpMemtable(job.memtables[0], job.tableSeq, 0)
+		return
+	}
+	merged := NewVectorMemtable(common.TypeMVCCBytes)
+	for _, memtable := range job.memtables {
+		for i := memtable.Iterator(); i.HasNext(); {
+			e := i.Next()
+			merged.Put(e.Key(), e.Value())
+		}
+	}
+	merged.Freeze()
+	job.table = storage.DumpMemtable(merged, job.tableSeq, 0)
+}
+
+// installFlushJob installs the finished job and the finished jobs following it if the jobs claimed before are all
+// installed, otherwise the job is left to the worker installing the last job before it.
+func (db *DrifterDB) installFlushJob(job *flushJob) {
+	start := time.Now()
+	db.switchMemtableLock.Lock()
+	db.finishedFlushJobs[job.seq] = job
+	installed := make([]*flushJob, 0, 1)
+	for next, ok := db.finishedFlushJobs[db.installedFlushJobs]; ok; next, ok = db.finishedFlushJobs[db.installedFlushJobs] {
+		delete(db.finishedFlushJobs, db.installedFlushJobs)
+		newVersion := CopyVersion(db.storage.currentVersion)
+		newVersion.levels[0] = append(newVersion.levels[0], next.table)
+		// the WAL offset of the newest memtable covers the older ones
+		newVersion.walOffset = db.memtableWalOffsetMap[next.memtables[len(next.memtables)-1]]
+		// the OpPrepare records of the unresolved prepared transactions are kept for the recovery
+		if offset, ok := db.transactionSet.oldestPreparedOffset(); ok && offset < newVersion.walOffset {
+			newVersion.walOffset = offset
+		}
+		for _, memtable := range next.memtables {
+			delete(db.memtableWalOffsetMap, memtable)
+		}
+		db.storage.SetVersion(newVersion)
+		// the memtables of the installed jobs are always the oldest immutable memtables
+		db.immutableMemtables = append(db.immutableMemtables[:0], db.immutableMemtables[len(next.memtables):]...)
+		db.claimedMemtables -= len(next.memtables)
+		db.installedFlushJobs += 1
+		installed = append(installed, next)
+	}
+	db.switchMemtableLock.Unlock()
+	common.Debug("[dump memtable] installed", len(installed), "tables, cost: ", time.Since(start).Seconds(), "s")
+	if db.option.WriteBufferManager != nil {
+		for _, job := range installed {
+			for _, memtable := range job.memtables {
+				db.option.WriteBufferManager.free(db, memtable.BytesSize())
+			}
+		}
+	}
+	if len(installed) != 0 {
+		db.updateWriteStall()
+	}
+}
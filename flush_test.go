@@ -0,0 +1,71 @@
+package drifterdb
+
+import (
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"testing"
+)
+
+// addImmutableMemtables adds the memtables of n records each as if they are collected.
+func addImmutableMemtables(db *DrifterDB, count, n int) {
+	db.switchMemtableLock.Lock()
+	defer db.switchMemtableLock.Unlock()
+	for i := 0; i < count; i++ {
+		memtable := NewSkiplistMemtable(common.TypeMVCCBytes)
+		for j := 0; j < n; j++ {
+			key := common.MakeMVCCKey([]byte(fmt.Sprintf("key%03d", j)), uint64(i*n+j+1), common.OpPut, 0)
+			memtable.Put(key, []byte(fmt.Sprintf("value%d", i)))
+			memtable.IncreaseBytesSize(32)
+		}
+		db.immutableMemtables = append(db.immutableMemtables, memtable)
+		db.memtableWalOffsetMap[memtable] = uint64(100 * (i + 1))
+	}
+}
+
+func TestFlushJob_Merge(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	addImmutableMemtables(db, 3, 10)
+	job := db.claimFlushJob()
+	if job == nil || len(job.memtables) != 3 {
+		t.Fatalf("the small memtables are supposed to be flushed together, got %v", job)
+	}
+	if db.claimFlushJob() != nil {
+		t.Errorf("the claimed memtables are not supposed to be claimed again")
+	}
+	job.run(db.storage)
+	db.installFlushJob(job)
+	level0 := db.storage.currentVersion.levels[0]
+	if len(level0) != 1 || level0[0].Properties().NumEntries != 30 {
+		t.Fatalf("the memtables are supposed to be dumped into one table of 30 records, got %v", level0)
+	}
+	if len(db.immutableMemtables) != 0 || db.storage.currentVersion.walOffset != 300 {
+		t.Errorf("the WAL offset of the newest memtable is supposed to be installed, got %v", db.storage.currentVersion.walOffset)
+	}
+}
+
+func TestFlushJob_InstallInOrder(t *testing.T) {
+	option := DefaultOption()
+	option.MemtableSize = 1
+	db := New(t.TempDir(), option)
+	defer db.Close()
+	addImmutableMemtables(db, 2, 10)
+	older, newer := db.claimFlushJob(), db.claimFlushJob()
+	if older == nil || newer == nil || len(older.memtables) != 1 || older.tableSeq >= newer.tableSeq {
+		t.Fatalf("the memtables are supposed to be claimed by two jobs in order")
+	}
+	older.run(db.storage)
+	newer.run(db.storage)
+	db.installFlushJob(newer)
+	if len(db.storage.currentVersion.levels[0]) != 0 || len(db.immutableMemtables) != 2 {
+		t.Fatalf("the newer job is not supposed to be installed before the older one")
+	}
+	db.installFlushJob(older)
+	level0 := db.storage.currentVersion.levels[0]
+	if len(level0) != 2 || level0[0] != older.table || level0[1] != newer.table {
+		t.Fatalf("the jobs are supposed to be installed in order, got %v", level0)
+	}
+	if len(db.immutableMemtables) != 0 || db.claimedMemtables != 0 || db.storage.currentVersion.walOffset != 200 {
+		t.Errorf("the memtables of the installed jobs are supposed to be removed")
+	}
+}
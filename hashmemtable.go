@@ -0,0 +1,211 @@
+package drifterdb
+
+import (
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"github.com/LaJunkai/drifterdb/skiplist"
+	"sync"
+	"sync/atomic"
+)
+
+// HashMapMemtable buckets the records by the prefixes of their keys, each bucket is a skiplist so the records
+// of a prefix are ordered. The point lookups only search the bucket of the key, while the full iteration and
+// the ranges across the prefixes sort the records of all the buckets.
+type HashMapMemtable struct {
+	comparable common.Comparable
+	extractor  PrefixExtractor
+	// lock guards the buckets map, the records of the buckets are guarded by the memtableLock of the db.
+	lock      sync.RWMutex
+	buckets   map[string]*skiplist.SkipList
+	byteSize  int
+	RefTrx    sync.Map
+	countRefs int32
+}
+
+func NewHashMapMemtable(comparable common.Comparable, extractor PrefixExtractor) *HashMapMemtable {
+	return &HashMapMemtable{
+		comparable: comparable,
+		extractor:  extractor,
+		buckets:    make(map[string]*skiplist.SkipList),
+	}
+}
+
+// prefix returns the bucket of the key, the keys out of the domain of the extractor share the bucket of the empty
+// prefix, so do all the keys if the extractor is nil.
+func (h *HashMapMemtable) prefix(key interface{}) []byte {
+	content := key.(*common.MVCCKey).Content
+	if h.extractor == nil || !h.extractor.InDomain(content) {
+		return nil
+	}
+	return h.extractor.Transform(content)
+}
+
+func (h *HashMapMemtable) bucket(key interface{}) *skiplist.SkipList {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.buckets[string(h.prefix(key))]
+}
+
+func (h *HashMapMemtable) Put(key interface{}, value []byte) (*Element, bool) {
+	bucket := h.bucket(key)
+	if bucket == nil {
+		h.lock.Lock()
+		prefix := string(h.prefix(key))
+		if bucket = h.buckets[prefix]; bucket == nil {
+			bucket = skiplist.NewSkipList(h.comparable)
+			h.buckets[prefix] = bucket
+		}
+		h.lock.Unlock()
+	}
+	entry, success := bucket.Set(key, value)
+	if entry != nil {
+		return ParseElement(entry.Key(), entry.Value.([]byte), entry), success
+	}
+	return nil, success
+}
+
+func (h *HashMapMemtable) Get(key interface{}) *Element {
+	bucket := h.bucket(key)
+	if bucket == nil {
+		return nil
+	}
+	if entry := bucket.GetEntry(key); entry != nil {
+		return ParseElement(key, entry.Value.([]byte), entry)
+	}
+	return nil
+}
+
+func (h *HashMapMemtable) Delete(key interface{}) *Element {
+	bucket := h.bucket(key)
+	if bucket == nil {
+		return nil
+	}
+	if entry := bucket.Delete(key); entry != nil {
+		return ParseElement(entry.Key(), entry.Value.([]byte), entry)
+	}
+	return nil
+}
+
+// Range only searches the bucket of the start key if the end key shares the prefix.
+func (h *HashMapMemtable) Range(start, end interface{}, count, offset int) []*Element {
+	if h.extractor != nil {
+		startContent, endContent := start.(*common.MVCCKey).Content, end.(*common.MVCCKey).Content
+		if h.extractor.InDomain(startContent) && h.extractor.InDomain(endContent) &&
+			string(h.extractor.Transform(startContent)) == string(h.extractor.Transform(endContent)) {
+			bucket := h.bucket(start)
+			if bucket == nil {
+				return nil
+			}
+			return skiplistElements(bucket.Range(start, end, count+offset, 0))
+		}
+	}
+	result := make([]*Element, 0)
+	h.lock.RLock()
+	for _, bucket := range h.buckets {
+		result = append(result, skiplistElements(bucket.Range(start, end, count+offset, 0))...)
+	}
+	h.lock.RUnlock()
+	sortElements(h.comparable, result)
+	if len(result) > count+offset {
+		result = result[:count+offset]
+	}
+	return result
+}
+
+func skiplistElements(entries []*skiplist.Entry) []*Element {
+	result := make([]*Element, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, &Element{key: entry.Key(), value: entry.Value.([]byte), ListEntry: entry})
+	}
+	return result
+}
+
+func (h *HashMapMemtable) Exists(key interface{}) bool {
+	return h.Get(key) != nil
+}
+
+func (h *HashMapMemtable) Size() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	size := 0
+	for _, bucket := range h.buckets {
+		size += bucket.Length()
+	}
+	return size
+}
+
+func (h *HashMapMemtable) BytesSize() int {
+	return h.byteSize
+}
+
+func (h *HashMapMemtable) IncreaseBytesSize(delta int) {
+	h.byteSize += delta
+}
+
+// elements returns the records of all the buckets in order.
+func (h *HashMapMemtable) elements() []*Element {
+	result := make([]*Element, 0)
+	h.lock.RLock()
+	for _, bucket := range h.buckets {
+		for i := bucket.Iterator(); i.HasNext(); {
+			entry := i.Get()
+			result = append(result, &Element{key: entry.Key(), value: entry.Value.([]byte), ListEntry: entry})
+		}
+	}
+	h.lock.RUnlock()
+	sortElements(h.comparable, result)
+	return result
+}
+
+func (h *HashMapMemtable) Iterator() MemtableIterator {
+	return &sliceMemtableIterator{comparable: h.comparable, elements: h.elements()}
+}
+
+func (h *HashMapMemtable) First() *Element {
+	var first *Element = nil
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for _, bucket := range h.buckets {
+		if e := bucket.First(); e != nil && (first == nil || h.comparable.ModifyCompare(e.Key(), first.key) < 0) {
+			first = ParseElement(e.Key(), e.Value.([]byte), e)
+		}
+	}
+	return first
+}
+
+func (h *HashMapMemtable) Last() *Element {
+	var last *Element = nil
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for _, bucket := range h.buckets {
+		if e := bucket.Back(); e != nil && (last == nil || h.comparable.ModifyCompare(e.Key(), last.key) > 0) {
+			last = ParseElement(e.Key(), e.Value.([]byte), e)
+		}
+	}
+	return last
+}
+
+func (h *HashMapMemtable) Ref(trx *Transaction) {
+	if _, existed := h.RefTrx.LoadOrStore(trx, nil); !existed {
+		atomic.AddInt32(&h.countRefs, 1)
+	}
+}
+
+func (h *HashMapMemtable) CancelRef(trx *Transaction) {
+	if _, existed := h.RefTrx.LoadAndDelete(trx); existed {
+		atomic.AddInt32(&h.countRefs, -1)
+	}
+}
+
+func (h *HashMapMemtable) CountRefs() int {
+	return int(atomic.LoadInt32(&h.countRefs))
+}
+
+func (h *HashMapMemtable) InlinePreview() {
+	for i := h.Iterator(); i.HasNext(); {
+		n := i.Next()
+		k := n.Key().(*common.MVCCKey)
+		fmt.Printf("[%v](%v, %v): [%v]     ", string(k.Content), k.Seq, k.KT, string(n.Value()))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,187 @@
+package drifterdb
+
+import (
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"github.com/LaJunkai/drifterdb/skiplist"
+	"sync"
+	"sync/atomic"
+)
+
+// LockFreeMemtable is a memtable backed by a skiplist.LockFreeSkipList, the inserts are not blocked by each other
+// and the readers never block. The BytesSize is the size of the arena of the list.
+type LockFreeMemtable struct {
+	comparable common.Comparable
+	list       *skiplist.LockFreeSkipList
+	RefTrx     sync.Map
+	countRefs  int32
+}
+
+func NewLockFreeMemtable(comparable common.Comparable) *LockFreeMemtable {
+	return &LockFreeMemtable{
+		list:       skiplist.NewLockFreeSkipList(comparable),
+		comparable: comparable,
+	}
+}
+
+type LockFreeMemtableIterator struct {
+	memtable *LockFreeMemtable
+	iterator *skiplist.LockFreeIterator
+}
+
+func (l *LockFreeMemtableIterator) First() *Element {
+	return l.memtable.First()
+}
+
+func (l *LockFreeMemtableIterator) Back() *Element {
+	return l.memtable.Last()
+}
+
+func (l *LockFreeMemtableIterator) Next() *Element {
+	return lockFreeElement(l.iterator.Get())
+}
+
+func (l *LockFreeMemtableIterator) HasNext() bool {
+	return l.iterator.HasNext()
+}
+
+func (l *LockFreeMemtableIterator) Prev() *Element {
+	current := l.iterator.Current()
+	l.iterator.Prev()
+	return lockFreeElement(current)
+}
+
+func (l *LockFreeMemtableIterator) Valid() bool {
+	return l.iterator.Valid()
+}
+
+func (l *LockFreeMemtableIterator) Key() interface{} {
+	if current := l.iterator.Current(); current != nil {
+		return current.Key()
+	}
+	return nil
+}
+
+func (l *LockFreeMemtableIterator) Value() []byte {
+	if current := l.iterator.Current(); current != nil {
+		return current.Value()
+	}
+	return nil
+}
+
+func (l *LockFreeMemtableIterator) Seek(key interface{}) {
+	l.iterator.Seek(key)
+}
+
+func (l *LockFreeMemtableIterator) SeekForPrev(key interface{}) {
+	l.iterator.SeekForPrev(key)
+}
+
+func (l *LockFreeMemtableIterator) SeekToFirst() {
+	l.iterator.First()
+}
+
+func (l *LockFreeMemtableIterator) SeekToLast() {
+	l.iterator.Last()
+}
+
+// lockMemtable locks the active memtable for a write and returns the function unlocking it, the writes of a
+// LockFreeMemtable share the memtableLock since its inserts are not blocked by each other. It is supposed to be
+// called with the switchMemtableLock held.
+func (db *DrifterDB) lockMemtable() func() {
+	if _, ok := db.memtable.(*LockFreeMemtable); ok {
+		db.memtableLock.RLock()
+		return db.memtableLock.RUnlock
+	}
+	db.memtableLock.Lock()
+	return db.memtableLock.Unlock
+}
+
+func lockFreeElement(entry *skiplist.LockFreeEntry) *Element {
+	if entry == nil {
+		return nil
+	}
+	return &Element{key: entry.Key(), value: entry.Value()}
+}
+
+func (l *LockFreeMemtable) Put(key interface{}, value []byte) (*Element, bool) {
+	entry, success := l.list.Set(key, value)
+	return lockFreeElement(entry), success
+}
+
+func (l *LockFreeMemtable) Get(key interface{}) *Element {
+	if entry := l.list.GetEntry(key); entry != nil {
+		return &Element{key: key, value: entry.Value()}
+	}
+	return nil
+}
+
+func (l *LockFreeMemtable) Delete(key interface{}) *Element {
+	return lockFreeElement(l.list.Delete(key))
+}
+
+func (l *LockFreeMemtable) Range(start, end interface{}, count, offset int) []*Element {
+	entries := l.list.Range(start, end, count+offset)
+	result := make([]*Element, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, lockFreeElement(entry))
+	}
+	return result
+}
+
+func (l *LockFreeMemtable) Exists(key interface{}) bool {
+	return l.list.Exists(key)
+}
+
+func (l *LockFreeMemtable) Size() int {
+	return l.list.Length()
+}
+
+func (l *LockFreeMemtable) BytesSize() int {
+	return l.list.BytesSize()
+}
+
+// IncreaseBytesSize does nothing, the size of the records is accounted by the arena.
+func (l *LockFreeMemtable) IncreaseBytesSize(delta int) {
+}
+
+func (l *LockFreeMemtable) Iterator() MemtableIterator {
+	return &LockFreeMemtableIterator{
+		memtable: l,
+		iterator: l.list.Iterator(),
+	}
+}
+
+func (l *LockFreeMemtable) First() *Element {
+	return lockFreeElement(l.list.First())
+}
+
+func (l *LockFreeMemtable) Last() *Element {
+	return lockFreeElement(l.list.Back())
+}
+
+func (l *LockFreeMemtable) Ref(trx *Transaction) {
+	if _, existed := l.RefTrx.LoadOrStore(trx, nil); !existed {
+		atomic.AddInt32(&l.countRefs, 1)
+	}
+}
+
+func (l *LockFreeMemtable) CancelRef(trx *Transaction) {
+	if _, existed := l.RefTrx.LoadAndDelete(trx); existed {
+		atomic.AddInt32(&l.countRefs, -1)
+	}
+}
+
+func (l *LockFreeMemtable) CountRefs() int {
+	return int(atomic.LoadInt32(&l.countRefs))
+}
+
+func (l *LockFreeMemtable) InlinePreview() {
+	i := l.Iterator()
+	for i.HasNext() {
+		n := i.Next()
+		k := n.Key().(*common.MVCCKey)
+		fmt.Printf("[%v](%v, %v): [%v]     ", string(k.Content), k.Seq, k.KT, string(n.Value()))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,93 @@
+package drifterdb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockFreeMemtable_Transactions(t *testing.T) {
+	option := DefaultOption()
+	option.LockFreeMemtable = true
+	db := New(t.TempDir(), option)
+	defer db.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("key-%d-%03d", g, i)
+				if !db.Put([]byte(key), []byte(key)) {
+					t.Errorf("the put of %s is supposed to succeed", key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if v := db.Get([]byte("key-2-042")); string(v) != "key-2-042" {
+		t.Errorf("the value is supposed to be read from the lock-free memtable, got %s", v)
+	}
+	trx := db.StartTransaction()
+	trx.Put([]byte("key-0-000"), []byte("rolled back"))
+	db.RollbackTransaction(trx)
+	if v := db.Get([]byte("key-0-000")); string(v) != "key-0-000" {
+		t.Errorf("the rolled back version is supposed to be skipped, got %s", v)
+	}
+	if result := db.Range([]byte("key-1-"), []byte("key-2-"), 1000, 0); len(result) != 100 {
+		t.Errorf("the range is supposed to return 100 records, got %d", len(result))
+	}
+	if db.memtable.BytesSize() == 0 {
+		t.Errorf("the bytes size is supposed to be accounted by the arena")
+	}
+}
+
+func TestLockFreeMemtable_SharedWrites(t *testing.T) {
+	option := DefaultOption()
+	option.LockFreeMemtable = true
+	db := New(t.TempDir(), option)
+	defer db.Close()
+	// the writes are not blocked by the shared holders of the memtableLock
+	db.memtableLock.RLock()
+	var wg sync.WaitGroup
+	trxs := make([]*Transaction, 4)
+	for g := range trxs {
+		trxs[g] = db.StartTransaction()
+		wg.Add(1)
+		go func(trx *Transaction, g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("key-%d-%03d", g, i)
+				if err := trx.Put([]byte(key), []byte(key)); err != nil {
+					t.Errorf("the put of %s is supposed to succeed, got %v", key, err)
+				}
+			}
+		}(trxs[g], g)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		db.memtableLock.RUnlock()
+	case <-time.After(5 * time.Second):
+		db.memtableLock.RUnlock()
+		t.Fatalf("the writes of the lock-free memtable are supposed to share the memtableLock")
+	}
+	snapshot := db.GetSnapshot()
+	defer db.ReleaseSnapshot(snapshot)
+	for _, trx := range trxs {
+		if err := db.CommitTransaction(trx); err != nil {
+			t.Fatalf("the commit is supposed to succeed, got %v", err)
+		}
+	}
+	if result := db.Range([]byte("key-"), []byte("key."), 1000, 0); len(result) != 400 {
+		t.Errorf("the range is supposed to return 400 records, got %d", len(result))
+	}
+	if v, _ := db.GetWithOptions(&ReadOptions{Snapshot: snapshot}, []byte("key-3-099")); v != nil {
+		t.Errorf("the writes committed after the snapshot are supposed to be invisible, got %s", v)
+	}
+}
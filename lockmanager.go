@@ -0,0 +1,474 @@
+package drifterdb
+
+import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Row Lock
+
+Every key written by a pessimistic transaction is locked exclusively in the LockManager until the transaction is
+committed or rolled back. The locks are kept in a striped hash map, each lock has a FIFO queue of the waiting
+transactions, and the lock is handed to the waiters at the front of the queue on release so that the waiters are
+woken up in order instead of polling the TrxId of the memtable entries.
+
+GetForUpdate takes a shared or an exclusive lock on the key, the shared locks are compatible with each other.
+LockRange takes a gap lock on the [start, end) range, which blocks the writes of other transactions into the range,
+so that the range read by the transaction has no phantom until the commit. The gap lock is registered before
+waiting for the writers holding the keys in the range, so no new writer can slip in.
+*/
+
+const (
+	LockStripes        = 1 << 6
+	DefaultLockTimeout = TransactionTimeout * time.Second
+)
+
+type lockWaiter struct {
+	trxId     uint32
+	exclusive bool
+	granted   bool
+	// err is set if the waiter is aborted as the victim of a deadlock
+	err   error
+	ready chan struct{}
+}
+
+type rowLock struct {
+	// holders maps the transactions holding the lock to whether the lock is held exclusively
+	holders map[uint32]bool
+	waiters []*lockWaiter
+}
+
+// compatible reports whether the lock can be held by the transaction together with the other holders.
+func (l *rowLock) compatible(trxId uint32, exclusive bool) bool {
+	for holder, ex := range l.holders {
+		if holder != trxId && (exclusive || ex) {
+			return false
+		}
+	}
+	return true
+}
+
+// conflicts returns the holders which the transaction waits for.
+func (l *rowLock) conflicts(trxId uint32, exclusive bool) []uint32 {
+	result := make([]uint32, 0, len(l.holders))
+	for holder, ex := range l.holders {
+		if holder != trxId && (exclusive || ex) {
+			result = append(result, holder)
+		}
+	}
+	return result
+}
+
+func (l *rowLock) grant(trxId uint32, exclusive bool) {
+	l.holders[trxId] = l.holders[trxId] || exclusive
+}
+
+func (l *rowLock) removeWaiter(w *lockWaiter) {
+	for i, waiter := range l.waiters {
+		if waiter == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type lockStripe struct {
+	lock  sync.Mutex
+	locks map[string]*rowLock
+}
+
+type rangeLock struct {
+	trxId uint32
+	start []byte
+	end   []byte
+}
+
+func (r *rangeLock) contains(key []byte) bool {
+	return bytes.Compare(r.start, key) <= 0 && bytes.Compare(key, r.end) < 0
+}
+
+type LockManager struct {
+	stripes []*lockStripe
+	graph   *waitForGraph
+	// rangeLock guards the ranges and the changed channel which is closed to wake up the range waiters
+	rangeLock    sync.Mutex
+	ranges       []*rangeLock
+	changed      chan struct{}
+	rangeWaiters int32
+}
+
+func NewLockManager() *LockManager {
+	stripes := make([]*lockStripe, LockStripes)
+	for i := range stripes {
+		stripes[i] = &lockStripe{locks: make(map[string]*rowLock)}
+	}
+	return &LockManager{
+		stripes: stripes,
+		graph:   newWaitForGraph(),
+		ranges:  make([]*rangeLock, 0),
+		changed: make(chan struct{}),
+	}
+}
+
+func (m *LockManager) stripe(key []byte) *lockStripe {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return m.stripes[h.Sum32()%LockStripes]
+}
+
+// TryAcquire acquires the exclusive lock of the key without waiting and reports whether the lock is held by the transaction.
+func (m *LockManager) TryAcquire(trxId uint32, key []byte) bool {
+	s := m.stripe(key)
+	s.lock.Lock()
+	l, ok := s.locks[string(key)]
+	if !ok {
+		l = &rowLock{holders: make(map[uint32]bool)}
+		s.locks[string(key)] = l
+	} else if !l.compatible(trxId, true) || (len(l.waiters) != 0 && !hasHolder(l, trxId)) {
+		s.lock.Unlock()
+		return false
+	}
+	l.grant(trxId, true)
+	s.lock.Unlock()
+	m.rangeLock.Lock()
+	conflicts := m.rangeConflicts(trxId, key)
+	m.rangeLock.Unlock()
+	if len(conflicts) != 0 {
+		m.Release(trxId, key)
+		return false
+	}
+	return true
+}
+
+// Acquire waits for the lock of the key until the timeout expires or the ctx is done,
+// ErrLockTimeout or the error of the ctx is returned if the lock is not acquired.
+// ErrDeadlock is returned if the transaction is chosen as the victim of a deadlock.
+// The transaction waits for ever if the timeout is not positive.
+// The exclusive lock also waits for the range locks of other transactions covering the key.
+// The waiting is not added into the wait-for graph if detectDeadlock is false.
+func (m *LockManager) Acquire(ctx context.Context, trxId uint32, key []byte, exclusive bool, timeout time.Duration, detectDeadlock bool) error {
+	held, heldExclusive := m.holds(trxId, key)
+	if heldExclusive {
+		return nil
+	}
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		if err := m.acquireRow(ctx, trxId, key, exclusive, deadline, detectDeadlock); err != nil {
+			return err
+		}
+		if !exclusive {
+			return nil
+		}
+		m.rangeLock.Lock()
+		conflicts := m.rangeConflicts(trxId, key)
+		m.rangeLock.Unlock()
+		if len(conflicts) == 0 {
+			return nil
+		}
+		// back off so that the holders of the range locks never wait for the new writer
+		if held {
+			m.downgrade(trxId, key)
+		} else {
+			m.Release(trxId, key)
+		}
+		err := m.waitRange(ctx, trxId, key, deadline, detectDeadlock, func() []uint32 {
+			return m.rangeConflicts(trxId, key)
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// holds reports whether the transaction holds the lock of the key and whether the lock is held exclusively.
+func (m *LockManager) holds(trxId uint32, key []byte) (bool, bool) {
+	s := m.stripe(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if l, ok := s.locks[string(key)]; ok {
+		exclusive, held := l.holders[trxId]
+		return held, exclusive
+	}
+	return false, false
+}
+
+func (m *LockManager) downgrade(trxId uint32, key []byte) {
+	s := m.stripe(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if l, ok := s.locks[string(key)]; ok && hasHolder(l, trxId) {
+		l.holders[trxId] = false
+		m.promote(l)
+	}
+}
+
+func (m *LockManager) acquireRow(ctx context.Context, trxId uint32, key []byte, exclusive bool, deadline time.Time, detectDeadlock bool) error {
+	s := m.stripe(key)
+	s.lock.Lock()
+	l, ok := s.locks[string(key)]
+	if !ok {
+		l = &rowLock{holders: make(map[uint32]bool)}
+		s.locks[string(key)] = l
+	}
+	// the holders upgrade the lock regardless of the queue
+	if l.compatible(trxId, exclusive) && (len(l.waiters) == 0 || hasHolder(l, trxId)) {
+		l.grant(trxId, exclusive)
+		s.lock.Unlock()
+		return nil
+	}
+	w := &lockWaiter{trxId: trxId, exclusive: exclusive, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	s.lock.Unlock()
+	entry := &waitingEntry{
+		key: key,
+		owners: func() []uint32 {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if w.granted || w.err != nil {
+				return nil
+			}
+			return l.conflicts(trxId, exclusive)
+		},
+		abort: func() bool {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if w.granted || w.err != nil {
+				return false
+			}
+			l.removeWaiter(w)
+			w.err = ErrDeadlock
+			close(w.ready)
+			return true
+		},
+	}
+	if detectDeadlock {
+		if err := m.graph.Wait(trxId, entry); err != nil {
+			return err
+		}
+		defer m.graph.Done(trxId)
+	}
+
+	expired, stop := timerOf(deadline)
+	defer stop()
+	var err error
+	select {
+	case <-w.ready:
+		return w.err
+	case <-expired:
+		err = ErrLockTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if w.granted || w.err != nil {
+		// the lock is handed over or the waiter is aborted before it gives up
+		return w.err
+	}
+	l.removeWaiter(w)
+	m.promote(l)
+	return err
+}
+
+func hasHolder(l *rowLock, trxId uint32) bool {
+	_, ok := l.holders[trxId]
+	return ok
+}
+
+// timerOf returns a channel which fires at the deadline, the channel never fires if the deadline is zero.
+func timerOf(deadline time.Time) (<-chan time.Time, func()) {
+	if deadline.IsZero() {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, func() { timer.Stop() }
+}
+
+// promote grants the lock to the waiters at the front of the queue as long as they are compatible with the holders.
+func (m *LockManager) promote(l *rowLock) {
+	for len(l.waiters) != 0 {
+		w := l.waiters[0]
+		if !l.compatible(w.trxId, w.exclusive) {
+			return
+		}
+		l.waiters = l.waiters[1:]
+		l.grant(w.trxId, w.exclusive)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// Release releases the lock of the key held by the transaction and hands it to the waiters.
+func (m *LockManager) Release(trxId uint32, key []byte) {
+	s := m.stripe(key)
+	s.lock.Lock()
+	l, ok := s.locks[string(key)]
+	if !ok || !hasHolder(l, trxId) {
+		s.lock.Unlock()
+		return
+	}
+	delete(l.holders, trxId)
+	m.promote(l)
+	if len(l.holders) == 0 && len(l.waiters) == 0 {
+		delete(s.locks, string(key))
+	}
+	s.lock.Unlock()
+	if atomic.LoadInt32(&m.rangeWaiters) != 0 {
+		m.rangeLock.Lock()
+		m.notify()
+		m.rangeLock.Unlock()
+	}
+}
+
+// LockRange takes the gap lock of the [start, end) range and waits for the other transactions
+// holding the exclusive locks of the keys in the range.
+func (m *LockManager) LockRange(ctx context.Context, trxId uint32, start, end []byte, timeout time.Duration, detectDeadlock bool) error {
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	r := &rangeLock{trxId: trxId, start: start, end: end}
+	m.rangeLock.Lock()
+	m.ranges = append(m.ranges, r)
+	m.rangeLock.Unlock()
+	err := m.waitRange(ctx, trxId, start, deadline, detectDeadlock, func() []uint32 {
+		return m.rowConflicts(trxId, start, end)
+	})
+	if err != nil {
+		m.rangeLock.Lock()
+		for i, rg := range m.ranges {
+			if rg == r {
+				m.ranges = append(m.ranges[:i], m.ranges[i+1:]...)
+				break
+			}
+		}
+		m.notify()
+		m.rangeLock.Unlock()
+	}
+	return err
+}
+
+// ReleaseRanges releases all the range locks held by the transaction.
+func (m *LockManager) ReleaseRanges(trxId uint32) {
+	m.rangeLock.Lock()
+	defer m.rangeLock.Unlock()
+	ranges := m.ranges[:0]
+	for _, r := range m.ranges {
+		if r.trxId != trxId {
+			ranges = append(ranges, r)
+		}
+	}
+	m.ranges = ranges
+	m.notify()
+}
+
+// ReleaseRange releases one range lock of the [start, end) range held by the transaction.
+func (m *LockManager) ReleaseRange(trxId uint32, start, end []byte) {
+	m.rangeLock.Lock()
+	defer m.rangeLock.Unlock()
+	for i, r := range m.ranges {
+		if r.trxId == trxId && bytes.Equal(r.start, start) && bytes.Equal(r.end, end) {
+			m.ranges = append(m.ranges[:i], m.ranges[i+1:]...)
+			break
+		}
+	}
+	m.notify()
+}
+
+// notify wakes up the range waiters, it is supposed to be called with the rangeLock held.
+func (m *LockManager) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// rangeConflicts returns the other transactions holding the range locks covering the key,
+// it is supposed to be called with the rangeLock held.
+func (m *LockManager) rangeConflicts(trxId uint32, key []byte) []uint32 {
+	result := make([]uint32, 0)
+	for _, r := range m.ranges {
+		if r.trxId != trxId && r.contains(key) {
+			result = append(result, r.trxId)
+		}
+	}
+	return result
+}
+
+// rowConflicts returns the other transactions holding the exclusive locks of the keys in the range,
+// the shared locks are ignored since their holders never write the keys.
+func (m *LockManager) rowConflicts(trxId uint32, start, end []byte) []uint32 {
+	result := make([]uint32, 0)
+	for _, s := range m.stripes {
+		s.lock.Lock()
+		for key, l := range s.locks {
+			if bytes.Compare(start, []byte(key)) > 0 || bytes.Compare([]byte(key), end) >= 0 {
+				continue
+			}
+			for holder, exclusive := range l.holders {
+				if holder != trxId && exclusive {
+					result = append(result, holder)
+				}
+			}
+		}
+		s.lock.Unlock()
+	}
+	return result
+}
+
+// waitRange waits until the conflicts are resolved, the conflicts is called with the rangeLock held.
+func (m *LockManager) waitRange(ctx context.Context, trxId uint32, key []byte, deadline time.Time, detectDeadlock bool, conflicts func() []uint32) error {
+	atomic.AddInt32(&m.rangeWaiters, 1)
+	defer atomic.AddInt32(&m.rangeWaiters, -1)
+	expired, stop := timerOf(deadline)
+	defer stop()
+	aborted := make(chan struct{})
+	var abortOnce sync.Once
+	entry := &waitingEntry{
+		key: key,
+		owners: func() []uint32 {
+			m.rangeLock.Lock()
+			defer m.rangeLock.Unlock()
+			return conflicts()
+		},
+		abort: func() bool {
+			abortOnce.Do(func() { close(aborted) })
+			return true
+		},
+	}
+	for {
+		m.rangeLock.Lock()
+		changed, owners := m.changed, conflicts()
+		m.rangeLock.Unlock()
+		if len(owners) == 0 {
+			return nil
+		}
+		if detectDeadlock {
+			if err := m.graph.Wait(trxId, entry); err != nil {
+				return err
+			}
+		}
+		var err error
+		select {
+		case <-changed:
+		case <-aborted:
+			err = ErrDeadlock
+		case <-expired:
+			err = ErrLockTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if detectDeadlock {
+			m.graph.Done(trxId)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package drifterdb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockManager_FIFO(t *testing.T) {
+	m := NewLockManager()
+	key := []byte("k")
+	if err := m.Acquire(context.Background(), 1, key, true, 0, true); err != nil {
+		t.Fatalf("the free lock is supposed to be acquired, got %v", err)
+	}
+	order := make(chan uint32, 2)
+	for _, trxId := range []uint32{2, 3} {
+		go func(trxId uint32) {
+			if err := m.Acquire(context.Background(), trxId, key, true, time.Second, true); err == nil {
+				order <- trxId
+				m.Release(trxId, key)
+			}
+		}(trxId)
+		// make sure the waiters are queued in order
+		time.Sleep(10 * time.Millisecond)
+	}
+	m.Release(1, key)
+	for _, expected := range []uint32{2, 3} {
+		if got := <-order; got != expected {
+			t.Errorf("the lock is supposed to be granted to %v, got %v", expected, got)
+		}
+	}
+	if !m.TryAcquire(4, key) {
+		t.Errorf("the lock is supposed to be free after all the waiters release it")
+	}
+}
+
+func TestLockManager_Timeout(t *testing.T) {
+	m := NewLockManager()
+	key := []byte("k")
+	m.TryAcquire(1, key)
+	if err := m.Acquire(context.Background(), 2, key, true, 20*time.Millisecond, true); err != ErrLockTimeout {
+		t.Errorf("the waiting is supposed to time out, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := m.Acquire(ctx, 3, key, true, 0, true); err != context.Canceled {
+		t.Errorf("the waiting is supposed to be canceled, got %v", err)
+	}
+	// the waiters which gave up are not granted
+	m.Release(1, key)
+	if !m.TryAcquire(4, key) {
+		t.Errorf("the lock is supposed to be free")
+	}
+}
+
+func TestTransaction_WaitForLock(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	holder := db.StartTransaction()
+	if err := holder.Put([]byte("name"), []byte("holder")); err != nil {
+		t.Fatalf("the write is supposed to succeed, got %v", err)
+	}
+	waiter := db.StartTransaction()
+	waiter.SetLockTimeout(10 * time.Millisecond)
+	if err := waiter.Put([]byte("name"), []byte("waiter")); err != ErrLockTimeout {
+		t.Errorf("the write is supposed to time out, got %v", err)
+	}
+	db.RollbackTransaction(waiter)
+	done := make(chan error)
+	go func() {
+		trx := db.StartTransaction()
+		err := trx.Put([]byte("name"), []byte("waiter"))
+		db.CommitTransaction(trx)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	db.CommitTransaction(holder)
+	if err := <-done; err != nil {
+		t.Errorf("the write is supposed to succeed after the holder commits, got %v", err)
+	}
+	if v := db.Get([]byte("name")); string(v) != "waiter" {
+		t.Errorf("the value is supposed to be written by the waiter, got %s", v)
+	}
+}
+
+func TestTransaction_Deadlock(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	t1 := db.StartTransaction()
+	t2 := db.StartTransaction()
+	if err := t1.Put([]byte("a"), []byte("t1")); err != nil {
+		t.Fatalf("the write is supposed to succeed, got %v", err)
+	}
+	if err := t2.Put([]byte("b"), []byte("t2")); err != nil {
+		t.Fatalf("the write is supposed to succeed, got %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		err := t1.Put([]byte("b"), []byte("t1"))
+		db.CommitTransaction(t1)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// t2 is younger, so it is chosen as the victim
+	if err := t2.Put([]byte("a"), []byte("t2")); err != ErrDeadlock {
+		t.Fatalf("the write is supposed to fail with the deadlock, got %v", err)
+	}
+	db.RollbackTransaction(t2)
+	if err := <-done; err != nil {
+		t.Errorf("the write of t1 is supposed to succeed after t2 is rolled back, got %v", err)
+	}
+	reports := db.GetDeadlockReports()
+	if len(reports) != 1 || reports[0].Victim != t2.TrxID() || len(reports[0].Waiters) != 2 {
+		t.Errorf("the deadlock is supposed to be reported, got %+v", reports)
+	}
+}
+
+func TestWaitForGraph_Reports(t *testing.T) {
+	g := newWaitForGraph()
+	for i := 0; i < DeadlockReportCapacity+3; i++ {
+		g.report(&DeadlockReport{Victim: uint32(i)})
+	}
+	reports := g.Reports()
+	if len(reports) != DeadlockReportCapacity {
+		t.Fatalf("the reports are supposed to be bounded, got %v", len(reports))
+	}
+	if reports[0].Victim != 3 || reports[len(reports)-1].Victim != DeadlockReportCapacity+2 {
+		t.Errorf("the reports are supposed to be ordered from the oldest to the newest")
+	}
+}
+
+func TestLockManager_Shared(t *testing.T) {
+	m := NewLockManager()
+	key := []byte("k")
+	if err := m.Acquire(context.Background(), 1, key, false, 0, true); err != nil {
+		t.Fatalf("the shared lock is supposed to be acquired, got %v", err)
+	}
+	if err := m.Acquire(context.Background(), 2, key, false, 10*time.Millisecond, true); err != nil {
+		t.Errorf("the shared locks are supposed to be compatible, got %v", err)
+	}
+	if err := m.Acquire(context.Background(), 3, key, true, 10*time.Millisecond, true); err != ErrLockTimeout {
+		t.Errorf("the exclusive lock is supposed to wait for the shared locks, got %v", err)
+	}
+	m.Release(2, key)
+	if err := m.Acquire(context.Background(), 1, key, true, 10*time.Millisecond, true); err != nil {
+		t.Errorf("the only holder is supposed to upgrade the lock, got %v", err)
+	}
+}
+
+func TestTransaction_GetForUpdate(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	db.Put([]byte("counter"), []byte("1"))
+	reader := db.StartTransaction()
+	if v, err := reader.GetForUpdate([]byte("counter"), false); err != nil || string(v) != "1" {
+		t.Fatalf("the value is supposed to be read with the lock, got %s, %v", v, err)
+	}
+	writer := db.StartTransaction()
+	writer.SetLockTimeout(10 * time.Millisecond)
+	if err := writer.Put([]byte("counter"), []byte("2")); err != ErrLockTimeout {
+		t.Errorf("the write is supposed to wait for the shared lock, got %v", err)
+	}
+	db.RollbackTransaction(writer)
+	db.CommitTransaction(reader)
+	if !db.Put([]byte("counter"), []byte("2")) {
+		t.Errorf("the write is supposed to succeed after the lock is released")
+	}
+}
+
+func TestTransaction_LockRange(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	reader := db.StartTransaction()
+	if err := reader.LockRange([]byte("order:"), []byte("order;")); err != nil {
+		t.Fatalf("the range is supposed to be locked, got %v", err)
+	}
+	writer := db.StartTransaction()
+	writer.SetLockTimeout(10 * time.Millisecond)
+	if err := writer.Put([]byte("order:1"), []byte("new")); err != ErrLockTimeout {
+		t.Errorf("the insert into the locked range is supposed to wait, got %v", err)
+	}
+	if err := writer.Put([]byte("user:1"), []byte("new")); err != nil {
+		t.Errorf("the write out of the locked range is supposed to succeed, got %v", err)
+	}
+	// the range lock waits for the writers in the range
+	other := db.StartTransaction()
+	other.SetLockTimeout(10 * time.Millisecond)
+	if err := other.LockRange([]byte("user:"), []byte("user;")); err != ErrLockTimeout {
+		t.Errorf("the range lock is supposed to wait for the writer in the range, got %v", err)
+	}
+	db.RollbackTransaction(other)
+	db.CommitTransaction(writer)
+	db.CommitTransaction(reader)
+	if !db.Put([]byte("order:1"), []byte("new")) {
+		t.Errorf("the insert is supposed to succeed after the range lock is released")
+	}
+}
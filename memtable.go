@@ -5,13 +5,28 @@ import (
 	"github.com/LaJunkai/drifterdb/skiplist"
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+// MemtableIterator iterates the records of the memtable in both directions. Next returns the current record and moves
+// the cursor forward while Prev returns it and moves the cursor backward, so the records are scanned in the reverse
+// order by `for i.SeekToLast(); i.Valid(); { i.Prev() }`. First and Back return the first and the last records without
+// moving the cursor, and Key and Value peek the current record.
 type MemtableIterator interface {
 	First() *Element
 	Back() *Element
 	Next() *Element
 	HasNext() bool
+	Prev() *Element
+	Valid() bool
+	Key() interface{}
+	Value() []byte
+	// Seek moves the cursor to the first record not less than the key and SeekForPrev moves it to the last record
+	// not greater than the key, the keys are compared by the ModifyCompare.
+	Seek(key interface{})
+	SeekForPrev(key interface{})
+	SeekToFirst()
+	SeekToLast()
 }
 
 type SkiplistMemtableIterator struct {
@@ -56,6 +71,49 @@ func (s *SkiplistMemtableIterator) HasNext() bool {
 	return s.iterator.HasNext()
 }
 
+func (s *SkiplistMemtableIterator) Prev() *Element {
+	if e := s.iterator.Current(); e != nil {
+		s.iterator.Prev()
+		return &Element{
+			key:   e.Key(),
+			value: e.Value.([]byte),
+		}
+	} else {
+		return nil
+	}
+}
+
+func (s *SkiplistMemtableIterator) Valid() bool {
+	return s.iterator.Valid()
+}
+
+func (s *SkiplistMemtableIterator) Key() interface{} {
+	return s.iterator.Key()
+}
+
+func (s *SkiplistMemtableIterator) Value() []byte {
+	if value := s.iterator.Value(); value != nil {
+		return value.([]byte)
+	}
+	return nil
+}
+
+func (s *SkiplistMemtableIterator) Seek(key interface{}) {
+	s.iterator.Seek(key)
+}
+
+func (s *SkiplistMemtableIterator) SeekForPrev(key interface{}) {
+	s.iterator.SeekForPrev(key)
+}
+
+func (s *SkiplistMemtableIterator) SeekToFirst() {
+	s.iterator.First()
+}
+
+func (s *SkiplistMemtableIterator) SeekToLast() {
+	s.iterator.Last()
+}
+
 type Memtable interface {
 	Put(key interface{}, value []byte) (*Element, bool)
 	Get(key interface{}) *Element
@@ -81,7 +139,7 @@ type SkiplistMemtable struct {
 	byteSize   int
 	mutable    bool
 	RefTrx     sync.Map
-	countRefs  int
+	countRefs  int32
 	walOffset uint64
 }
 
@@ -96,20 +154,18 @@ func (s *SkiplistMemtable) InlinePreview() {
 }
 
 func (s *SkiplistMemtable) CountRefs() int {
-	return s.countRefs
+	return int(atomic.LoadInt32(&s.countRefs))
 }
 
 func (s *SkiplistMemtable) Ref(trx *Transaction) {
-	if _, existed := s.RefTrx.Load(trx); !existed {
-		s.RefTrx.Store(trx, nil)
-		s.countRefs += 1
+	if _, existed := s.RefTrx.LoadOrStore(trx, nil); !existed {
+		atomic.AddInt32(&s.countRefs, 1)
 	}
 }
 
 func (s *SkiplistMemtable) CancelRef(trx *Transaction) {
-	if _, existed := s.RefTrx.Load(trx); existed {
-		s.RefTrx.Delete(trx)
-		s.countRefs -= 1
+	if _, existed := s.RefTrx.LoadAndDelete(trx); existed {
+		atomic.AddInt32(&s.countRefs, -1)
 	}
 }
 
@@ -190,8 +246,17 @@ func (s *SkiplistMemtable) Delete(key interface{}) *Element {
 	}
 }
 
+// Range returns the records in the [start, end) range. Every entry is a record of the plain keys, so the offset is
+// skipped by the spans of the skiplist and at most count records are returned. The spans count all the versions of
+// the MVCC keys while the offset counts the visible records, so the first count + offset versions are returned and
+// the offset is applied by the caller once the versions of all the memtables and the tables are merged.
 func (s *SkiplistMemtable) Range(start, end interface{}, count, offset int) []*Element {
-	skiplistResult := s.list.Range(start, end, count + offset, 0)
+	var skiplistResult []*skiplist.Entry
+	if _, ok := s.comparable.(common.MVCCBytes); ok {
+		skiplistResult = s.list.Range(start, end, count+offset, 0)
+	} else {
+		skiplistResult = s.list.Range(start, end, count, offset)
+	}
 	result := make([]*Element, 0, len(skiplistResult))
 	for _, entry := range skiplistResult {
 		result = append(result, &Element{key: entry.Key(), value: entry.Value.([]byte), ListEntry: entry})
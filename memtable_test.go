@@ -1,6 +1,7 @@
 package drifterdb
 
 import (
+	"fmt"
 	"github.com/LaJunkai/drifterdb/common"
 	"testing"
 )
@@ -14,4 +15,34 @@ func TestSkiplistMemtable_Put(t *testing.T) {
 			t.Errorf("error")
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestSkiplistMemtable_Range(t *testing.T) {
+	memtable := NewSkiplistMemtable(common.TypeBytes)
+	for i := 0; i < 1000; i++ {
+		memtable.Put([]byte(fmt.Sprintf("key%04d", i)), []byte(fmt.Sprintf("value%04d", i)))
+	}
+	// the offset of the plain keys is skipped by the spans
+	result := memtable.Range([]byte("key0100"), []byte("key0900"), 10, 500)
+	if len(result) != 10 {
+		t.Fatalf("the range is supposed to return 10 records, got %v", len(result))
+	}
+	for i, e := range result {
+		if want := fmt.Sprintf("key%04d", 600+i); string(e.Key().([]byte)) != want {
+			t.Errorf("the record %v is supposed to be %s, got %s", i, want, e.Key())
+		}
+	}
+	if result := memtable.Range([]byte("key0100"), []byte("key0900"), 10, 795); len(result) != 5 {
+		t.Errorf("the range is supposed to stop at the end, got %v records", len(result))
+	}
+	// the offset of the MVCC keys is left to the caller
+	mvcc := NewSkiplistMemtable(common.TypeMVCCBytes)
+	for i := 0; i < 100; i++ {
+		mvcc.Put(common.MakeMVCCKey([]byte(fmt.Sprintf("key%04d", i)), uint64(i+1), common.OpPut, 0), []byte("v"))
+	}
+	start := common.MakeMVCCKey([]byte("key"), 100, common.OpGet, 0)
+	end := common.MakeMVCCKey([]byte("kez"), 100, common.OpGet, 0)
+	if result := mvcc.Range(start, end, 10, 20); len(result) != 30 {
+		t.Errorf("the range of the MVCC keys is supposed to return count + offset records, got %v", len(result))
+	}
+}
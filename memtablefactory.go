@@ -0,0 +1,150 @@
+package drifterdb
+
+import (
+	"bytes"
+	"github.com/LaJunkai/drifterdb/common"
+	"github.com/LaJunkai/drifterdb/skiplist"
+	"sort"
+)
+
+// MemtableFactory creates the active memtables of the db, a new memtable is created once the active one is frozen.
+type MemtableFactory func() Memtable
+
+func SkiplistMemtableFactory() MemtableFactory {
+	return func() Memtable {
+		return NewSkiplistMemtable(common.TypeMVCCBytes)
+	}
+}
+
+func LockFreeMemtableFactory() MemtableFactory {
+	return func() Memtable {
+		return NewLockFreeMemtable(common.TypeMVCCBytes)
+	}
+}
+
+// HashMapMemtableFactory creates the memtables whose records are bucketed by the prefixes of the extractor,
+// all the keys share one bucket if the extractor is nil.
+func HashMapMemtableFactory(extractor PrefixExtractor) MemtableFactory {
+	return func() Memtable {
+		return NewHashMapMemtable(common.TypeMVCCBytes, extractor)
+	}
+}
+
+func VectorMemtableFactory() MemtableFactory {
+	return func() Memtable {
+		return NewVectorMemtable(common.TypeMVCCBytes)
+	}
+}
+
+// sliceMemtableIterator iterates the elements sorted by the memtable.
+type sliceMemtableIterator struct {
+	comparable common.Comparable
+	elements   []*Element
+	cursor     int
+}
+
+func (s *sliceMemtableIterator) First() *Element {
+	if len(s.elements) == 0 {
+		return nil
+	}
+	return s.elements[0]
+}
+
+func (s *sliceMemtableIterator) Back() *Element {
+	if len(s.elements) == 0 {
+		return nil
+	}
+	return s.elements[len(s.elements)-1]
+}
+
+func (s *sliceMemtableIterator) Next() *Element {
+	if !s.Valid() {
+		return nil
+	}
+	s.cursor += 1
+	return s.elements[s.cursor-1]
+}
+
+func (s *sliceMemtableIterator) HasNext() bool {
+	return s.Valid()
+}
+
+func (s *sliceMemtableIterator) Prev() *Element {
+	if !s.Valid() {
+		return nil
+	}
+	s.cursor -= 1
+	return s.elements[s.cursor+1]
+}
+
+func (s *sliceMemtableIterator) Valid() bool {
+	return s.cursor >= 0 && s.cursor < len(s.elements)
+}
+
+func (s *sliceMemtableIterator) Key() interface{} {
+	if !s.Valid() {
+		return nil
+	}
+	return s.elements[s.cursor].key
+}
+
+func (s *sliceMemtableIterator) Value() []byte {
+	if !s.Valid() {
+		return nil
+	}
+	return s.elements[s.cursor].value
+}
+
+func (s *sliceMemtableIterator) Seek(key interface{}) {
+	s.cursor = sort.Search(len(s.elements), func(i int) bool {
+		return s.comparable.ModifyCompare(s.elements[i].key, key) >= 0
+	})
+}
+
+func (s *sliceMemtableIterator) SeekForPrev(key interface{}) {
+	s.cursor = sort.Search(len(s.elements), func(i int) bool {
+		return s.comparable.ModifyCompare(s.elements[i].key, key) > 0
+	}) - 1
+}
+
+func (s *sliceMemtableIterator) SeekToFirst() {
+	s.cursor = 0
+}
+
+func (s *sliceMemtableIterator) SeekToLast() {
+	s.cursor = len(s.elements) - 1
+}
+
+func sortElements(comparable common.Comparable, elements []*Element) {
+	sort.Slice(elements, func(i, j int) bool {
+		return comparable.ModifyCompare(elements[i].key, elements[j].key) < 0
+	})
+}
+
+// rangeOfSorted returns the newest versions visible to the start key in the [start, end) range of the sorted elements,
+// which is the same as the range of the skiplist.
+func rangeOfSorted(comparable common.Comparable, elements []*Element, start, end interface{}, count int) []*Element {
+	result := make([]*Element, 0)
+	query := start.(*common.MVCCKey)
+	from := sort.Search(len(elements), func(i int) bool {
+		return comparable.ModifyCompare(elements[i].key, start) >= 0
+	})
+	var prevContent []byte = nil
+	for _, e := range elements[from:] {
+		if comparable.ModifyCompare(e.key, end) >= 0 || len(result) >= count {
+			break
+		}
+		currentKey := e.key.(*common.MVCCKey)
+		if prevContent != nil && bytes.Equal(currentKey.Content, prevContent) {
+			continue
+		}
+		if !skiplist.Visible(currentKey, query) {
+			continue
+		}
+		prevContent = currentKey.Content
+		if currentKey.KT != common.OpDelete {
+			result = append(result, e)
+		}
+	}
+	return result
+}
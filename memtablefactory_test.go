@@ -0,0 +1,162 @@
+package drifterdb
+
+import (
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"sync"
+	"testing"
+)
+
+func TestMemtableFactory(t *testing.T) {
+	factories := map[string]MemtableFactory{
+		"skiplist": SkiplistMemtableFactory(),
+		"lockfree": LockFreeMemtableFactory(),
+		"hashmap":  HashMapMemtableFactory(NewFixedPrefixExtractor(4)),
+		"hashnil":  HashMapMemtableFactory(nil),
+		"vector":   VectorMemtableFactory(),
+	}
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			option := DefaultOption()
+			option.MemtableFactory = factory
+			db := New(t.TempDir(), option)
+			defer db.Close()
+			for i := 0; i < 20; i++ {
+				db.Put([]byte(fmt.Sprintf("user%03d", i)), []byte("v1"))
+				db.Put([]byte(fmt.Sprintf("item%03d", i)), []byte("v1"))
+			}
+			db.Put([]byte("user007"), []byte("v2"))
+			trx := db.StartTransaction()
+			trx.Put([]byte("user008"), []byte("rolled back"))
+			db.RollbackTransaction(trx)
+			if v := db.Get([]byte("user007")); string(v) != "v2" {
+				t.Errorf("the newest version is supposed to be read, got %s", v)
+			}
+			if v := db.Get([]byte("user008")); string(v) != "v1" {
+				t.Errorf("the rolled back version is supposed to be removed, got %s", v)
+			}
+			if result := db.Range([]byte("user"), []byte("user010"), 100, 0); len(result) != 10 {
+				t.Errorf("the range in a prefix is supposed to return 10 records, got %d", len(result))
+			}
+			if result := db.Range([]byte("item015"), []byte("user005"), 100, 0); len(result) != 10 {
+				t.Errorf("the range across the prefixes is supposed to return 10 records, got %d", len(result))
+			}
+			var prev interface{} = nil
+			for i := db.memtable.Iterator(); i.HasNext(); {
+				e := i.Next()
+				if prev != nil && common.TypeMVCCBytes.ModifyCompare(prev, e.Key()) >= 0 {
+					t.Fatalf("the iterator is supposed to return the records in order")
+				}
+				prev = e.Key()
+			}
+		})
+	}
+}
+
+func TestHashMapMemtable_NilExtractor(t *testing.T) {
+	h := NewHashMapMemtable(common.TypeMVCCBytes, nil)
+	for i := 0; i < 20; i++ {
+		h.Put(common.MakeMVCCKey([]byte(fmt.Sprintf("key%03d", i)), uint64(i+1), common.OpPut, 0), []byte("v"))
+	}
+	if len(h.buckets) != 1 {
+		t.Errorf("the keys are supposed to share one bucket without the extractor, got %d buckets", len(h.buckets))
+	}
+}
+
+func TestMemtable_ConcurrentRefs(t *testing.T) {
+	memtables := map[string]Memtable{
+		"skiplist": NewSkiplistMemtable(common.TypeMVCCBytes),
+		"hashmap":  NewHashMapMemtable(common.TypeMVCCBytes, nil),
+		"vector":   NewVectorMemtable(common.TypeMVCCBytes),
+	}
+	for name, memtable := range memtables {
+		t.Run(name, func(t *testing.T) {
+			trxs := make([]*Transaction, 16)
+			for i := range trxs {
+				trxs[i] = &Transaction{}
+			}
+			var wg sync.WaitGroup
+			for _, trx := range trxs {
+				wg.Add(2)
+				go func(trx *Transaction) {
+					defer wg.Done()
+					memtable.Ref(trx)
+				}(trx)
+				go func(trx *Transaction) {
+					defer wg.Done()
+					memtable.Ref(trx)
+				}(trx)
+			}
+			wg.Wait()
+			if n := memtable.CountRefs(); n != len(trxs) {
+				t.Fatalf("each transaction is supposed to be counted once, got %d", n)
+			}
+			for _, trx := range trxs {
+				wg.Add(2)
+				go func(trx *Transaction) {
+					defer wg.Done()
+					memtable.CancelRef(trx)
+				}(trx)
+				go func(trx *Transaction) {
+					defer wg.Done()
+					memtable.CancelRef(trx)
+				}(trx)
+			}
+			wg.Wait()
+			if n := memtable.CountRefs(); n != 0 {
+				t.Errorf("the refs are supposed to be cancelled, got %d", n)
+			}
+		})
+	}
+}
+
+func TestVectorMemtable_Freeze(t *testing.T) {
+	v := NewVectorMemtable(common.TypeMVCCBytes)
+	v.Put(common.MakeMVCCKey([]byte("b"), 1, common.OpPut, 0), []byte("b1"))
+	v.Put(common.MakeMVCCKey([]byte("a"), 2, common.OpPut, 0), []byte("a2"))
+	v.Put(common.MakeMVCCKey([]byte("a"), 3, common.OpPut, 0), []byte("a3"))
+	v.Freeze()
+	if first := v.First(); string(first.Value()) != "a3" {
+		t.Errorf("the newest version of the smallest key is supposed to be the first, got %s", first.Value())
+	}
+	query := common.MakeIsoMVCCKey([]byte("a"), 2, common.OpGet, 0, common.RepeatableRead)
+	if e := v.Get(query); e == nil || string(e.Value()) != "a2" {
+		t.Errorf("the version of the snapshot is supposed to be read, got %v", e)
+	}
+}
+
+func TestMemtableIterator_Reverse(t *testing.T) {
+	factories := map[string]MemtableFactory{
+		"skiplist": SkiplistMemtableFactory(),
+		"lockfree": LockFreeMemtableFactory(),
+		"hashmap":  HashMapMemtableFactory(NewFixedPrefixExtractor(4)),
+		"vector":   VectorMemtableFactory(),
+	}
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			memtable := factory()
+			for i := 0; i < 50; i++ {
+				memtable.Put(common.MakeMVCCKey([]byte(fmt.Sprintf("key%03d", i*2)), uint64(i+1), common.OpPut, 0), []byte(fmt.Sprint(i*2)))
+			}
+			i := memtable.Iterator()
+			expected := 98
+			for i.SeekToLast(); i.Valid(); expected -= 2 {
+				if e := i.Prev(); string(e.Value()) != fmt.Sprint(expected) {
+					t.Fatalf("the reverse iteration is supposed to return %d, got %s", expected, e.Value())
+				}
+			}
+			if expected != -2 {
+				t.Errorf("the reverse iteration is supposed to return all the records, stopped at %d", expected)
+			}
+			if i.Seek(common.MakeMVCCKey([]byte("key031"), 100, common.OpGet, 0)); string(i.Value()) != "32" {
+				t.Errorf("the seek is supposed to find the key032, got %s", i.Value())
+			}
+			if i.SeekForPrev(common.MakeMVCCKey([]byte("key031"), 100, common.OpGet, 0)); string(i.Value()) != "30" {
+				t.Errorf("the seek for prev is supposed to find the key030, got %s", i.Value())
+			}
+			if e := i.Next(); string(e.Value()) != "30" || string(i.Value()) != "32" {
+				t.Errorf("the next is supposed to return the current record and move forward")
+			}
+		})
+	}
+}
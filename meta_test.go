@@ -1,6 +1,7 @@
 package drifterdb
 
 import (
+	"path/filepath"
 	"testing"
 )
 
@@ -17,4 +18,20 @@ func TestMeta_Clear(t *testing.T) {
 	a[1] = 2
 
 
-}
\ No newline at end of file
+}
+
+func TestLoadMeta_WorkDir(t *testing.T) {
+	dir := t.TempDir()
+	var m *Meta
+	for i := 0; i < 10; i++ {
+		m = LoadMeta(dir, "")
+		m.Flush()
+	}
+	if m.MetaVersion != 9 {
+		t.Errorf("wrong meta version %v", m.MetaVersion)
+	}
+	metas, _ := filepath.Glob(filepath.Join(dir, "meta*"))
+	if len(metas) > MetaBackups+1 {
+		t.Errorf("the old meta files are supposed to be cleared, got %v", metas)
+	}
+}
@@ -22,7 +22,7 @@ type Meta struct {
 }
 
 func LoadMeta(workDir string, current string) *Meta {
-	metas, err := filepath.Glob("temp/meta*")
+	metas, err := filepath.Glob(filepath.Join(workDir, "meta*"))
 	common.Throw(err)
 	if len(metas) == 0 {
 		common.Always("No meta file found. Init a new meta file.")
@@ -62,7 +62,7 @@ func LoadMeta(workDir string, current string) *Meta {
 }
 
 func (m *Meta) Clear() {
-	metas, err := filepath.Glob("temp/meta*")
+	metas, err := filepath.Glob(filepath.Join(m.WorkDir, "meta*"))
 	common.Throw(err)
 	currentMetaFilename := filepath.Join(m.WorkDir, fmt.Sprintf("meta%010d", m.MetaVersion))
 	sort.Strings(metas)
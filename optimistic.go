@@ -0,0 +1,220 @@
+package drifterdb
+
+import (
+	"bytes"
+	"github.com/LaJunkai/drifterdb/common"
+)
+
+/*
+Optimistic Transaction
+
+The writes of an optimistic transaction are buffered in its private write batch instead of the shared memtable,
+so they hold no lock before the commit and are only visible to the Get/Range of the transaction itself.
+On commit the reads of the transaction are validated against the commit log, the transaction is rolled back with
+ErrTransactionConflict if any key it read was written by a transaction committed after its snapshot.
+Otherwise the batch is written to the WAL as a single OpBatch record and applied to the active memtable with
+one commit seq, so the readers see either all or none of the writes.
+*/
+
+type commitLogEntry struct {
+	seq  uint64
+	keys [][]byte
+}
+
+// commitLog records the keys written by the committed transactions while any optimistic transaction is active.
+// It is guarded by the commitLock of the TransactionSet.
+type commitLog struct {
+	entries []*commitLogEntry
+	// active maps the id of the active optimistic transactions to their snapshot
+	active map[uint32]uint64
+}
+
+func newCommitLog() *commitLog {
+	return &commitLog{
+		entries: make([]*commitLogEntry, 0),
+		active:  make(map[uint32]uint64),
+	}
+}
+
+func (l *commitLog) Begin(trxId uint32, snapshot uint64) {
+	l.active[trxId] = snapshot
+}
+
+func (l *commitLog) End(trxId uint32) {
+	delete(l.active, trxId)
+	l.trim()
+}
+
+// Append records the keys committed with the seq, nothing is recorded if there is no active optimistic transaction.
+func (l *commitLog) Append(seq uint64, keys [][]byte) {
+	if len(l.active) == 0 || len(keys) == 0 {
+		return
+	}
+	l.entries = append(l.entries, &commitLogEntry{seq: seq, keys: keys})
+}
+
+// Validate reports whether none of the keys committed after the snapshot is in the read set.
+func (l *commitLog) Validate(snapshot uint64, reads *readSet) bool {
+	for i := len(l.entries) - 1; i >= 0 && l.entries[i].seq > snapshot; i-- {
+		for _, key := range l.entries[i].keys {
+			if reads.Contains(key) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// trim remove the entries which are visible to the snapshots of all the active optimistic transactions.
+func (l *commitLog) trim() {
+	var oldestSnapshot uint64 = 0xFFFFFFFFFFFFFFFF
+	for _, snapshot := range l.active {
+		if snapshot < oldestSnapshot {
+			oldestSnapshot = snapshot
+		}
+	}
+	i := 0
+	for ; i < len(l.entries) && l.entries[i].seq <= oldestSnapshot; i++ {
+	}
+	l.entries = l.entries[i:]
+}
+
+func (trx *Transaction) Optimistic() bool {
+	return trx.batch != nil
+}
+
+func (trx *Transaction) Get(key []byte) []byte {
+	if trx.enter() != nil {
+		return nil
+	}
+	defer trx.leave()
+	if trx.batch == nil {
+		return trx.ReadView.Get(key)
+	}
+	if op := trx.batch.Get(key); op != nil {
+		if op.kt == common.OpDelete {
+			return nil
+		}
+		return op.value
+	}
+	trx.reads.AddKey(key)
+	return trx.ReadView.Get(key)
+}
+
+func (trx *Transaction) Range(start, end []byte, count, offset int) []*Element {
+	if trx.enter() != nil {
+		return nil
+	}
+	defer trx.leave()
+	return trx.rangeWithBatch(start, end, count, offset, nil)
+}
+
+func (trx *Transaction) PrefixRange(prefix []byte, count, offset int) []*Element {
+	if trx.enter() != nil {
+		return nil
+	}
+	defer trx.leave()
+	return trx.rangeWithBatch(prefix, prefixRangeEnd(prefix), count, offset, prefix)
+}
+
+// rangeWithBatch merges the writes buffered in the batch into the range result of the snapshot.
+func (trx *Transaction) rangeWithBatch(start, end []byte, count, offset int, prefix []byte) []*Element {
+	if trx.batch == nil {
+		return trx.ReadView.rangeWithPrefix(start, end, count, offset, prefix)
+	}
+	trx.reads.AddRange(start, end)
+	ops := trx.batch.Range(start, end)
+	// fetch more records from the snapshot since they may be deleted or overwritten by the batch
+	base := trx.ReadView.rangeWithPrefix(start, end, count+offset+len(ops), 0, prefix)
+	result := make([]*Element, 0, len(base)+len(ops))
+	i := 0
+	for _, op := range ops {
+		for ; i < len(base); i++ {
+			cmp := bytes.Compare(base[i].Key().(*common.MVCCKey).Content, op.key)
+			if cmp > 0 {
+				break
+			}
+			if cmp < 0 {
+				result = append(result, base[i])
+			}
+		}
+		if op.kt == common.OpPut {
+			result = append(result, &Element{key: common.MakeMVCCKey(op.key, 0, common.OpPut, trx.trxId), value: op.value})
+		}
+	}
+	result = append(result, base[i:]...)
+	if len(result) < offset {
+		return nil
+	} else {
+		if len(result) >= offset+count {
+			return result[offset : offset+count]
+		} else {
+			return result[offset:]
+		}
+	}
+}
+
+// commitOptimistic validates the reads of the transaction and applies the batch,
+// it is supposed to be called with the commitLock of the TransactionSet held.
+func (trx *Transaction) commitOptimistic(log *commitLog, locks *LockManager) error {
+	if !log.Validate(trx.readSeq, trx.reads) {
+		return ErrTransactionConflict
+	}
+	if trx.batch.Len() == 0 {
+		return nil
+	}
+	// the keys locked by the pessimistic transactions can not be written, the keys locked here are released
+	// by the commit or the rollback of the transaction
+	for _, op := range trx.batch.ops {
+		if !locks.TryAcquire(trx.trxId, op.key) {
+			return ErrTransactionConflict
+		}
+		trx.lockedKeys = append(trx.lockedKeys, op.key)
+	}
+	db := trx.db
+	db.switchMemtableLock.RLock()
+	defer db.switchMemtableLock.RUnlock()
+	db.memtable.Ref(trx)
+	trx.refTables = append(trx.refTables, db.memtable)
+	unlock := db.lockMemtable()
+	defer unlock()
+	// the writes are invisible until the commit of the transaction clears their TrxId,
+	// so the readers see either all or none of them even if the memtableLock is shared
+	trx.recordLock.Lock()
+	commitSeq := db.getSeq()
+	for _, op := range trx.batch.ops {
+		trx.modificationRecord = append(trx.modificationRecord, &TrxOpRecord{
+			table: db.memtable,
+			key:   common.MakeMVCCKey(op.key, commitSeq, op.kt, trx.trxId),
+			value: op.value,
+		})
+	}
+	trx.recordLock.Unlock()
+	// the batch is logged before it is applied as the db.put does, so that no applied write is lost by a crash
+	length := db.wal.Append(common.OperationRecord(
+		common.OpBatch, common.MakeMVCCKey([]byte{}, commitSeq, common.OpBatch, 0), trx.batch.Encode(),
+	))
+	db.wal.Flush()
+	// the keys are locked and the commitSeq is unique, so the logged writes never conflict
+	for _, r := range trx.modificationRecord {
+		db.memtable.Put(r.key, r.value)
+	}
+	log.Append(commitSeq, trx.batch.Keys())
+	db.memtable.IncreaseBytesSize(int(length))
+	if m := db.option.WriteBufferManager; m != nil {
+		m.reserveActive(db, db.memtable.BytesSize())
+	}
+	if db.memtable.BytesSize() > db.option.MemtableSize {
+		db.FrozeMemtable()
+	}
+	return nil
+}
+
+// writtenKeys returns the keys written by the pessimistic transaction.
+func (trx *Transaction) writtenKeys() [][]byte {
+	keys := make([][]byte, 0, len(trx.modificationRecord))
+	for _, r := range trx.modificationRecord {
+		keys = append(keys, r.key.Content)
+	}
+	return keys
+}
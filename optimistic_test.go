@@ -0,0 +1,125 @@
+package drifterdb
+
+import (
+	"bytes"
+	"github.com/LaJunkai/drifterdb/common"
+	"testing"
+)
+
+func TestWriteBatch_Encode(t *testing.T) {
+	b := newWriteBatch()
+	b.Put([]byte("a"), []byte("1"))
+	b.Put([]byte("b"), []byte("2"))
+	b.Delete([]byte("c"))
+	b.Put([]byte("a"), []byte("3"))
+	decoded := decodeWriteBatch(b.Encode())
+	if decoded.Len() != 3 {
+		t.Fatalf("the batch is supposed to contain 3 records, got %v", decoded.Len())
+	}
+	for _, op := range b.ops {
+		got := decoded.Get(op.key)
+		if got == nil || got.kt != op.kt || !bytes.Equal(got.value, op.value) {
+			t.Errorf("the record of %s is not decoded correctly", op.key)
+		}
+	}
+}
+
+func TestWriteBatch_ReuseBuffer(t *testing.T) {
+	b := newWriteBatch()
+	key, value := []byte("a"), []byte("1")
+	b.Put(key, value)
+	copy(key, "b")
+	copy(value, "2")
+	if op := b.Get([]byte("a")); op == nil || string(op.key) != "a" || string(op.value) != "1" {
+		t.Errorf("the batch is supposed to keep the write of the reused buffers, got %v", op)
+	}
+}
+
+func TestOptimisticTransaction_ReadYourWrites(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	db.Put([]byte("k1"), []byte("v1"))
+	db.Put([]byte("k2"), []byte("v2"))
+	db.Put([]byte("k3"), []byte("v3"))
+	trx := db.StartOptimisticTransaction()
+	trx.Put([]byte("k2"), []byte("new"))
+	trx.Put([]byte("k4"), []byte("v4"))
+	trx.Delete([]byte("k3"))
+	if v := trx.Get([]byte("k2")); string(v) != "new" {
+		t.Errorf("the transaction is supposed to read its own write, got %s", v)
+	}
+	if v := trx.Get([]byte("k3")); v != nil {
+		t.Errorf("the transaction is supposed to read its own delete, got %s", v)
+	}
+	if v := db.Get([]byte("k2")); string(v) != "v2" {
+		t.Errorf("the buffered write is not supposed to be visible to others, got %s", v)
+	}
+	expected := []string{"k1=v1", "k2=new", "k4=v4"}
+	result := trx.Range([]byte("k"), []byte("l"), 10, 0)
+	if len(result) != len(expected) {
+		t.Fatalf("the range is supposed to return %v records, got %v", len(expected), len(result))
+	}
+	for i, e := range result {
+		if got := string(e.Key().(*common.MVCCKey).Content) + "=" + string(e.Value()); got != expected[i] {
+			t.Errorf("the range is supposed to return %v at %v, got %v", expected[i], i, got)
+		}
+	}
+	if err := db.CommitTransaction(trx); err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	if v := db.Get([]byte("k4")); string(v) != "v4" {
+		t.Errorf("the committed write is supposed to be visible, got %s", v)
+	}
+	if v := db.Get([]byte("k3")); v != nil {
+		t.Errorf("the committed delete is supposed to be visible, got %s", v)
+	}
+}
+
+func TestOptimisticTransaction_Conflict(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	db.Put([]byte("balance"), []byte("100"))
+	t1 := db.StartOptimisticTransaction()
+	t2 := db.StartOptimisticTransaction()
+	t1.Get([]byte("balance"))
+	t2.Get([]byte("balance"))
+	t1.Put([]byte("balance"), []byte("50"))
+	t2.Put([]byte("balance"), []byte("70"))
+	if err := db.CommitTransaction(t1); err != nil {
+		t.Fatalf("the first commit is supposed to succeed, got %v", err)
+	}
+	if err := db.CommitTransaction(t2); err != ErrTransactionConflict {
+		t.Errorf("the second commit is supposed to fail with the conflict, got %v", err)
+	}
+	if v := db.Get([]byte("balance")); string(v) != "50" {
+		t.Errorf("the write of the failed transaction is not supposed to be applied, got %s", v)
+	}
+	// the blind writes are not validated
+	err := db.WithOptimisticTransaction(func(trx *Transaction) {
+		trx.Put([]byte("balance"), []byte("0"))
+	})
+	if err != nil {
+		t.Errorf("the blind write is supposed to succeed, got %v", err)
+	}
+}
+
+func TestOpenDB_RecoverBatch(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir, nil)
+	err := db.WithOptimisticTransaction(func(trx *Transaction) {
+		trx.Put([]byte("x"), []byte("1"))
+		trx.Put([]byte("y"), []byte("2"))
+	})
+	if err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	db.Close()
+	recovered := OpenDB(dir)
+	defer recovered.Close()
+	if v := recovered.Get([]byte("x")); string(v) != "1" {
+		t.Errorf("the batch is supposed to be recovered from the WAL, got %s", v)
+	}
+	if v := recovered.Get([]byte("y")); string(v) != "2" {
+		t.Errorf("the batch is supposed to be recovered from the WAL, got %s", v)
+	}
+}
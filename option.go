@@ -1,5 +1,7 @@
 package drifterdb
 
+import "time"
+
 type Option struct {
 	// MemtableSize is the max bytes size of the memtable.
 	// levels is the max level of the lsm-tree.
@@ -7,12 +9,57 @@ type Option struct {
 	// synchronousWAL controls whether the WAL is always flushed to the disk synchronously or flushed asynchronously.
 	// separateKV is a option to control whether the WiscKey mode is on.
 	// noCompaction would make db block all compaction job and improve write performance significantly.
-	MemtableSize       int  `json:"memtable_size"`
-	Levels             int  `json:"levels"`
-	AmplificationRatio int  `json:"amplification_ratio"`
-	SynchronousWAL     bool `json:"synchronous_wal"`
-	SeparateKV         bool `json:"separate_kv"`
-	NoCompaction       bool `json:"no_compaction"`
+	// partitionedIndex makes the tables dumped with a two-level index and partitioned filters.
+	// indexPartitionSize is the max bytes size of an index partition.
+	// blockCacheSize is the capacity (in bytes) of the cache of index partitions and filters.
+	// filterPolicy builds the filters of the tables, no filter would be built if it is nil.
+	// levelFilterPolicies overrides the filterPolicy of the tables of each level if the element is not nil,
+	// only the policy of the level 0 takes effect for now since the tables are only dumped to the level 0
+	// and the compaction does not write the tables of the lower levels yet.
+	// prefixExtractor extracts the prefixes of the keys which are added into the filters for the prefix range.
+	// tablePropertiesCollectors create the collectors of the user defined properties for each dumped table.
+	// lockFreeMemtable makes the memtables lock-free skip lists which accept the concurrent inserts.
+	// memtableFactory creates the memtables, it overrides the lockFreeMemtable if it is not nil.
+	// writeBufferManager caps the memory of the memtables of all the dbs sharing it, no cap if it is nil.
+	// level0SlowdownWritesTrigger and level0StopWritesTrigger are the numbers of the level-0 tables which delay and
+	// stop the writes, unflushedMemtablesSlowdownTrigger and maxUnflushedMemtables are the numbers of the frozen and
+	// immutable memtables which delay and stop the writes,
+	// and the soft and hard pendingCompactionBytesLimit are the estimated compaction debts which delay and stop them.
+	// A trigger is disabled if it is not positive. delayedWriteRate is the bytes per second of the delayed writes.
+	// onWriteStall is called by the background goroutines once the condition of the writes changes.
+	// maxBackgroundFlushes is the number of the workers dumping the immutable memtables concurrently.
+	// lockTimeout is the default max duration a transaction waits for a row lock, it waits for ever if not positive.
+	// transactionTimeout is the default max lifetime of a transaction, the expired transactions are rolled back,
+	// the transactions never expire by the time if it is not positive.
+	MemtableSize       int           `json:"memtable_size"`
+	Levels             int           `json:"levels"`
+	AmplificationRatio int           `json:"amplification_ratio"`
+	SynchronousWAL     bool          `json:"synchronous_wal"`
+	SeparateKV         bool          `json:"separate_kv"`
+	NoCompaction       bool          `json:"no_compaction"`
+	PartitionedIndex   bool          `json:"partitioned_index"`
+	IndexPartitionSize int           `json:"index_partition_size"`
+	BlockCacheSize     int           `json:"block_cache_size"`
+	LockFreeMemtable   bool          `json:"lock_free_memtable"`
+	LockTimeout        time.Duration `json:"lock_timeout"`
+	TransactionTimeout time.Duration `json:"transaction_timeout"`
+
+	Level0SlowdownWritesTrigger       int   `json:"level0_slowdown_writes_trigger"`
+	Level0StopWritesTrigger           int   `json:"level0_stop_writes_trigger"`
+	MaxUnflushedMemtables             int   `json:"max_unflushed_memtables"`
+	UnflushedMemtablesSlowdownTrigger int   `json:"unflushed_memtables_slowdown_trigger"`
+	SoftPendingCompactionBytesLimit   int64 `json:"soft_pending_compaction_bytes_limit"`
+	HardPendingCompactionBytesLimit   int64 `json:"hard_pending_compaction_bytes_limit"`
+	DelayedWriteRate                  int   `json:"delayed_write_rate"`
+	MaxBackgroundFlushes              int   `json:"max_background_flushes"`
+
+	FilterPolicy              FilterPolicy                      `json:"-"`
+	LevelFilterPolicies       []FilterPolicy                    `json:"-"`
+	PrefixExtractor           PrefixExtractor                   `json:"-"`
+	TablePropertiesCollectors []TablePropertiesCollectorFactory `json:"-"`
+	MemtableFactory           MemtableFactory                   `json:"-"`
+	WriteBufferManager        *WriteBufferManager               `json:"-"`
+	OnWriteStall              func(info WriteStallInfo)         `json:"-"`
 }
 
 const (
@@ -22,6 +69,7 @@ const (
 	TB                        = 1 << 40
 	DefaultLevels             = 7
 	DefaultAmplificationRatio = 1 << 3
+	DefaultBlockCacheSize     = 8 * MB
 )
 
 func DefaultOption() *Option {
@@ -32,5 +80,29 @@ func DefaultOption() *Option {
 		SynchronousWAL:     true,
 		SeparateKV:         true,
 		NoCompaction:       false,
+		PartitionedIndex:   false,
+		IndexPartitionSize: DefaultIndexPartitionSize,
+		BlockCacheSize:     DefaultBlockCacheSize,
+		LockTimeout:        DefaultLockTimeout,
+		TransactionTimeout: DefaultTransactionTimeout,
+
+		Level0SlowdownWritesTrigger:       DefaultLevel0SlowdownWritesTrigger,
+		Level0StopWritesTrigger:           DefaultLevel0StopWritesTrigger,
+		MaxUnflushedMemtables:             DefaultMaxUnflushedMemtables,
+		UnflushedMemtablesSlowdownTrigger: DefaultUnflushedMemtablesSlowdownTrigger,
+		SoftPendingCompactionBytesLimit:   DefaultSoftPendingCompactionBytesLimit,
+		HardPendingCompactionBytesLimit:   DefaultHardPendingCompactionBytesLimit,
+		DelayedWriteRate:                  DefaultDelayedWriteRate,
+		MaxBackgroundFlushes:              DefaultMaxBackgroundFlushes,
+		FilterPolicy:                      NewBloomFilterPolicy(DefaultBloomBitsPerKey),
+	}
+}
+
+// FilterPolicyOf returns the filter policy of the tables of the level,
+// it is only called with the level 0 by the flushes until the compaction writes the tables of the lower levels.
+func (o *Option) FilterPolicyOf(level int) FilterPolicy {
+	if level < len(o.LevelFilterPolicies) && o.LevelFilterPolicies[level] != nil {
+		return o.LevelFilterPolicies[level]
 	}
+	return o.FilterPolicy
 }
@@ -0,0 +1,312 @@
+package drifterdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/LaJunkai/drifterdb/bloomfilter"
+	"github.com/LaJunkai/drifterdb/common"
+	"sort"
+)
+
+/*
+PartitionedIndex is a two-level BlockIndex for large tables.
+The top-level index is small enough to be kept in memory, every record of it points to an index partition
+and the filter of the keys in the partition. Partitions and filters are loaded on demand through the block cache.
+
+top-level index record
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+|        key length         |                   partition offset                    |    partition size...
+
+| 16   | 17   | 18   | 19   | 20   | 21   | 22   | 23   | 24   | 25   | 26   | 27   | 28   | 29   | 30   | 31   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+     partition size        |                     filter offset                     |      filter size...
+
+| 32   | 33   | 34   | 35   | 36   | 37   | 38   | 39   | 40   | 41   | 42   | 43   | 44   | 45   | 46   | 47   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+       filter size         |     first block index     |        block count        |          key......
+
+
+index partition record (offset is relative to the data block)
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+|        key length         |                         offset                        |       size......
+
+| 16   | 17   | 18   | 19   | 20   | 21   | 22   | 23   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+           size            |          key......
+*/
+
+const (
+	PartitionedIndexBlockName = "index.partitioned"
+	DefaultIndexPartitionSize = 1 << 12
+)
+
+type indexPartition struct {
+	minRecord  []byte
+	firstBlock int
+	index      Block
+	filter     Block
+}
+
+type PartitionedIndex struct {
+	maxKey     []byte
+	minKey     []byte
+	table      *Table
+	partitions []*indexPartition
+	nBlocks    int
+	baseOffset uint64
+}
+
+func (p *PartitionedIndex) Min() []byte {
+	return common.ParseMVCCKey(p.minKey).Content
+}
+
+func (p *PartitionedIndex) Max() []byte {
+	return common.ParseMVCCKey(p.maxKey).Content
+}
+
+// partitionOf returns the last partition whose min record is no larger than the key.
+func (p *PartitionedIndex) partitionOf(key []byte) int {
+	i := sort.Search(len(p.partitions), func(i int) bool {
+		return bytes.Compare(common.ExtractMVCCKeyContent(p.partitions[i].minRecord), key) > 0
+	})
+	if i > 0 {
+		i -= 1
+	}
+	return i
+}
+
+func (p *PartitionedIndex) Find(key []byte) (int, *Block) {
+	if len(p.partitions) == 0 || common.TypeBytes.QueryCompare(key, p.Min()) < 0 || common.TypeBytes.QueryCompare(key, p.Max()) > 0 {
+		return -1, nil
+	}
+	partition := p.partitions[p.partitionOf(key)]
+	blocks := p.loadPartition(partition)
+	i := sort.Search(len(blocks), func(i int) bool {
+		return bytes.Compare(common.ExtractMVCCKeyContent(blocks[i].minRecord), key) > 0
+	})
+	if i > 0 {
+		i -= 1
+	}
+	return partition.firstBlock + i, &blocks[i].Block
+}
+
+func (p *PartitionedIndex) GetByIndex(index int) *Block {
+	if index < 0 || index >= p.nBlocks {
+		return nil
+	}
+	i := sort.Search(len(p.partitions), func(i int) bool {
+		return p.partitions[i].firstBlock > index
+	}) - 1
+	blocks := p.loadPartition(p.partitions[i])
+	return &blocks[index-p.partitions[i].firstBlock].Block
+}
+
+func (p *PartitionedIndex) SetBaseOffset(baseOffset uint64) {
+	p.baseOffset = baseOffset
+}
+
+// KeyMayMatch check the filter of the partition which may contains the key.
+func (p *PartitionedIndex) KeyMayMatch(key []byte) bool {
+	if len(p.partitions) == 0 {
+		return false
+	}
+	partition := p.partitions[p.partitionOf(key)]
+	if partition.filter.size == 0 {
+		return true
+	}
+	filter := p.loadFilter(partition)
+	return filter == nil || filter.Exists(key)
+}
+
+// BlockMayMatch check the filter of the partition which contains the block.
+func (p *PartitionedIndex) BlockMayMatch(index int, key []byte) bool {
+	i := sort.Search(len(p.partitions), func(i int) bool {
+		return p.partitions[i].firstBlock > index
+	}) - 1
+	if i < 0 || p.partitions[i].filter.size == 0 {
+		return true
+	}
+	filter := p.loadFilter(p.partitions[i])
+	return filter == nil || filter.Exists(key)
+}
+
+func (p *PartitionedIndex) loadPartition(partition *indexPartition) []*IBlock {
+	cache := p.table.cache
+	if cache != nil {
+		if v, found := cache.Get(p.table.FullPath(), partition.index.offset); found {
+			return v.([]*IBlock)
+		}
+	}
+	partitionBytes := partition.index.LoadBytes()
+	blocks := make([]*IBlock, 0)
+	var cursor uint64 = 0
+	for cursor < uint64(len(partitionBytes)) {
+		keyLength := uint64(binary.LittleEndian.Uint32(partitionBytes[cursor : cursor+4]))
+		offset := binary.LittleEndian.Uint64(partitionBytes[cursor+4 : cursor+12])
+		size := binary.LittleEndian.Uint64(partitionBytes[cursor+12 : cursor+20])
+		cursor += 20
+		key := make([]byte, keyLength)
+		cursor += uint64(copy(key, partitionBytes[cursor:cursor+keyLength]))
+		blocks = append(blocks, &IBlock{
+			Block:     Block{offset: offset + p.baseOffset, size: size, table: p.table},
+			minRecord: key,
+		})
+	}
+	if cache != nil {
+		cache.Put(p.table.FullPath(), partition.index.offset, blocks, len(partitionBytes))
+	}
+	return blocks
+}
+
+func (p *PartitionedIndex) loadFilter(partition *indexPartition) bloomfilter.Filter {
+	cache := p.table.cache
+	if cache != nil {
+		if v, found := cache.Get(p.table.FullPath(), partition.filter.offset); found {
+			return v.(bloomfilter.Filter)
+		}
+	}
+	filterBytes := partition.filter.LoadBytes()
+	filter := loadTableFilter(filterBytes)
+	if cache != nil && filter != nil {
+		cache.Put(p.table.FullPath(), partition.filter.offset, filter, len(filterBytes))
+	}
+	return filter
+}
+
+func NewPartitionedIndex(topLevelBytes []byte, table *Table, minKey, maxKey []byte) *PartitionedIndex {
+	idx := &PartitionedIndex{
+		maxKey:     maxKey,
+		minKey:     minKey,
+		table:      table,
+		partitions: make([]*indexPartition, 0),
+	}
+	var cursor uint64 = 0
+	for cursor < uint64(len(topLevelBytes)) {
+		keyLength := uint64(binary.LittleEndian.Uint32(topLevelBytes[cursor : cursor+4]))
+		partition := &indexPartition{
+			index: Block{
+				offset: binary.LittleEndian.Uint64(topLevelBytes[cursor+4 : cursor+12]),
+				size:   binary.LittleEndian.Uint64(topLevelBytes[cursor+12 : cursor+20]),
+				table:  table,
+			},
+			filter: Block{
+				offset: binary.LittleEndian.Uint64(topLevelBytes[cursor+20 : cursor+28]),
+				size:   binary.LittleEndian.Uint64(topLevelBytes[cursor+28 : cursor+36]),
+				table:  table,
+			},
+			firstBlock: int(binary.LittleEndian.Uint32(topLevelBytes[cursor+36 : cursor+40])),
+		}
+		idx.nBlocks = partition.firstBlock + int(binary.LittleEndian.Uint32(topLevelBytes[cursor+40:cursor+44]))
+		cursor += 44
+		partition.minRecord = make([]byte, keyLength)
+		cursor += uint64(copy(partition.minRecord, topLevelBytes[cursor:cursor+keyLength]))
+		idx.partitions = append(idx.partitions, partition)
+	}
+	return idx
+}
+
+// partitionedIndexBuilder build the index partitions and their filters during dumping the table.
+type partitionedIndexBuilder struct {
+	partitionSize int
+	filterPolicy  FilterPolicy
+	extractor     PrefixExtractor
+	partitions    []*partitionBuilder
+	nBlocks       int
+	// indexSize and filterSize are the total bytes size of the index and filters after Finish.
+	indexSize  uint64
+	filterSize uint64
+}
+
+type partitionBuilder struct {
+	minRecord  []byte
+	firstBlock int
+	records    []*IBlock
+	size       int
+	keys       *filterKeysBuilder
+}
+
+func newPartitionedIndexBuilder(partitionSize int, filterPolicy FilterPolicy, extractor PrefixExtractor) *partitionedIndexBuilder {
+	if partitionSize <= 0 {
+		partitionSize = DefaultIndexPartitionSize
+	}
+	return &partitionedIndexBuilder{
+		partitionSize: partitionSize,
+		filterPolicy:  filterPolicy,
+		extractor:     extractor,
+		partitions:    make([]*partitionBuilder, 0),
+	}
+}
+
+// AddBlock is supposed to be called when a new data block starts, offset is relative to the data block.
+func (b *partitionedIndexBuilder) AddBlock(minRecord []byte, offset uint64) {
+	if len(b.partitions) == 0 || b.partitions[len(b.partitions)-1].size >= b.partitionSize {
+		b.partitions = append(b.partitions, &partitionBuilder{
+			minRecord:  minRecord,
+			firstBlock: b.nBlocks,
+			records:    make([]*IBlock, 0),
+			keys:       newFilterKeysBuilder(b.extractor),
+		})
+	}
+	current := b.partitions[len(b.partitions)-1]
+	current.records = append(current.records, &IBlock{Block: Block{offset: offset}, minRecord: minRecord})
+	current.size += 20 + len(minRecord)
+	b.nBlocks += 1
+}
+
+// AddKey add the key content (and its prefix) to the filter of the current partition.
+func (b *partitionedIndexBuilder) AddKey(content []byte) {
+	b.partitions[len(b.partitions)-1].keys.Add(content)
+}
+
+// Finish append partitions and filters to the table extension and return the top-level index bytes.
+func (b *partitionedIndexBuilder) Finish(ext *tableExtension, dataLength uint64) []byte {
+	topLevelBytes := make([]byte, 0)
+	for i, partition := range b.partitions {
+		// setup the size of the blocks
+		for j, record := range partition.records {
+			if j+1 < len(partition.records) {
+				record.size = partition.records[j+1].offset - record.offset
+			} else if i+1 < len(b.partitions) {
+				record.size = b.partitions[i+1].records[0].offset - record.offset
+			} else {
+				record.size = dataLength - record.offset
+			}
+		}
+		partitionBytes := make([]byte, 0, partition.size)
+		for _, record := range partition.records {
+			partitionBytes = append(partitionBytes, PartitionIndexRecord(record.minRecord, record.offset, record.size)...)
+		}
+		filterBytes := make([]byte, 0)
+		if b.filterPolicy != nil {
+			filterBytes = b.filterPolicy.CreateFilter(partition.keys.keys)
+		}
+		partitionOffset := ext.Append(partitionBytes)
+		filterOffset := ext.Append(filterBytes)
+		record := make([]byte, 44+len(partition.minRecord))
+		binary.LittleEndian.PutUint32(record[0:4], uint32(len(partition.minRecord)))
+		binary.LittleEndian.PutUint64(record[4:12], partitionOffset)
+		binary.LittleEndian.PutUint64(record[12:20], uint64(len(partitionBytes)))
+		binary.LittleEndian.PutUint64(record[20:28], filterOffset)
+		binary.LittleEndian.PutUint64(record[28:36], uint64(len(filterBytes)))
+		binary.LittleEndian.PutUint32(record[36:40], uint32(partition.firstBlock))
+		binary.LittleEndian.PutUint32(record[40:44], uint32(len(partition.records)))
+		copy(record[44:], partition.minRecord)
+		topLevelBytes = append(topLevelBytes, record...)
+		b.indexSize += uint64(len(partitionBytes))
+		b.filterSize += uint64(len(filterBytes))
+	}
+	b.indexSize += uint64(len(topLevelBytes))
+	ext.AppendNamed(PartitionedIndexBlockName, topLevelBytes)
+	return topLevelBytes
+}
+
+func PartitionIndexRecord(key []byte, offset, size uint64) []byte {
+	recordBytes := make([]byte, 4+8+8+len(key))
+	binary.LittleEndian.PutUint32(recordBytes[:4], uint32(len(key)))
+	binary.LittleEndian.PutUint64(recordBytes[4:12], offset)
+	binary.LittleEndian.PutUint64(recordBytes[12:20], size)
+	copy(recordBytes[20:], key)
+	return recordBytes
+}
@@ -0,0 +1,120 @@
+package drifterdb
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// PrefixExtractor extracts the prefix of the user keys, the prefixes are added into the filters of the tables
+// so that the prefix range can skip the tables and blocks which contain no key with the prefix.
+// InDomain reports whether the key has a prefix, Transform is only called on the keys in domain.
+type PrefixExtractor interface {
+	Name() string
+	Transform(key []byte) []byte
+	InDomain(key []byte) bool
+}
+
+// FixedPrefixExtractor takes the first length bytes of the key as the prefix.
+type FixedPrefixExtractor struct {
+	length int
+}
+
+func NewFixedPrefixExtractor(length int) *FixedPrefixExtractor {
+	return &FixedPrefixExtractor{length: length}
+}
+
+func (e *FixedPrefixExtractor) Name() string {
+	return fmt.Sprintf("fixed:%d", e.length)
+}
+
+func (e *FixedPrefixExtractor) Transform(key []byte) []byte {
+	return key[:e.length]
+}
+
+func (e *FixedPrefixExtractor) InDomain(key []byte) bool {
+	return len(key) >= e.length
+}
+
+// prefixSuccessor returns the smallest key larger than all the keys with the prefix,
+// nil is returned if there is no such key (the prefix is empty or consists of 0xFF).
+func prefixSuccessor(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			successor := make([]byte, i+1)
+			copy(successor, prefix)
+			successor[i] += 1
+			return successor
+		}
+	}
+	return nil
+}
+
+// prefixRangeEndPadding is the number of the 0xFF appended to the prefix which has no successor.
+const prefixRangeEndPadding = 1 << 8
+
+// prefixRangeEnd returns the exclusive end of the range of the keys with the prefix.
+func prefixRangeEnd(prefix []byte) []byte {
+	if successor := prefixSuccessor(prefix); successor != nil {
+		return successor
+	}
+	// no successor, use a key large enough instead
+	return bytes.Repeat([]byte{0xFF}, len(prefix)+prefixRangeEndPadding)
+}
+
+// filterKeysBuilder collects the distinct user keys and their prefixes in order to build the filter.
+type filterKeysBuilder struct {
+	keys       [][]byte
+	extractor  PrefixExtractor
+	lastKey    []byte
+	lastPrefix []byte
+	hasKey     bool
+	hasPrefix  bool
+}
+
+func newFilterKeysBuilder(extractor PrefixExtractor) *filterKeysBuilder {
+	return &filterKeysBuilder{
+		keys:      make([][]byte, 0),
+		extractor: extractor,
+	}
+}
+
+// Add is supposed to be called in the order of the keys so that the duplicated keys are adjacent.
+func (b *filterKeysBuilder) Add(content []byte) {
+	if !b.hasKey || !bytes.Equal(b.lastKey, content) {
+		b.keys = append(b.keys, content)
+		b.lastKey, b.hasKey = content, true
+	}
+	if b.extractor != nil && b.extractor.InDomain(content) {
+		prefix := b.extractor.Transform(content)
+		if !b.hasPrefix || !bytes.Equal(b.lastPrefix, prefix) {
+			b.keys = append(b.keys, prefix)
+			b.lastPrefix, b.hasPrefix = prefix, true
+		}
+	}
+}
+
+// prefixProbe returns the key to probe the filters of the table for the prefix range,
+// nil is returned if the filters of the table can not be used.
+func (t *Table) prefixProbe(prefix []byte, extractor PrefixExtractor) []byte {
+	if extractor == nil || t.properties == nil || t.properties.PrefixExtractor != extractor.Name() {
+		return nil
+	}
+	if !extractor.InDomain(prefix) {
+		return nil
+	}
+	return extractor.Transform(prefix)
+}
+
+// PrefixRange returns the elements whose key starts with the prefix.
+func (rv *ReadView) PrefixRange(prefix []byte, count, offset int) []*Element {
+	return rv.rangeWithPrefix(prefix, prefixRangeEnd(prefix), count, offset, prefix)
+}
+
+func (db *DrifterDB) PrefixRange(prefix []byte, count, offset int) (v []*Element) {
+	db.WithTransaction(func(trx *Transaction) {
+		if result := trx.PrefixRange(prefix, count, offset); result != nil {
+			v = result
+		}
+	})
+	return
+}
@@ -0,0 +1,69 @@
+package drifterdb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"testing"
+)
+
+func TestTable_PrefixRange(t *testing.T) {
+	memtable := NewSkiplistMemtable(common.TypeMVCCBytes)
+	var seq uint64 = 1
+	for u := 0; u < 100; u += 2 {
+		for i := 0; i < 50; i++ {
+			key := common.MakeMVCCKey([]byte(fmt.Sprintf("u%03d:%04d", u, i)), seq, common.OpPut, 0)
+			memtable.Put(key, []byte(fmt.Sprintf("value-%v", seq)))
+			seq += 1
+		}
+	}
+	extractor := NewFixedPrefixExtractor(5)
+	for _, partitioned := range []bool{false, true} {
+		option := DefaultOption()
+		option.PrefixExtractor = extractor
+		option.PartitionedIndex = partitioned
+		option.IndexPartitionSize = 128
+		dir := t.TempDir()
+		DumpTableWithOption(memtable, dir, 1, 0, option)
+		table := LoadTable(TableFullPath(dir, 0, 1))
+		if table.Properties().PrefixExtractor != extractor.Name() {
+			t.Fatalf("wrong prefix extractor %v", table.Properties().PrefixExtractor)
+		}
+		rejected := 0
+		for u := 0; u < 100; u++ {
+			prefix := []byte(fmt.Sprintf("u%03d:", u))
+			start := common.MakeMVCCKey(prefix, seq, common.OpGet, 0)
+			end := common.MakeMVCCKey(prefixRangeEnd(prefix), seq, common.OpGet, 0)
+			result := table.rangeWithPrefix(start, end, 100, 0, prefix, extractor)
+			if u%2 == 1 {
+				if len(result) != 0 {
+					t.Errorf("no key is supposed to be found with prefix %v", string(prefix))
+				}
+				if !table.keyMayMatch(prefix) {
+					rejected += 1
+				}
+				continue
+			}
+			if len(result) != 50 {
+				t.Errorf("50 keys are supposed to be found with prefix %v, got %v", string(prefix), len(result))
+			}
+			for _, e := range result {
+				if !bytes.HasPrefix(e.Key().(*common.MVCCKey).Content, prefix) {
+					t.Errorf("%v is not supposed to be found with prefix %v", string(e.Key().(*common.MVCCKey).Content), string(prefix))
+				}
+			}
+		}
+		if rejected < 40 {
+			t.Errorf("the absent prefixes are supposed to be rejected by the filters, got %v/50", rejected)
+		}
+	}
+}
+
+func TestPrefixSuccessor(t *testing.T) {
+	if s := prefixSuccessor([]byte("ab\xff")); !bytes.Equal(s, []byte("ac")) {
+		t.Errorf("wrong successor %v", s)
+	}
+	if s := prefixSuccessor([]byte("\xff\xff")); s != nil {
+		t.Errorf("no successor is supposed to be found, got %v", s)
+	}
+}
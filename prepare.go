@@ -0,0 +1,289 @@
+package drifterdb
+
+import (
+	"encoding/binary"
+	"github.com/LaJunkai/drifterdb/common"
+	"sort"
+	"sync/atomic"
+)
+
+/*
+Two-Phase Commit
+
+Prepare writes the write set of the transaction to the WAL as an OpPrepare record named by the external coordinator,
+the transaction keeps its locks and its uncommitted versions until it is committed or rolled back by the name,
+which writes an OpCommitPrepared or an OpRollbackPrepared record.
+
+The versions written by a transaction are logged before it is prepared, so the recovery skips the logged versions
+of the prepared transactions which are rolled back or not resolved, the unresolved ones are rebuilt as prepared
+transactions holding the locks of their keys.
+*/
+
+// preparedOp is a version written by a prepared transaction.
+type preparedOp struct {
+	seq   uint64
+	kt    uint8
+	key   []byte
+	value []byte
+}
+
+// encodePrepared dumps the write records as the value of the OpPrepare WAL record:
+// count | [ seq | kt | key length | key | value length | value ] ...
+func encodePrepared(records []*TrxOpRecord) []byte {
+	size := binary.MaxVarintLen64
+	for _, r := range records {
+		size += 1 + 3*binary.MaxVarintLen64 + len(r.key.Content) + len(r.value)
+	}
+	buf := make([]byte, size)
+	i := binary.PutUvarint(buf, uint64(len(records)))
+	for _, r := range records {
+		i += binary.PutUvarint(buf[i:], r.key.Seq)
+		buf[i] = r.key.KT
+		i += 1
+		i += binary.PutUvarint(buf[i:], uint64(len(r.key.Content)))
+		i += copy(buf[i:], r.key.Content)
+		i += binary.PutUvarint(buf[i:], uint64(len(r.value)))
+		i += copy(buf[i:], r.value)
+	}
+	return buf[:i]
+}
+
+func decodePrepared(src []byte) []*preparedOp {
+	count, i := binary.Uvarint(src)
+	ops := make([]*preparedOp, 0, count)
+	for ; count > 0; count-- {
+		seq, n := binary.Uvarint(src[i:])
+		i += n
+		kt := src[i]
+		i += 1
+		keyLength, n := binary.Uvarint(src[i:])
+		i += n
+		key := src[i : i+int(keyLength)]
+		i += int(keyLength)
+		valueLength, n := binary.Uvarint(src[i:])
+		i += n
+		value := src[i : i+int(valueLength)]
+		i += int(valueLength)
+		ops = append(ops, &preparedOp{seq: seq, kt: kt, key: key, value: value})
+	}
+	return ops
+}
+
+// Prepare makes the transaction durable without committing it, the prepared transaction survives the restart
+// and is supposed to be committed or rolled back by the name through CommitPrepared or RollbackPrepared.
+func (trx *Transaction) Prepare(name string) error {
+	return trx.db.transactionSet.PrepareTransaction(trx, name)
+}
+
+// Name returns the name given to Prepare, it is empty if the transaction is not prepared.
+func (trx *Transaction) Name() string {
+	return trx.prepared
+}
+
+// PrepareTransaction prepares the transaction with the name, the serializable transaction is validated here
+// and is rolled back with ErrSerializationFailure if it fails the validation.
+func (ts *TransactionSet) PrepareTransaction(trx *Transaction, name string) error {
+	if trx.batch != nil {
+		return ErrPrepareOptimistic
+	}
+	if trx.prepared != "" {
+		return ErrTransactionPrepared
+	}
+	ts.preparedLock.Lock()
+	defer ts.preparedLock.Unlock()
+	if _, ok := ts.prepared[name]; ok {
+		return ErrDuplicatePreparedName
+	}
+	if trx.ctx.Err() != nil {
+		ts.expire(trx)
+	}
+	// the prepared transaction is not expired any more
+	if !atomic.CompareAndSwapInt32(&trx.state, trxActive, trxPrepared) {
+		return ErrTxnExpired
+	}
+	if trx.ssi != nil {
+		if err := ts.ssi.Prepare(trx.ssi); err != nil {
+			trx.ssi = nil
+			atomic.StoreInt32(&trx.state, trxFinished)
+			ts.rollbackTransaction(trx)
+			return err
+		}
+	}
+	trx.preparedOffset = ts.db.logPrepared(common.OpPrepare, name, encodePrepared(trx.modificationRecord))
+	trx.prepared = name
+	ts.prepared[name] = trx
+	return nil
+}
+
+// GetPreparedTransactions returns the prepared transactions ordered by the name.
+func (ts *TransactionSet) GetPreparedTransactions() []*Transaction {
+	ts.preparedLock.Lock()
+	defer ts.preparedLock.Unlock()
+	result := make([]*Transaction, 0, len(ts.prepared))
+	for _, trx := range ts.prepared {
+		result = append(result, trx)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].prepared < result[j].prepared
+	})
+	return result
+}
+
+// takePrepared removes the prepared transaction of the name and marks it finished so that it is resolved only once.
+func (ts *TransactionSet) takePrepared(name string) (*Transaction, error) {
+	ts.preparedLock.Lock()
+	defer ts.preparedLock.Unlock()
+	trx, ok := ts.prepared[name]
+	if !ok {
+		return nil, ErrPreparedNotFound
+	}
+	delete(ts.prepared, name)
+	atomic.StoreInt32(&trx.state, trxFinished)
+	return trx, nil
+}
+
+// CommitPrepared commits the prepared transaction of the name.
+func (ts *TransactionSet) CommitPrepared(name string) error {
+	trx, err := ts.takePrepared(name)
+	if err != nil {
+		return err
+	}
+	ts.db.logPrepared(common.OpCommitPrepared, name, []byte{})
+	return ts.commitTransaction(trx)
+}
+
+// RollbackPrepared rolls back the prepared transaction of the name.
+func (ts *TransactionSet) RollbackPrepared(name string) error {
+	trx, err := ts.takePrepared(name)
+	if err != nil {
+		return err
+	}
+	ts.db.logPrepared(common.OpRollbackPrepared, name, []byte{})
+	ts.rollbackTransaction(trx)
+	return nil
+}
+
+// logPrepared appends a record of the two-phase commit to the WAL, flushes it and returns the offset of the record.
+func (db *DrifterDB) logPrepared(op int, name string, value []byte) uint64 {
+	db.memtableLock.Lock()
+	defer db.memtableLock.Unlock()
+	// the records buffered by the others are flushed first so that the offset is the start of the record
+	db.wal.Flush()
+	offset := db.wal.Offset()
+	db.wal.Append(common.OperationRecord(op, common.MakeMVCCKey([]byte(name), 0, common.OpPrepare, 0), value))
+	db.wal.Flush()
+	return offset
+}
+
+// oldestPreparedOffset returns the WAL offset of the oldest OpPrepare record of the unresolved prepared transactions.
+func (ts *TransactionSet) oldestPreparedOffset() (uint64, bool) {
+	ts.preparedLock.Lock()
+	defer ts.preparedLock.Unlock()
+	var oldest uint64
+	found := false
+	for _, trx := range ts.prepared {
+		if !found || trx.preparedOffset < oldest {
+			oldest = trx.preparedOffset
+			found = true
+		}
+	}
+	return oldest, found
+}
+
+// recoverPrepared rebuilds the prepared transaction from the ops of its OpPrepare record,
+// the ops are written with their original seqs and the keys are locked by the transaction again.
+// The OpPrepare record is logged again since the versions are not logged during the recovery,
+// so the WAL is kept from the new record until the transaction is resolved.
+func (ts *TransactionSet) recoverPrepared(name string, ops []*preparedOp) {
+	trx := ts.GetTransaction()
+	db := ts.db
+	for _, op := range ops {
+		if err := trx.lock(op.key, true); err != nil {
+			common.Error("Failed to lock the key of the prepared transaction " + name + ": " + err.Error())
+		}
+		// the versions logged before the OpPrepare record may not be replayed
+		if db.seq < op.seq {
+			db.seq = op.seq
+		}
+		mvccKey := common.MakeMVCCKey(op.key, op.seq, op.kt, trx.trxId)
+		db.switchMemtableLock.RLock()
+		db.memtable.Ref(trx)
+		trx.refTables = append(trx.refTables, db.memtable)
+		db.memtableLock.Lock()
+		db.put(mvccKey, op.value)
+		trx.modificationRecord = append(trx.modificationRecord, &TrxOpRecord{
+			table: db.memtable,
+			key:   mvccKey,
+			value: op.value,
+		})
+		db.memtableLock.Unlock()
+		db.switchMemtableLock.RUnlock()
+	}
+	trx.preparedOffset = db.logPrepared(common.OpPrepare, name, encodePrepared(trx.modificationRecord))
+	trx.prepared = name
+	atomic.StoreInt32(&trx.state, trxPrepared)
+	ts.preparedLock.Lock()
+	ts.prepared[name] = trx
+	ts.preparedLock.Unlock()
+}
+
+// GetPreparedTransactions returns the prepared transactions, including the ones recovered from the WAL.
+func (db *DrifterDB) GetPreparedTransactions() []*Transaction {
+	return db.transactionSet.GetPreparedTransactions()
+}
+
+func (db *DrifterDB) CommitPrepared(name string) error {
+	return db.transactionSet.CommitPrepared(name)
+}
+
+func (db *DrifterDB) RollbackPrepared(name string) error {
+	return db.transactionSet.RollbackPrepared(name)
+}
+
+// resolvePrepared returns the OpPrepare records of the unresolved prepared transactions in the order of the WAL,
+// the versions of the committed prepared transactions, and the seqs of the versions written by the prepared
+// transactions which are replayed from their OpPrepare records or are not committed.
+// The committed versions are replayed from the OpPrepare records since the WAL before the record may be dropped,
+// and the versions of a recovered transaction are not logged again.
+func resolvePrepared(records []*common.Operation) ([]*common.Operation, []*preparedOp, map[uint64]bool) {
+	pending := make(map[string]*common.Operation)
+	order := make([]string, 0)
+	committed := make([]*preparedOp, 0)
+	skipped := make(map[uint64]bool)
+	for _, o := range records {
+		switch o.KeyType() {
+		case common.OpPrepare:
+			name := string(o.Key().(*common.MVCCKey).Content)
+			pending[name] = o
+			order = append(order, name)
+		case common.OpCommitPrepared:
+			name := string(o.Key().(*common.MVCCKey).Content)
+			if p, ok := pending[name]; ok {
+				for _, op := range decodePrepared(p.ValueBytes()) {
+					skipped[op.seq] = true
+					committed = append(committed, op)
+				}
+				delete(pending, name)
+			}
+		case common.OpRollbackPrepared:
+			name := string(o.Key().(*common.MVCCKey).Content)
+			if p, ok := pending[name]; ok {
+				for _, op := range decodePrepared(p.ValueBytes()) {
+					skipped[op.seq] = true
+				}
+				delete(pending, name)
+			}
+		}
+	}
+	prepared := make([]*common.Operation, 0, len(pending))
+	for _, name := range order {
+		if p, ok := pending[name]; ok {
+			prepared = append(prepared, p)
+			delete(pending, name)
+			for _, op := range decodePrepared(p.ValueBytes()) {
+				skipped[op.seq] = true
+			}
+		}
+	}
+	return prepared, committed, skipped
+}
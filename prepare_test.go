@@ -0,0 +1,138 @@
+package drifterdb
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransaction_Prepare(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	trx := db.StartTransaction()
+	trx.Put([]byte("k"), []byte("v"))
+	if err := trx.Prepare("xid-1"); err != nil {
+		t.Fatalf("the prepare is supposed to succeed, got %v", err)
+	}
+	if err := trx.Put([]byte("k2"), []byte("v")); err != ErrTransactionPrepared {
+		t.Errorf("the write after the prepare is supposed to fail with ErrTransactionPrepared, got %v", err)
+	}
+	other := db.StartTransaction()
+	if err := other.Prepare("xid-1"); err != ErrDuplicatePreparedName {
+		t.Errorf("the prepare with a used name is supposed to fail, got %v", err)
+	}
+	db.RollbackTransaction(other)
+	if v := db.Get([]byte("k")); v != nil {
+		t.Errorf("the prepared write is supposed to be invisible, got %s", v)
+	}
+	if prepared := db.GetPreparedTransactions(); len(prepared) != 1 || prepared[0].Name() != "xid-1" {
+		t.Fatalf("the prepared transaction is supposed to be listed, got %v", prepared)
+	}
+	if err := db.CommitPrepared("xid-1"); err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	if err := db.CommitPrepared("xid-1"); err != ErrPreparedNotFound {
+		t.Errorf("the second commit is supposed to fail with ErrPreparedNotFound, got %v", err)
+	}
+	if v := db.Get([]byte("k")); string(v) != "v" {
+		t.Errorf("the committed write is supposed to be visible, got %s", v)
+	}
+}
+
+func TestOpenDB_RecoverPrepared(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir, nil)
+	for _, name := range []string{"committed", "rolled-back", "pending"} {
+		trx := db.StartTransaction()
+		trx.Put([]byte(name), []byte(name))
+		if err := trx.Prepare(name); err != nil {
+			t.Fatalf("the prepare is supposed to succeed, got %v", err)
+		}
+	}
+	db.CommitPrepared("committed")
+	db.RollbackPrepared("rolled-back")
+	db.Close()
+
+	recovered := OpenDB(dir)
+	defer recovered.Close()
+	prepared := recovered.GetPreparedTransactions()
+	if len(prepared) != 1 || prepared[0].Name() != "pending" {
+		t.Fatalf("only the unresolved transaction is supposed to be recovered, got %v", prepared)
+	}
+	if v := recovered.Get([]byte("committed")); string(v) != "committed" {
+		t.Errorf("the committed write is supposed to be recovered, got %s", v)
+	}
+	if v := recovered.Get([]byte("rolled-back")); v != nil {
+		t.Errorf("the rolled back write is supposed to be skipped, got %s", v)
+	}
+	if v := recovered.Get([]byte("pending")); v != nil {
+		t.Errorf("the prepared write is supposed to be invisible, got %s", v)
+	}
+	// the recovered transaction holds the lock of its key
+	trx := recovered.StartTransaction()
+	trx.SetLockTimeout(10 * time.Millisecond)
+	if err := trx.Put([]byte("pending"), []byte("other")); err != ErrLockTimeout {
+		t.Errorf("the key of the prepared transaction is supposed to be locked, got %v", err)
+	}
+	recovered.RollbackTransaction(trx)
+	if err := recovered.CommitPrepared("pending"); err != nil {
+		t.Fatalf("the commit of the recovered transaction is supposed to succeed, got %v", err)
+	}
+	if v := recovered.Get([]byte("pending")); string(v) != "pending" {
+		t.Errorf("the write of the recovered transaction is supposed to be committed, got %s", v)
+	}
+}
+
+func TestOpenDB_RecoverPrepared_Twice(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir, nil)
+	trx := db.StartTransaction()
+	trx.Put([]byte("pending"), []byte("pending"))
+	if err := trx.Prepare("pending"); err != nil {
+		t.Fatalf("the prepare is supposed to succeed, got %v", err)
+	}
+	db.Close()
+
+	recovered := OpenDB(dir)
+	// the memtable of the recovered transaction stays frozen while the newer memtable is flushed
+	for _, key := range []string{"a", "b"} {
+		recovered.Put([]byte(key), []byte(key))
+		recovered.FrozeMemtable()
+		for atomic.LoadInt32(&recovered.waitingForFreezing) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		recovered.switchMemtableLock.RLock()
+		flushed := len(recovered.storage.currentVersion.levels[0])
+		recovered.switchMemtableLock.RUnlock()
+		if flushed != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the newer memtable is supposed to be flushed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	recovered.Close()
+
+	reopened := OpenDB(dir)
+	prepared := reopened.GetPreparedTransactions()
+	if len(prepared) != 1 || prepared[0].Name() != "pending" {
+		reopened.Close()
+		t.Fatalf("the unresolved transaction is supposed to survive the second restart, got %v", prepared)
+	}
+	if err := reopened.CommitPrepared("pending"); err != nil {
+		reopened.Close()
+		t.Fatalf("the commit of the recovered transaction is supposed to succeed, got %v", err)
+	}
+	reopened.Close()
+
+	committed := OpenDB(dir)
+	defer committed.Close()
+	for _, key := range []string{"pending", "a", "b"} {
+		if v := committed.Get([]byte(key)); string(v) != key {
+			t.Errorf("the write of %s is supposed to be recovered, got %s", key, v)
+		}
+	}
+}
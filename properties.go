@@ -0,0 +1,179 @@
+package drifterdb
+
+import (
+	"encoding/json"
+	"github.com/LaJunkai/drifterdb/common"
+	"time"
+)
+
+const (
+	PropertiesBlockName  = "properties"
+	NoCompression        = "none"
+	LinearIndexType      = "linear"
+	PartitionedIndexType = "partitioned"
+)
+
+// TableProperties describes the content of a table, it is written as the properties block when the table is dumped.
+type TableProperties struct {
+	NumEntries       uint64            `json:"num_entries"`
+	NumDeletions     uint64            `json:"num_deletions"`
+	RawKeySize       uint64            `json:"raw_key_size"`
+	RawValueSize     uint64            `json:"raw_value_size"`
+	EncodedKeySize   uint64            `json:"encoded_key_size"`
+	EncodedValueSize uint64            `json:"encoded_value_size"`
+	DataSize         uint64            `json:"data_size"`
+	IndexSize        uint64            `json:"index_size"`
+	FilterSize       uint64            `json:"filter_size"`
+	MinSeq           uint64            `json:"min_seq"`
+	MaxSeq           uint64            `json:"max_seq"`
+	CreationTime     int64             `json:"creation_time"`
+	Compression      string            `json:"compression"`
+	FilterPolicy     string            `json:"filter_policy"`
+	PrefixExtractor  string            `json:"prefix_extractor"`
+	IndexType        string            `json:"index_type"`
+	FormatVersion    int               `json:"format_version"`
+	UserCollected    map[string]string `json:"user_collected"`
+}
+
+// TablePropertiesCollector collects user defined properties of the table during dumping the table.
+// Add is called for every record in the order of the keys, and the result of Finish is saved in UserCollected
+// with the keys prefixed by the name of the collector.
+type TablePropertiesCollector interface {
+	Name() string
+	Add(key *common.MVCCKey, value []byte)
+	Finish() map[string]string
+}
+
+// TablePropertiesCollectorFactory create a new collector for each table to dump.
+type TablePropertiesCollectorFactory func() TablePropertiesCollector
+
+type tablePropertiesBuilder struct {
+	properties *TableProperties
+	collectors []TablePropertiesCollector
+}
+
+func newTablePropertiesBuilder(option *Option) *tablePropertiesBuilder {
+	builder := &tablePropertiesBuilder{
+		properties: &TableProperties{
+			MinSeq:        0xFFFFFFFFFFFFFFFF,
+			CreationTime:  time.Now().Unix(),
+			Compression:   NoCompression,
+			IndexType:     LinearIndexType,
+			FormatVersion: TableFormatVersion,
+			UserCollected: make(map[string]string),
+		},
+		collectors: make([]TablePropertiesCollector, 0, len(option.TablePropertiesCollectors)),
+	}
+	if option.PartitionedIndex {
+		builder.properties.IndexType = PartitionedIndexType
+	}
+	for _, factory := range option.TablePropertiesCollectors {
+		builder.collectors = append(builder.collectors, factory())
+	}
+	return builder
+}
+
+func (b *tablePropertiesBuilder) Add(key *common.MVCCKey, value []byte) {
+	p := b.properties
+	p.NumEntries += 1
+	if key.KT == common.OpDelete {
+		p.NumDeletions += 1
+	}
+	p.RawKeySize += uint64(len(key.Content))
+	p.EncodedKeySize += uint64(len(key.Content) + 8)
+	p.RawValueSize += uint64(len(value))
+	p.EncodedValueSize += uint64(len(value))
+	if key.Seq < p.MinSeq {
+		p.MinSeq = key.Seq
+	}
+	if key.Seq > p.MaxSeq {
+		p.MaxSeq = key.Seq
+	}
+	for _, collector := range b.collectors {
+		collector.Add(key, value)
+	}
+}
+
+func (b *tablePropertiesBuilder) Finish() []byte {
+	if b.properties.NumEntries == 0 {
+		b.properties.MinSeq = 0
+	}
+	for _, collector := range b.collectors {
+		for k, v := range collector.Finish() {
+			b.properties.UserCollected[collector.Name()+"."+k] = v
+		}
+	}
+	result, err := json.Marshal(b.properties)
+	common.Throw(err)
+	return result
+}
+
+// loadProperties load the properties block, properties of the tables of the legacy format are derived from the header.
+func (t *Table) loadProperties() {
+	if block, existed := t.metaBlocks[PropertiesBlockName]; existed {
+		t.properties = &TableProperties{}
+		common.Throw(json.Unmarshal(block.LoadBytes(), t.properties))
+		return
+	}
+	t.properties = &TableProperties{
+		DataSize:      t.header.dataBlock.size,
+		IndexSize:     t.header.indexBlock.size,
+		FilterSize:    t.header.filterBlock.size,
+		Compression:   NoCompression,
+		IndexType:     LinearIndexType,
+		FormatVersion: t.formatVersion,
+		UserCollected: make(map[string]string),
+	}
+}
+
+func (t *Table) Properties() *TableProperties {
+	return t.properties
+}
+
+// LevelSummary aggregates the properties of the tables in a level.
+type LevelSummary struct {
+	Level        int    `json:"level"`
+	NumTables    int    `json:"num_tables"`
+	NumEntries   uint64 `json:"num_entries"`
+	NumDeletions uint64 `json:"num_deletions"`
+	RawKeySize   uint64 `json:"raw_key_size"`
+	RawValueSize uint64 `json:"raw_value_size"`
+	DataSize     uint64 `json:"data_size"`
+	IndexSize    uint64 `json:"index_size"`
+	FilterSize   uint64 `json:"filter_size"`
+}
+
+// GetPropertiesOfAllTables returns the properties of the tables in the current version, keyed by the path of the table.
+func (db *DrifterDB) GetPropertiesOfAllTables() map[string]*TableProperties {
+	version := db.storage.GetVersion()
+	defer db.storage.ReleaseVersion(version)
+	result := make(map[string]*TableProperties)
+	for _, level := range version.levels {
+		for _, table := range level {
+			result[table.FullPath()] = table.Properties()
+		}
+	}
+	return result
+}
+
+// GetLevelSummaries returns the summary of every level of the current version.
+func (db *DrifterDB) GetLevelSummaries() []*LevelSummary {
+	version := db.storage.GetVersion()
+	defer db.storage.ReleaseVersion(version)
+	result := make([]*LevelSummary, 0, len(version.levels))
+	for i, level := range version.levels {
+		summary := &LevelSummary{Level: i, NumTables: len(level)}
+		for _, table := range level {
+			p := table.Properties()
+			summary.NumEntries += p.NumEntries
+			summary.NumDeletions += p.NumDeletions
+			summary.RawKeySize += p.RawKeySize
+			summary.RawValueSize += p.RawValueSize
+			summary.DataSize += p.DataSize
+			summary.IndexSize += p.IndexSize
+			summary.FilterSize += p.FilterSize
+		}
+		result = append(result, summary)
+	}
+	return result
+}
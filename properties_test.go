@@ -0,0 +1,61 @@
+package drifterdb
+
+import (
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"strconv"
+	"testing"
+)
+
+type evenKeyCollector struct {
+	count int
+}
+
+func (c *evenKeyCollector) Name() string {
+	return "even"
+}
+
+func (c *evenKeyCollector) Add(key *common.MVCCKey, value []byte) {
+	if key.Seq%2 == 0 {
+		c.count += 1
+	}
+}
+
+func (c *evenKeyCollector) Finish() map[string]string {
+	return map[string]string{"count": strconv.Itoa(c.count)}
+}
+
+func TestTableProperties(t *testing.T) {
+	memtable := NewSkiplistMemtable(common.TypeMVCCBytes)
+	total := 1000
+	for i := 0; i < total; i++ {
+		op := uint8(common.OpPut)
+		if i%10 == 0 {
+			op = common.OpDelete
+		}
+		key := common.MakeMVCCKey([]byte(fmt.Sprintf("key-%04d", i)), uint64(i+1), op, 0)
+		memtable.Put(key, []byte(fmt.Sprintf("value-%04d", i)))
+	}
+	option := DefaultOption()
+	option.TablePropertiesCollectors = []TablePropertiesCollectorFactory{
+		func() TablePropertiesCollector { return &evenKeyCollector{} },
+	}
+	dir := t.TempDir()
+	DumpTableWithOption(memtable, dir, 1, 0, option)
+	p := LoadTable(TableFullPath(dir, 0, 1)).Properties()
+	if p.NumEntries != uint64(total) || p.NumDeletions != uint64(total/10) {
+		t.Errorf("wrong entries %v or deletions %v", p.NumEntries, p.NumDeletions)
+	}
+	if p.RawKeySize != uint64(total*8) || p.EncodedKeySize != uint64(total*16) || p.RawValueSize != uint64(total*10) {
+		t.Errorf("wrong key size %v / %v or value size %v", p.RawKeySize, p.EncodedKeySize, p.RawValueSize)
+	}
+	if p.MinSeq != 1 || p.MaxSeq != uint64(total) {
+		t.Errorf("wrong seq range [%v, %v]", p.MinSeq, p.MaxSeq)
+	}
+	if p.FormatVersion != TableFormatVersion || p.IndexType != LinearIndexType || p.FilterSize == 0 {
+		t.Errorf("wrong table format properties %+v", p)
+	}
+	if p.UserCollected["even.count"] != strconv.Itoa(total/2) {
+		t.Errorf("wrong user collected properties %v", p.UserCollected)
+	}
+}
@@ -0,0 +1,93 @@
+package drifterdb
+
+import "bytes"
+
+// savepoint records the lengths of the write records and the locks of the transaction when it is set,
+// the optimistic transaction also keeps a copy of its batch.
+type savepoint struct {
+	records int
+	keys    int
+	ranges  int
+	batch   *writeBatch
+}
+
+// SetSavepoint sets a savepoint of the transaction, the savepoints are nested.
+func (trx *Transaction) SetSavepoint() {
+	sp := &savepoint{
+		records: len(trx.modificationRecord),
+		keys:    len(trx.lockedKeys),
+		ranges:  len(trx.lockedRanges),
+	}
+	if trx.batch != nil {
+		sp.batch = trx.batch.Clone()
+	}
+	trx.savepoints = append(trx.savepoints, sp)
+}
+
+// PopSavepoint removes the latest savepoint without undoing the writes after it.
+func (trx *Transaction) PopSavepoint() error {
+	if len(trx.savepoints) == 0 {
+		return ErrNoSavepoint
+	}
+	trx.savepoints = trx.savepoints[:len(trx.savepoints)-1]
+	return nil
+}
+
+// RollbackToSavepoint undoes the writes after the latest savepoint and removes the savepoint,
+// the locks acquired after the savepoint are released while the earlier ones are kept.
+func (trx *Transaction) RollbackToSavepoint() error {
+	if trx.prepared != "" {
+		return ErrTransactionPrepared
+	}
+	if err := trx.enter(); err != nil {
+		return err
+	}
+	defer trx.leave()
+	if len(trx.savepoints) == 0 {
+		return ErrNoSavepoint
+	}
+	sp := trx.savepoints[len(trx.savepoints)-1]
+	trx.savepoints = trx.savepoints[:len(trx.savepoints)-1]
+	if trx.batch != nil {
+		trx.batch = sp.batch
+	}
+	trx.undoRecords(sp.records)
+	locks := trx.db.transactionSet.locks
+	for _, key := range trx.lockedKeys[sp.keys:] {
+		if !containsKey(trx.lockedKeys[:sp.keys], key) {
+			locks.Release(trx.trxId, key)
+		}
+	}
+	trx.lockedKeys = trx.lockedKeys[:sp.keys]
+	for _, r := range trx.lockedRanges[sp.ranges:] {
+		locks.ReleaseRange(trx.trxId, r[0], r[1])
+	}
+	trx.lockedRanges = trx.lockedRanges[:sp.ranges]
+	return nil
+}
+
+// undoRecords deletes the versions written after the first n records from the memtables.
+func (trx *Transaction) undoRecords(n int) {
+	if n >= len(trx.modificationRecord) {
+		return
+	}
+	trx.db.switchMemtableLock.RLock()
+	defer trx.db.switchMemtableLock.RUnlock()
+	trx.db.memtableLock.Lock()
+	defer trx.db.memtableLock.Unlock()
+	for i := len(trx.modificationRecord) - 1; i >= n; i-- {
+		r := trx.modificationRecord[i]
+		r.table.Delete(r.key)
+		r.key.TrxId = 0
+	}
+	trx.modificationRecord = trx.modificationRecord[:n]
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package drifterdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransaction_RollbackToSavepoint(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	trx := db.StartTransaction()
+	trx.Put([]byte("step-1"), []byte("done"))
+	trx.SetSavepoint()
+	trx.Put([]byte("step-1"), []byte("overwritten"))
+	trx.Put([]byte("step-2"), []byte("failed"))
+	if err := trx.RollbackToSavepoint(); err != nil {
+		t.Fatalf("the rollback is supposed to succeed, got %v", err)
+	}
+	if err := trx.RollbackToSavepoint(); err != ErrNoSavepoint {
+		t.Errorf("the savepoint is supposed to be removed by the rollback, got %v", err)
+	}
+	// the lock acquired after the savepoint is released
+	other := db.StartTransaction()
+	other.SetLockTimeout(10 * time.Millisecond)
+	if err := other.Put([]byte("step-2"), []byte("other")); err != nil {
+		t.Errorf("the lock acquired after the savepoint is supposed to be released, got %v", err)
+	}
+	if err := other.Put([]byte("step-1"), []byte("other")); err != ErrLockTimeout {
+		t.Errorf("the lock acquired before the savepoint is supposed to be kept, got %v", err)
+	}
+	db.RollbackTransaction(other)
+	if err := db.CommitTransaction(trx); err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	if v := db.Get([]byte("step-1")); string(v) != "done" {
+		t.Errorf("the write before the savepoint is supposed to be kept, got %s", v)
+	}
+	if v := db.Get([]byte("step-2")); v != nil {
+		t.Errorf("the write after the savepoint is supposed to be undone, got %s", v)
+	}
+}
+
+func TestTransaction_PopSavepoint(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	err := db.WithOptimisticTransaction(func(trx *Transaction) {
+		trx.SetSavepoint()
+		trx.Put([]byte("a"), []byte("1"))
+		trx.SetSavepoint()
+		trx.Put([]byte("b"), []byte("2"))
+		if err := trx.PopSavepoint(); err != nil {
+			t.Errorf("the pop is supposed to succeed, got %v", err)
+		}
+		trx.Put([]byte("c"), []byte("3"))
+		if err := trx.RollbackToSavepoint(); err != nil {
+			t.Errorf("the rollback is supposed to succeed, got %v", err)
+		}
+		if v := trx.Get([]byte("a")); v != nil {
+			t.Errorf("the buffered write after the savepoint is supposed to be undone, got %s", v)
+		}
+		trx.Put([]byte("d"), []byte("4"))
+	})
+	if err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	for key, expected := range map[string]string{"a": "", "b": "", "c": "", "d": "4"} {
+		if v := db.Get([]byte(key)); string(v) != expected {
+			t.Errorf("the value of %s is supposed to be %q, got %q", key, expected, v)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package skiplist
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// ArenaBlockSize is the byte size of the blocks allocated by the Arena,
+// the larger allocations are made out of the blocks.
+const ArenaBlockSize = 64 << 10
+
+type arenaBlock struct {
+	buf []byte
+	// offset is the end of the allocated bytes of the block, it may exceed the length of the buf
+	// once the block is full.
+	offset uint32
+}
+
+// Arena is a lock-free bump allocator of the keys and the values of a LockFreeSkipList,
+// the memory is released all at once with the list.
+type Arena struct {
+	current unsafe.Pointer
+	// size is the bytes allocated by the arena and accounted to it.
+	size int64
+}
+
+func NewArena() *Arena {
+	return &Arena{
+		current: unsafe.Pointer(&arenaBlock{buf: make([]byte, ArenaBlockSize)}),
+	}
+}
+
+// Allocate returns n bytes which are never returned again by the arena.
+func (a *Arena) Allocate(n int) []byte {
+	atomic.AddInt64(&a.size, int64(n))
+	if n > ArenaBlockSize/4 {
+		return make([]byte, n)
+	}
+	for {
+		block := (*arenaBlock)(atomic.LoadPointer(&a.current))
+		end := int(atomic.AddUint32(&block.offset, uint32(n)))
+		if end <= len(block.buf) {
+			return block.buf[end-n : end : end]
+		}
+		// the block is full, the goroutine which fails the swap retries with the new block of the winner
+		newBlock := &arenaBlock{buf: make([]byte, ArenaBlockSize)}
+		atomic.CompareAndSwapPointer(&a.current, unsafe.Pointer(block), unsafe.Pointer(newBlock))
+	}
+}
+
+// Copy copies the src into the arena.
+func (a *Arena) Copy(src []byte) []byte {
+	dst := a.Allocate(len(src))
+	copy(dst, src)
+	return dst
+}
+
+// Account adds the bytes allocated out of the arena for the list, such as the entries, to the size of the arena.
+func (a *Arena) Account(n int) {
+	atomic.AddInt64(&a.size, int64(n))
+}
+
+func (a *Arena) Size() int {
+	return int(atomic.LoadInt64(&a.size))
+}
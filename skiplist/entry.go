@@ -17,8 +17,11 @@ type Entry struct {
 
 // Base of the Entry or the skiplist
 // Field levels maintains the hasNext Entry in all levels.
+// Field spans maintains the number of the entries each level skips, from the entry (exclusive) to the hasNext
+// Entry (inclusive) of the level, or the number of the entries after the entry if the level has no hasNext Entry.
 type EntryBase struct {
 	levels []*Entry
+	spans  []int
 }
 
 func (e *EntryBase) Entry() *Entry {
@@ -30,6 +33,7 @@ func NewEntry(list *SkipList, level int, key, value interface{}) *Entry {
 	return &Entry{
 		EntryBase: EntryBase{
 			levels: make([]*Entry, level),
+			spans:  make([]int, level),
 		},
 		key:   key,
 		Value: value,
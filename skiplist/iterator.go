@@ -1,8 +1,11 @@
 package skiplist
 
+// ListIterator iterates the entries of the list in both directions. Get returns the current entry and moves the
+// cursor forward, while Key and Value peek the current entry without moving the cursor.
 type ListIterator struct {
-	currentEntry    *Entry
-	list            *SkipList
+	currentEntry *Entry
+	list         *SkipList
+	// currentPosition is the index of the current entry.
 	currentPosition int
 	hasNext         bool
 }
@@ -24,16 +27,84 @@ func (iterator *ListIterator) Tell() int {
 	return iterator.currentPosition
 }
 
+func (iterator *ListIterator) moveTo(e *Entry, position int) {
+	iterator.currentEntry = e
+	iterator.currentPosition = position
+	iterator.hasNext = e != nil
+}
+
 // get one element from the iterator and then make the cursor move forward
 func (iterator *ListIterator) Get() *Entry {
-	defer func() {
-		iterator.currentPosition += 1
-		iterator.currentEntry = iterator.currentEntry.levels[0]
-		iterator.hasNext = iterator.currentEntry != nil
-	}()
+	defer iterator.Next()
 	return iterator.currentEntry
 }
 
 func (iterator *ListIterator) HasNext() bool {
-return iterator.hasNext
+	return iterator.hasNext
+}
+
+// Valid reports whether the cursor is at an entry, it is the same as HasNext.
+func (iterator *ListIterator) Valid() bool {
+	return iterator.currentEntry != nil
+}
+
+// Current returns the current entry without moving the cursor, nil if the cursor is not valid.
+func (iterator *ListIterator) Current() *Entry {
+	return iterator.currentEntry
+}
+
+func (iterator *ListIterator) Key() interface{} {
+	if iterator.currentEntry == nil {
+		return nil
+	}
+	return iterator.currentEntry.key
+}
+
+func (iterator *ListIterator) Value() interface{} {
+	if iterator.currentEntry == nil {
+		return nil
+	}
+	return iterator.currentEntry.Value
+}
+
+// Next moves the cursor forward.
+func (iterator *ListIterator) Next() {
+	if iterator.currentEntry == nil {
+		return
+	}
+	iterator.moveTo(iterator.currentEntry.levels[0], iterator.currentPosition+1)
+}
+
+// Prev moves the cursor backward, the cursor is not valid once it moves before the first entry.
+func (iterator *ListIterator) Prev() {
+	if iterator.currentEntry == nil {
+		return
+	}
+	iterator.moveTo(iterator.currentEntry.prev, iterator.currentPosition-1)
+}
+
+// First moves the cursor to the first entry.
+func (iterator *ListIterator) First() {
+	iterator.moveTo(iterator.list.First(), 0)
+}
+
+// Last moves the cursor to the last entry.
+func (iterator *ListIterator) Last() {
+	iterator.moveTo(iterator.list.Back(), iterator.list.length-1)
+}
+
+// Seek moves the cursor to the first entry not less than the key.
+func (iterator *ListIterator) Seek(key interface{}) {
+	rank, e := iterator.list.lowerBound(key)
+	iterator.moveTo(e, rank)
+}
+
+// SeekForPrev moves the cursor to the last entry not greater than the key.
+func (iterator *ListIterator) SeekForPrev(key interface{}) {
+	iterator.moveTo(iterator.list.seekForPrev(key))
+}
+
+// SeekToIndex moves the cursor to the entry at the index.
+func (iterator *ListIterator) SeekToIndex(index int) {
+	iterator.moveTo(iterator.list.ByIndex(index), index)
 }
@@ -0,0 +1,91 @@
+package skiplist
+
+import (
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"testing"
+)
+
+func keyOf(i int) *common.MVCCKey {
+	return common.MakeMVCCKey([]byte(fmt.Sprintf("key%03d", i)), uint64(i+1), common.OpPut, 0)
+}
+
+func TestListIterator_Reverse(t *testing.T) {
+	list := NewSkipList(common.TypeMVCCBytes)
+	for i := 0; i < 100; i += 2 {
+		list.Set(keyOf(i), i)
+	}
+	// the aborted insert of a conflicting version is not supposed to break the prev pointers
+	list.Set(common.MakeMVCCKey([]byte("key050"), 100, common.OpPut, 7), -50)
+	list.Set(common.MakeMVCCKey([]byte("key050"), 101, common.OpPut, 8), -51)
+	list.Delete(keyOf(20))
+	expected := make([]int, 0)
+	for i := 98; i >= 0; i -= 2 {
+		if i == 50 {
+			// the newer uncommitted version is ordered ahead
+			expected = append(expected, 50, -50)
+		} else if i != 20 {
+			expected = append(expected, i)
+		}
+	}
+	iterator := list.Iterator()
+	values := make([]int, 0)
+	for iterator.Last(); iterator.Valid(); iterator.Prev() {
+		values = append(values, iterator.Value().(int))
+	}
+	if fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Fatalf("the reverse iteration is supposed to return %v, got %v", expected, values)
+	}
+	iterator.Seek(keyOf(31))
+	if iterator.Value() != 32 {
+		t.Errorf("the seek is supposed to find the next entry, got %v", iterator.Value())
+	}
+	iterator.SeekForPrev(keyOf(31))
+	if iterator.Value() != 30 {
+		t.Errorf("the seek for prev is supposed to find the previous entry, got %v", iterator.Value())
+	}
+	if iterator.SeekForPrev(keyOf(30)); iterator.Value() != 30 || iterator.Get().Key().(*common.MVCCKey).Seq != 31 {
+		t.Errorf("the seek for prev is supposed to find the equal entry, got %v", iterator.Value())
+	}
+	if iterator.Value() != 32 {
+		t.Errorf("the get is supposed to move the cursor forward, got %v", iterator.Value())
+	}
+	if iterator.Seek(keyOf(99)); iterator.Valid() {
+		t.Errorf("the seek after the last entry is not supposed to be valid")
+	}
+	if iterator.SeekForPrev(common.MakeMVCCKey([]byte("a"), 1, common.OpPut, 0)); iterator.Valid() {
+		t.Errorf("the seek for prev before the first entry is not supposed to be valid")
+	}
+}
+
+func TestLockFreeIterator_Reverse(t *testing.T) {
+	list := NewLockFreeSkipList(common.TypeMVCCBytes)
+	for i := 0; i < 100; i++ {
+		list.Set(keyOf(i), []byte(fmt.Sprint(i)))
+	}
+	// the deleted entries are skipped, the live entry relinked ahead of the deleted one is found
+	list.Delete(keyOf(40))
+	list.Delete(keyOf(41))
+	list.Set(keyOf(41), []byte("41"))
+	iterator := list.Iterator()
+	count := 0
+	prev := 100
+	for iterator.Last(); iterator.Valid(); iterator.Prev() {
+		var current int
+		fmt.Sscan(string(iterator.Current().Value()), &current)
+		if current >= prev || current == 40 {
+			t.Fatalf("the reverse iteration is supposed to skip the deleted entries in order, got %d after %d", current, prev)
+		}
+		prev = current
+		count++
+	}
+	if count != 99 {
+		t.Errorf("the reverse iteration is supposed to return 99 entries, got %d", count)
+	}
+	if iterator.SeekForPrev(keyOf(40)); string(iterator.Current().Value()) != "39" {
+		t.Errorf("the seek for prev is supposed to skip the deleted entry")
+	}
+	if iterator.Seek(keyOf(40)); string(iterator.Current().Value()) != "41" {
+		t.Errorf("the seek is supposed to skip the deleted entry")
+	}
+}
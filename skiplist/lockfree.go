@@ -0,0 +1,383 @@
+package skiplist
+
+import (
+	"bytes"
+	"github.com/LaJunkai/drifterdb/common"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"unsafe"
+)
+
+// LockFreeMaxHeight is the max level of the LockFreeSkipList.
+const LockFreeMaxHeight = 20
+
+/*
+LockFreeSkipList is an insert-only skip list whose inserts are linked by CAS, so the goroutines insert concurrently
+and the readers never block. The keys and the values are copied into the arena of the list.
+
+A deleted entry is only marked and skipped by the readers, it stays linked until the list is released.
+A new key is always linked ahead of the deleted entries equal to it.
+*/
+type LockFreeSkipList struct {
+	head    *LockFreeEntry
+	height  int32
+	length  int64
+	keyType common.Comparable
+	arena   *Arena
+}
+
+type LockFreeEntry struct {
+	key     interface{}
+	value   atomic.Value
+	deleted int32
+	tower   []unsafe.Pointer
+}
+
+var lockFreeEntrySize = int(unsafe.Sizeof(LockFreeEntry{}))
+
+func NewLockFreeSkipList(keyType common.Comparable) *LockFreeSkipList {
+	return &LockFreeSkipList{
+		head:    &LockFreeEntry{tower: make([]unsafe.Pointer, LockFreeMaxHeight)},
+		height:  1,
+		keyType: keyType,
+		arena:   NewArena(),
+	}
+}
+
+func (e *LockFreeEntry) Key() interface{} {
+	return e.key
+}
+
+func (e *LockFreeEntry) Value() []byte {
+	return e.value.Load().([]byte)
+}
+
+func (e *LockFreeEntry) Deleted() bool {
+	return atomic.LoadInt32(&e.deleted) == 1
+}
+
+func (e *LockFreeEntry) next(level int) *LockFreeEntry {
+	return (*LockFreeEntry)(atomic.LoadPointer(&e.tower[level]))
+}
+
+// liveNext returns the next entry at the level which is not deleted.
+func (e *LockFreeEntry) liveNext(level int) *LockFreeEntry {
+	next := e.next(level)
+	for next != nil && next.Deleted() {
+		next = next.next(level)
+	}
+	return next
+}
+
+func (e *LockFreeEntry) casNext(level int, old, new *LockFreeEntry) bool {
+	return atomic.CompareAndSwapPointer(&e.tower[level], unsafe.Pointer(old), unsafe.Pointer(new))
+}
+
+// NextEntry returns the next entry which is not deleted.
+func (e *LockFreeEntry) NextEntry() *LockFreeEntry {
+	return e.liveNext(0)
+}
+
+func (list *LockFreeSkipList) randomHeight() int {
+	height := 1
+	for height < LockFreeMaxHeight && rand.Int31() < math.MaxInt32/2 {
+		height += 1
+	}
+	return height
+}
+
+// findSplice returns the entries between which the key is supposed to be linked at the level,
+// the search starts from the before entry.
+func (list *LockFreeSkipList) findSplice(key interface{}, before *LockFreeEntry, level int) (*LockFreeEntry, *LockFreeEntry) {
+	for {
+		next := before.next(level)
+		if next == nil || list.keyType.ModifyCompare(key, next.key) <= 0 {
+			return before, next
+		}
+		before = next
+	}
+}
+
+// Set links a new entry of the key, the value of the entry equal to the key is replaced if it exists.
+// The entry of another uncommitted transaction and false are returned if the key conflicts with it.
+// The MVCCKey is owned by the list after Set, its content is copied into the arena.
+func (list *LockFreeSkipList) Set(key interface{}, value []byte) (*LockFreeEntry, bool) {
+	if mvccKey, ok := key.(*common.MVCCKey); ok {
+		mvccKey.Content = list.arena.Copy(mvccKey.Content)
+	}
+	value = list.arena.Copy(value)
+	height := list.randomHeight()
+	for listHeight := atomic.LoadInt32(&list.height); int32(height) > listHeight; listHeight = atomic.LoadInt32(&list.height) {
+		if atomic.CompareAndSwapInt32(&list.height, listHeight, int32(height)) {
+			break
+		}
+	}
+	var prev, next [LockFreeMaxHeight]*LockFreeEntry
+	before := list.head
+	for i := int(atomic.LoadInt32(&list.height)) - 1; i >= 0; i-- {
+		prev[i], next[i] = list.findSplice(key, before, i)
+		before = prev[i]
+	}
+	entry := &LockFreeEntry{key: key, tower: make([]unsafe.Pointer, height)}
+	entry.value.Store(value)
+	for i := 0; i < height; i++ {
+		for {
+			if i == 0 {
+				if existing, ok := list.checkInsert(key, value, next[0]); existing != nil {
+					return existing, ok
+				}
+			}
+			entry.tower[i] = unsafe.Pointer(next[i])
+			if prev[i].casNext(i, next[i], entry) {
+				break
+			}
+			// another entry is linked at the position, search again from the previous entry
+			prev[i], next[i] = list.findSplice(key, prev[i], i)
+		}
+	}
+	list.arena.Account(lockFreeEntrySize + height*int(unsafe.Sizeof(unsafe.Pointer(nil))))
+	atomic.AddInt64(&list.length, 1)
+	return entry, true
+}
+
+// checkInsert checks the entries following the position of the key at level 0 before the insert,
+// the live entry equal to the key is updated and returned, the entry of another uncommitted transaction
+// on the same content is returned with false.
+func (list *LockFreeSkipList) checkInsert(key interface{}, value []byte, next *LockFreeEntry) (*LockFreeEntry, bool) {
+	for ; next != nil && next.Deleted(); next = next.next(0) {
+	}
+	for e := next; e != nil && list.keyType.ModifyCompare(key, e.key) == 0; e = e.next(0) {
+		if !e.Deleted() {
+			e.value.Store(value)
+			return e, true
+		}
+	}
+	// **if there is another active trx edit the key, there must be a key record with smaller seq**
+	if next != nil && list.keyType == common.TypeMVCCBytes {
+		mvccKey := key.(*common.MVCCKey)
+		nextKey := next.key.(*common.MVCCKey)
+		if bytes.Equal(nextKey.Content, mvccKey.Content) && nextKey.TrxId != 0 && nextKey.TrxId != mvccKey.TrxId {
+			return next, false
+		}
+	}
+	return nil, true
+}
+
+// GetEntry returns the version of the key visible to the query, the rules are the same as SkipList.GetEntry.
+func (list *LockFreeSkipList) GetEntry(key interface{}) (result *LockFreeEntry) {
+	before := list.head
+	for i := int(atomic.LoadInt32(&list.height)) - 1; i >= 0; i-- {
+		for next := before.liveNext(i); next != nil; next = before.liveNext(i) {
+			if comp := list.keyType.QueryCompare(key, next.key); comp <= 0 {
+				if comp == 0 && list.visible(next.key, key) {
+					if list.keyType.OpType(next.key) == common.OpPut {
+						result = next
+					} else {
+						result = nil
+					}
+				}
+				break
+			}
+			before = next
+		}
+	}
+	return
+}
+
+func (list *LockFreeSkipList) visible(version, query interface{}) bool {
+	if list.keyType != common.TypeMVCCBytes {
+		return true
+	}
+	return Visible(version.(*common.MVCCKey), query.(*common.MVCCKey))
+}
+
+func (list *LockFreeSkipList) Exists(key interface{}) bool {
+	return list.GetEntry(key) != nil
+}
+
+// Delete marks the live entry equal to the key deleted and returns it, nil is returned if there is no such entry.
+func (list *LockFreeSkipList) Delete(key interface{}) *LockFreeEntry {
+	before := list.head
+	for i := int(atomic.LoadInt32(&list.height)) - 1; i >= 0; i-- {
+		before, _ = list.findSplice(key, before, i)
+	}
+	for e := before.next(0); e != nil && list.keyType.ModifyCompare(key, e.key) == 0; e = e.next(0) {
+		if atomic.CompareAndSwapInt32(&e.deleted, 0, 1) {
+			atomic.AddInt64(&list.length, -1)
+			return e
+		}
+	}
+	return nil
+}
+
+// seek returns the first live entry not less than the key.
+func (list *LockFreeSkipList) seek(key interface{}) *LockFreeEntry {
+	before := list.head
+	for i := int(atomic.LoadInt32(&list.height)) - 1; i >= 0; i-- {
+		before, _ = list.findSplice(key, before, i)
+	}
+	return before.liveNext(0)
+}
+
+// Range returns the newest versions visible to the start key in the [start, end) range, the same as SkipList.Range.
+func (list *LockFreeSkipList) Range(start, end interface{}, count int) []*LockFreeEntry {
+	preAlloc := 4096
+	if count < 4096 {
+		preAlloc = count
+	}
+	result := make([]*LockFreeEntry, 0, preAlloc)
+	var prevContent []byte = nil
+	for e := list.seek(start); e != nil && list.keyType.ModifyCompare(e.key, end) < 0; e = e.NextEntry() {
+		currentKey := e.key.(*common.MVCCKey)
+		if prevContent != nil && bytes.Equal(currentKey.Content, prevContent) {
+			continue
+		}
+		// the newest version visible to the reader is the first one in the order of the seq
+		if !Visible(currentKey, start.(*common.MVCCKey)) {
+			continue
+		}
+		prevContent = currentKey.Content
+		if currentKey.KT != common.OpDelete {
+			result = append(result, e)
+			if len(result) >= count {
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (list *LockFreeSkipList) First() *LockFreeEntry {
+	return list.head.liveNext(0)
+}
+
+// Back returns the last live entry, the list is scanned from the head if the last linked entry is deleted.
+func (list *LockFreeSkipList) Back() *LockFreeEntry {
+	before := list.head
+	for i := int(atomic.LoadInt32(&list.height)) - 1; i >= 0; i-- {
+		for next := before.next(i); next != nil; next = before.next(i) {
+			before = next
+		}
+	}
+	if before != list.head && !before.Deleted() {
+		return before
+	}
+	var last *LockFreeEntry = nil
+	for e := list.First(); e != nil; e = e.NextEntry() {
+		last = e
+	}
+	return last
+}
+
+func (list *LockFreeSkipList) Length() int {
+	return int(atomic.LoadInt64(&list.length))
+}
+
+// BytesSize returns the bytes of the keys, the values and the entries of the list.
+func (list *LockFreeSkipList) BytesSize() int {
+	return list.arena.Size()
+}
+
+// splice returns the last entry less than the key at the level 0, which may be deleted or the head.
+func (list *LockFreeSkipList) splice(key interface{}) *LockFreeEntry {
+	before := list.head
+	for i := int(atomic.LoadInt32(&list.height)) - 1; i >= 0; i-- {
+		before, _ = list.findSplice(key, before, i)
+	}
+	return before
+}
+
+// lastBefore returns the last live entry less than the key. The entries have no prev pointers,
+// so each step backward is a search from the head.
+func (list *LockFreeSkipList) lastBefore(key interface{}) *LockFreeEntry {
+	before := list.splice(key)
+	for before != list.head && before.Deleted() {
+		// the entries between the splice of the deleted key and the deleted entry are equal to it,
+		// the live one among them is linked ahead of the deleted ones
+		p := list.splice(before.key)
+		for e := p.next(0); e != before; e = e.next(0) {
+			if !e.Deleted() {
+				return e
+			}
+		}
+		before = p
+	}
+	if before == list.head {
+		return nil
+	}
+	return before
+}
+
+// seekForPrev returns the last live entry not greater than the key.
+func (list *LockFreeSkipList) seekForPrev(key interface{}) *LockFreeEntry {
+	if e := list.seek(key); e != nil && list.keyType.ModifyCompare(key, e.key) == 0 {
+		return e
+	}
+	return list.lastBefore(key)
+}
+
+func (list *LockFreeSkipList) Iterator() *LockFreeIterator {
+	return &LockFreeIterator{list: list, current: list.First()}
+}
+
+// LockFreeIterator iterates the live entries of the list, the entries linked during the iteration may be missed.
+type LockFreeIterator struct {
+	list    *LockFreeSkipList
+	current *LockFreeEntry
+}
+
+// Valid reports whether the cursor is at an entry, it is the same as HasNext.
+func (iterator *LockFreeIterator) Valid() bool {
+	return iterator.current != nil
+}
+
+// Current returns the current entry without moving the cursor, nil if the cursor is not valid.
+func (iterator *LockFreeIterator) Current() *LockFreeEntry {
+	return iterator.current
+}
+
+// Next moves the cursor forward.
+func (iterator *LockFreeIterator) Next() {
+	if iterator.current != nil {
+		iterator.current = iterator.current.NextEntry()
+	}
+}
+
+// Prev moves the cursor backward, the cursor is not valid once it moves before the first entry.
+func (iterator *LockFreeIterator) Prev() {
+	if iterator.current != nil {
+		iterator.current = iterator.list.lastBefore(iterator.current.key)
+	}
+}
+
+func (iterator *LockFreeIterator) First() {
+	iterator.current = iterator.list.First()
+}
+
+func (iterator *LockFreeIterator) Last() {
+	iterator.current = iterator.list.Back()
+}
+
+// Seek moves the cursor to the first live entry not less than the key.
+func (iterator *LockFreeIterator) Seek(key interface{}) {
+	iterator.current = iterator.list.seek(key)
+}
+
+// SeekForPrev moves the cursor to the last live entry not greater than the key.
+func (iterator *LockFreeIterator) SeekForPrev(key interface{}) {
+	iterator.current = iterator.list.seekForPrev(key)
+}
+
+func (iterator *LockFreeIterator) HasNext() bool {
+	return iterator.current != nil
+}
+
+// Get returns the current entry and moves the cursor forward.
+func (iterator *LockFreeIterator) Get() *LockFreeEntry {
+	current := iterator.current
+	if current != nil {
+		iterator.current = current.NextEntry()
+	}
+	return current
+}
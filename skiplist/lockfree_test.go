@@ -0,0 +1,83 @@
+package skiplist
+
+import (
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"sync"
+	"testing"
+)
+
+func TestLockFreeSkipList_ConcurrentSet(t *testing.T) {
+	list := NewLockFreeSkipList(common.TypeMVCCBytes)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := []byte(fmt.Sprintf("key-%d-%04d", g, i))
+				list.Set(common.MakeMVCCKey(key, uint64(g*1000+i+1), common.OpPut, 0), key)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if list.Length() != 8000 {
+		t.Fatalf("the length is supposed to be 8000, got %d", list.Length())
+	}
+	var prev interface{} = nil
+	count := 0
+	for iterator := list.Iterator(); iterator.HasNext(); count++ {
+		e := iterator.Get()
+		if prev != nil && common.TypeMVCCBytes.ModifyCompare(prev, e.Key()) >= 0 {
+			t.Fatalf("the entries are supposed to be ordered")
+		}
+		prev = e.Key()
+	}
+	if count != 8000 {
+		t.Errorf("the iterator is supposed to return 8000 entries, got %d", count)
+	}
+	query := common.MakeIsoMVCCKey([]byte("key-3-0042"), 0xFFFFFFFF, common.OpGet, 0, common.ReadCommitted)
+	if e := list.GetEntry(query); e == nil || string(e.Value()) != "key-3-0042" {
+		t.Errorf("the entry is supposed to be found, got %v", e)
+	}
+	if list.BytesSize() < 8000*len("key-0-0000")*2 {
+		t.Errorf("the arena is supposed to account the keys and the values, got %d", list.BytesSize())
+	}
+}
+
+func TestLockFreeSkipList_Delete(t *testing.T) {
+	list := NewLockFreeSkipList(common.TypeMVCCBytes)
+	list.Set(common.MakeMVCCKey([]byte("a"), 1, common.OpPut, 0), []byte("a1"))
+	list.Set(common.MakeMVCCKey([]byte("a"), 2, common.OpPut, 7), []byte("a2"))
+	list.Set(common.MakeMVCCKey([]byte("b"), 3, common.OpPut, 0), []byte("b3"))
+	// the uncommitted version conflicts with the write of another transaction
+	if _, ok := list.Set(common.MakeMVCCKey([]byte("a"), 4, common.OpPut, 8), []byte("a4")); ok {
+		t.Errorf("the write is supposed to conflict with the uncommitted version")
+	}
+	if e := list.Delete(common.MakeMVCCKey([]byte("a"), 2, common.OpPut, 0)); e == nil || string(e.Value()) != "a2" {
+		t.Fatalf("the uncommitted version is supposed to be deleted, got %v", e)
+	}
+	if e := list.Delete(common.MakeMVCCKey([]byte("a"), 2, common.OpPut, 0)); e != nil {
+		t.Errorf("the deleted entry is supposed to be deleted only once")
+	}
+	query := common.MakeIsoMVCCKey([]byte("a"), 10, common.OpGet, 0, common.ReadCommitted)
+	if e := list.GetEntry(query); e == nil || string(e.Value()) != "a1" {
+		t.Errorf("the committed version is supposed to be visible after the delete, got %v", e)
+	}
+	// the deleted version is linked again ahead of the deleted entry
+	list.Set(common.MakeMVCCKey([]byte("a"), 2, common.OpPut, 0), []byte("a2'"))
+	if e := list.GetEntry(query); e == nil || string(e.Value()) != "a2'" {
+		t.Errorf("the version set again is supposed to be visible, got %v", e)
+	}
+	if list.Length() != 3 {
+		t.Errorf("the length is supposed to be 3, got %d", list.Length())
+	}
+	start := common.MakeIsoMVCCKey([]byte("a"), 10, common.OpGet, 0, common.RepeatableRead)
+	end := common.MakeIsoMVCCKey([]byte("c"), 10, common.OpGet, 0, common.RepeatableRead)
+	if result := list.Range(start, end, 10); len(result) != 2 || string(result[0].Value()) != "a2'" {
+		t.Errorf("the range is supposed to return the newest versions of a and b, got %d entries", len(result))
+	}
+	if e := list.Back(); e == nil || string(e.Value()) != "b3" {
+		t.Errorf("the last entry is supposed to be b, got %v", e)
+	}
+}
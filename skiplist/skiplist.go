@@ -36,6 +36,7 @@ func NewSkipList(elementType common.Comparable) *SkipList {
 	return &SkipList{
 		EntryBase: EntryBase{
 			levels: make([]*Entry, DefaultMaxLevel),
+			spans:  make([]int, DefaultMaxLevel),
 		},
 		keyType:      elementType,
 		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
@@ -49,6 +50,7 @@ func ConcurrentSkipList(elementType common.Comparable) *SkipList {
 	return &SkipList{
 		EntryBase: EntryBase{
 			levels: make([]*Entry, DefaultMaxLevel),
+			spans:  make([]int, DefaultMaxLevel),
 		},
 		keyType:      elementType,
 		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
@@ -116,6 +118,9 @@ func (list *SkipList) Set(key, value interface{}) (*Entry, bool) {
 				list.EntryBase.levels[i] = newEntry
 				list.back = newEntry
 			}
+			for i := range list.EntryBase.spans {
+				list.EntryBase.spans[i] = 1
+			}
 			list.length += 1
 			if list.concurrent {
 				list.lock.Unlock()
@@ -126,11 +131,14 @@ func (list *SkipList) Set(key, value interface{}) (*Entry, bool) {
 	}
 
 	// previousLevels: the previous entry of every level
+	// ranks: the number of the entries before and including the previous entry of every level
 	previousLevels := make([]*EntryBase, list.maxLevel)
+	ranks := make([]int, list.maxLevel)
 	if list.concurrent {
 		list.lock.RLock()
 	}
 	currentEntry := &list.EntryBase
+	rank := 0
 	// search the position at every level for insertion
 	for i := list.maxLevel - 1; i >= 0; {
 		for nextEntry := currentEntry.levels[i]; nextEntry != nil; nextEntry = currentEntry.levels[i] {
@@ -138,19 +146,22 @@ func (list *SkipList) Set(key, value interface{}) (*Entry, bool) {
 				if comp == 0 {
 					nextEntry.Value = value
 					if list.concurrent {
-						list.lock.Unlock()
+						list.lock.RUnlock()
 					}
 					return nextEntry, true
 				}
 				break
 			}
+			rank += currentEntry.spans[i]
 			currentEntry = &nextEntry.EntryBase
 		}
 		previousLevels[i] = currentEntry
+		ranks[i] = rank
 		// skip the level if they point the same entry as the higher level
 		topLevel := currentEntry.levels[i]
 		for i--; i >= 0 && currentEntry.levels[i] == topLevel; i-- {
 			previousLevels[i] = currentEntry
+			ranks[i] = rank
 		}
 	}
 	if list.concurrent {
@@ -163,15 +174,19 @@ func (list *SkipList) Set(key, value interface{}) (*Entry, bool) {
 	// commit the insert operation, acquire the lock if concurrent is true
 	// setup prev field at level 0
 	if previousLevels[0].levels[0] != nil {
-		previousLevels[0].levels[0].prev = newEntry
 		// **if there is another active trx edit the key, there must be a key record with smaller seq**
 		if list.keyType == common.TypeMVCCBytes {
 			mvccKey := key.(*common.MVCCKey)
 			nextKey := previousLevels[0].levels[0].key.(*common.MVCCKey)
 			if bytes.Equal(nextKey.Content, mvccKey.Content) && nextKey.TrxId != 0 && nextKey.TrxId != mvccKey.TrxId {
+				if list.concurrent {
+					list.lock.Unlock()
+				}
 				return previousLevels[0].levels[0], false
 			}
 		}
+		// the prev field is only set once the insert is sure to be committed
+		previousLevels[0].levels[0].prev = newEntry
 	}
 	if prev := previousLevels[0]; prev != &list.EntryBase {
 		newEntry.prev = prev.Entry()
@@ -181,6 +196,13 @@ func (list *SkipList) Set(key, value interface{}) (*Entry, bool) {
 	for i := 0; i < randomLevel; i++ {
 		newEntry.levels[i] = previousLevels[i].levels[i]
 		previousLevels[i].levels[i] = newEntry
+		// the new entry is the (ranks[0] - ranks[i] + 1)th entry after the previous entry of the level
+		newEntry.spans[i] = previousLevels[i].spans[i] - (ranks[0] - ranks[i])
+		previousLevels[i].spans[i] = ranks[0] - ranks[i] + 1
+	}
+	// the higher levels skip one more entry
+	for i := randomLevel; i < list.maxLevel; i++ {
+		previousLevels[i].spans[i] += 1
 	}
 	list.length += 1
 	if list.concurrent {
@@ -237,8 +259,8 @@ func (list *SkipList) GetEntry(key interface{}) (result *Entry) {
 								}
 								//
 							}
-						} else if mvccKey.IsoLevel == common.RepeatableRead {
-							// repeatable read
+						} else if mvccKey.IsoLevel == common.RepeatableRead || mvccKey.IsoLevel == common.Serializable {
+							// repeatable read, the serializable transactions read the same snapshot
 							if nextMVCCKey := nextEntry.key.(*common.MVCCKey);
 								(nextMVCCKey.Seq <= mvccKey.Seq && nextMVCCKey.TrxId == 0x00000000) &&
 									nextMVCCKey.TrxId == mvccKey.TrxId {
@@ -299,12 +321,19 @@ func (list *SkipList) Delete(key interface{}) *Entry {
 	}
 	// remove the entry at every level
 	if specifiedEntry != nil {
-		for i := 0; i < len(specifiedEntry.levels); i++ {
-			previousLevels[i].levels[i] = specifiedEntry.levels[i]
-			if specifiedEntry.levels[i] != nil {
-				specifiedEntry.levels[i].prev = previousLevels[i].Entry()
+		for i := 0; i < list.maxLevel; i++ {
+			if i < len(specifiedEntry.levels) {
+				previousLevels[i].spans[i] += specifiedEntry.spans[i] - 1
+				previousLevels[i].levels[i] = specifiedEntry.levels[i]
+			} else {
+				previousLevels[i].spans[i] -= 1
 			}
 		}
+		list.length -= 1
+		// the prev field is the previous entry at level 0, nil if the entry is the first one
+		if next := specifiedEntry.levels[0]; next != nil {
+			next.prev = specifiedEntry.prev
+		}
 		if specifiedEntry == list.back {
 			list.back = specifiedEntry.prev
 		}
@@ -327,6 +356,84 @@ func (list *SkipList) LevelStatistics() {
 	common.Always()
 }
 
+// lowerBound returns the first entry not less than the key and the number of the entries less than the key.
+func (list *SkipList) lowerBound(key interface{}) (int, *Entry) {
+	if list.concurrent {
+		list.lock.RLock()
+		defer list.lock.RUnlock()
+	}
+	currentEntry := &list.EntryBase
+	rank := 0
+	for i := list.maxLevel - 1; i >= 0; i-- {
+		for nextEntry := currentEntry.levels[i]; nextEntry != nil; nextEntry = currentEntry.levels[i] {
+			if list.keyType.ModifyCompare(key, nextEntry.key) <= 0 {
+				break
+			}
+			rank += currentEntry.spans[i]
+			currentEntry = &nextEntry.EntryBase
+		}
+	}
+	return rank, currentEntry.levels[0]
+}
+
+// seekForPrev returns the last entry not greater than the key and its index, -1 if there is no such entry.
+func (list *SkipList) seekForPrev(key interface{}) (*Entry, int) {
+	rank, e := list.lowerBound(key)
+	if e != nil && list.keyType.ModifyCompare(key, e.key) == 0 {
+		return e, rank
+	}
+	if rank == 0 {
+		return nil, -1
+	}
+	if e == nil {
+		return list.back, rank - 1
+	}
+	return e.prev, rank - 1
+}
+
+// Rank returns the index of the entry equal to the key in the order of the ModifyCompare, -1 if the key is not found.
+// Each version of the MVCC keys is an entry of its own.
+func (list *SkipList) Rank(key interface{}) int {
+	rank, e := list.lowerBound(key)
+	if e == nil || list.keyType.ModifyCompare(key, e.key) != 0 {
+		return -1
+	}
+	return rank
+}
+
+// ByIndex returns the entry at the index, nil if the index is out of the range.
+func (list *SkipList) ByIndex(index int) *Entry {
+	if list.concurrent {
+		list.lock.RLock()
+		defer list.lock.RUnlock()
+	}
+	if index < 0 || index >= list.length {
+		return nil
+	}
+	currentEntry := &list.EntryBase
+	traversed := 0
+	for i := list.maxLevel - 1; i >= 0; i-- {
+		for nextEntry := currentEntry.levels[i]; nextEntry != nil && traversed+currentEntry.spans[i] <= index+1; nextEntry = currentEntry.levels[i] {
+			traversed += currentEntry.spans[i]
+			currentEntry = &nextEntry.EntryBase
+		}
+		if traversed == index+1 {
+			return currentEntry.Entry()
+		}
+	}
+	return nil
+}
+
+// CountRange returns the number of the entries in the [start, end) range.
+func (list *SkipList) CountRange(start, end interface{}) int {
+	startRank, _ := list.lowerBound(start)
+	endRank, _ := list.lowerBound(end)
+	if endRank < startRank {
+		return 0
+	}
+	return endRank - startRank
+}
+
 func (list *SkipList) Iterator() *ListIterator {
 	return NewListIterator(list)
 }
@@ -349,37 +456,51 @@ func (list *SkipList) SyncCustomOperation(task func()) {
 	defer list.lock.RUnlock()
 }
 
+// Visible reports whether the version is visible to the reader under the isolation level of the query key,
+// which is the same as the rules of GetEntry.
+func Visible(version, query *common.MVCCKey) bool {
+	switch query.IsoLevel {
+	case common.ReadCommitted:
+		return version.TrxId == 0 || version.TrxId == query.TrxId
+	case common.RepeatableRead, common.Serializable:
+		return version.Seq <= query.Seq && version.TrxId == 0 && version.TrxId == query.TrxId
+	default:
+		return true
+	}
+}
+
+// Range returns at most count entries in [start, end) after skipping offset entries by the spans. The offset counts
+// the entries instead of the visible versions, so it is supposed to be 0 for the MVCC keys.
 func (list *SkipList) Range(start, end interface{}, count, offset int) []*Entry {
 	preAlloc := 4096
 	if count < 4096 {
 		preAlloc = count
 	}
-	currentOffset, currentCount := 0, 0
+	currentCount := 0
 	result := make([]*Entry, 0, preAlloc)
-	leftmostEntry := list.First()
+	// the offset entries after the start are skipped by the spans
+	rank, _ := list.lowerBound(start)
+	leftmostEntry := list.ByIndex(rank + offset)
 	var prevContent []byte = nil
 	for currentEntry := leftmostEntry; currentEntry != nil; currentEntry = currentEntry.NextEntry() {
-		if cmp := list.keyType.ModifyCompare(currentEntry.key, start); cmp >= 0 {
-			if list.keyType.ModifyCompare(currentEntry.key, end) < 0 {
-				if currentOffset >= offset {
-					//
-					currentKey := currentEntry.Key().(*common.MVCCKey)
-					if prevContent != nil && bytes.Equal(currentKey.Content, prevContent) {
-						continue
-					} else {
-						prevContent = currentKey.Content
-					}
-					if currentKey.KT != common.OpDelete {
-						result = append(result, currentEntry)
-						currentCount += 1
-						if currentCount >= count {
-							break
-						}
-					}
-				} else {
-					currentOffset += 1
-				}
-			} else {
+		if list.keyType.ModifyCompare(currentEntry.key, end) >= 0 {
+			break
+		}
+		if list.keyType == common.TypeMVCCBytes {
+			currentKey := currentEntry.Key().(*common.MVCCKey)
+			if prevContent != nil && bytes.Equal(currentKey.Content, prevContent) {
+				continue
+			}
+			// the newest version visible to the reader is the first one in the order of the seq
+			if !Visible(currentKey, start.(*common.MVCCKey)) {
+				continue
+			}
+			prevContent = currentKey.Content
+		}
+		if list.keyType.OpType(currentEntry.key) != common.OpDelete {
+			result = append(result, currentEntry)
+			currentCount += 1
+			if currentCount >= count {
 				break
 			}
 		}
@@ -3,6 +3,8 @@ package skiplist
 import (
 	"github.com/LaJunkai/drifterdb/common"
 	"fmt"
+	"math/rand"
+	"sort"
 	"testing"
 	"time"
 )
@@ -207,3 +209,53 @@ func TestSkipList_Range(t *testing.T) {
 		fmt.Print(i.Key().(string), ",")
 	}
 }
+
+func TestSkipList_Rank(t *testing.T) {
+	list := NewSkipList(common.TypeMVCCBytes)
+	r := rand.New(rand.NewSource(1))
+	present := make(map[int]bool)
+	for i := 0; i < 3000; i++ {
+		n := r.Intn(1000)
+		if r.Intn(3) == 0 {
+			list.Delete(keyOf(n))
+			delete(present, n)
+		} else {
+			list.Set(keyOf(n), n)
+			present[n] = true
+		}
+	}
+	sorted := make([]int, 0, len(present))
+	for n := range present {
+		sorted = append(sorted, n)
+	}
+	sort.Ints(sorted)
+	if list.Length() != len(sorted) {
+		t.Fatalf("the length is supposed to be %d, got %d", len(sorted), list.Length())
+	}
+	for i, n := range sorted {
+		if rank := list.Rank(keyOf(n)); rank != i {
+			t.Fatalf("the rank of %d is supposed to be %d, got %d", n, i, rank)
+		}
+		if e := list.ByIndex(i); e == nil || e.Value != n {
+			t.Fatalf("the entry at %d is supposed to be %d, got %v", i, n, e)
+		}
+	}
+	if list.ByIndex(len(sorted)) != nil || list.ByIndex(-1) != nil {
+		t.Errorf("the index out of the range is supposed to return nil")
+	}
+	for i := 0; i < 100; i++ {
+		a, b := r.Intn(1000), r.Intn(1000)
+		expected := sort.SearchInts(sorted, b) - sort.SearchInts(sorted, a)
+		if expected < 0 {
+			expected = 0
+		}
+		if count := list.CountRange(keyOf(a), keyOf(b)); count != expected {
+			t.Fatalf("the count of [%d, %d) is supposed to be %d, got %d", a, b, expected, count)
+		}
+	}
+	query := common.MakeMVCCKey([]byte("key100"), 0xFFFFFFFF, common.OpGet, 0)
+	from := sort.SearchInts(sorted, 100)
+	if result := list.Range(query, keyOf(999), 5, 10); len(result) != 5 || result[0].Value != sorted[from+10] {
+		t.Errorf("the range is supposed to skip the offset entries, got %v", result)
+	}
+}
@@ -0,0 +1,216 @@
+package drifterdb
+
+import (
+	"bytes"
+	"github.com/LaJunkai/drifterdb/common"
+	"github.com/LaJunkai/drifterdb/skiplist"
+	"sync/atomic"
+)
+
+// Snapshot is a consistent point-in-time view of the db, the records with seq larger than the seq of the snapshot
+// are invisible to the reads with the snapshot. The snapshot pins its version and the memtables at the time it is
+// taken until it is released, it takes no lock and is not registered in the TransactionSet.
+type Snapshot struct {
+	seq      uint64
+	version  *Version
+	released bool
+	// memtables are the active, frozen and immutable memtables from the newest to the oldest
+	memtables []Memtable
+	// invisible are the seqs of the versions written by the transactions open at the snapshot,
+	// which are invisible to the snapshot even if the transactions are committed later.
+	invisible map[uint64]struct{}
+}
+
+func (s *Snapshot) Seq() uint64 {
+	return s.seq
+}
+
+// ReadOptions controls the reads out of the transactions, the latest committed records are read if Snapshot is nil.
+type ReadOptions struct {
+	Snapshot *Snapshot
+}
+
+// AcquireSnapshot pins the current version and registers a snapshot of the seq.
+func (s *Storage) AcquireSnapshot(seq uint64) *Snapshot {
+	snapshot := &Snapshot{seq: seq, version: s.GetVersion()}
+	s.versionLock.Lock()
+	defer s.versionLock.Unlock()
+	s.snapshots[snapshot] = struct{}{}
+	return snapshot
+}
+
+func (s *Storage) ReleaseSnapshot(snapshot *Snapshot) {
+	s.versionLock.Lock()
+	if snapshot.released {
+		s.versionLock.Unlock()
+		return
+	}
+	snapshot.released = true
+	delete(s.snapshots, snapshot)
+	s.versionLock.Unlock()
+	s.ReleaseVersion(snapshot.version)
+}
+
+// OldestSnapshotSeq returns the seq of the oldest snapshot, the versions of the keys visible to it
+// must be preserved by the compaction. false is returned if there is no snapshot.
+func (s *Storage) OldestSnapshotSeq() (uint64, bool) {
+	s.versionLock.Lock()
+	defer s.versionLock.Unlock()
+	var oldest uint64 = 0xFFFFFFFFFFFFFFFF
+	for snapshot := range s.snapshots {
+		if snapshot.seq < oldest {
+			oldest = snapshot.seq
+		}
+	}
+	return oldest, len(s.snapshots) != 0
+}
+
+// GetSnapshot returns a snapshot of the committed records, it is supposed to be released by ReleaseSnapshot.
+func (db *DrifterDB) GetSnapshot() *Snapshot {
+	// the version and the memtables are switched with the switchMemtableLock held, so they are pinned together
+	db.switchMemtableLock.RLock()
+	defer db.switchMemtableLock.RUnlock()
+	// the batches are applied with the memtableLock held, so the snapshot never sees a part of a batch
+	db.memtableLock.RLock()
+	defer db.memtableLock.RUnlock()
+	snapshot := db.storage.AcquireSnapshot(atomic.LoadUint64(&db.seq))
+	snapshot.memtables = make([]Memtable, 0, 1+len(db.frozenMemtables)+len(db.immutableMemtables))
+	snapshot.memtables = append(snapshot.memtables, db.memtable)
+	for i := len(db.frozenMemtables) - 1; i >= 0; i-- {
+		snapshot.memtables = append(snapshot.memtables, db.frozenMemtables[i])
+	}
+	for i := len(db.immutableMemtables) - 1; i >= 0; i-- {
+		snapshot.memtables = append(snapshot.memtables, db.immutableMemtables[i])
+	}
+	snapshot.invisible = db.transactionSet.uncommittedSeqs()
+	return snapshot
+}
+
+// uncommittedSeqs returns the seqs of the uncommitted versions written by the open transactions,
+// it is supposed to be called with the memtableLock held.
+func (ts *TransactionSet) uncommittedSeqs() map[uint64]struct{} {
+	seqs := make(map[uint64]struct{})
+	ts.Transactions.Range(func(key, value interface{}) bool {
+		trx := value.(*Transaction)
+		trx.recordLock.Lock()
+		for _, r := range trx.modificationRecord {
+			if r.key.TrxId != 0 {
+				seqs[r.key.Seq] = struct{}{}
+			}
+		}
+		trx.recordLock.Unlock()
+		return true
+	})
+	return seqs
+}
+
+func (db *DrifterDB) ReleaseSnapshot(snapshot *Snapshot) {
+	db.storage.ReleaseSnapshot(snapshot)
+}
+
+// OldestSnapshotSeq returns the seq of the oldest snapshot held by the readers.
+func (db *DrifterDB) OldestSnapshotSeq() (uint64, bool) {
+	return db.storage.OldestSnapshotSeq()
+}
+
+// readView returns a ReadView of the snapshot of the options and the function to release it,
+// a temporary snapshot is taken if the options carry no snapshot.
+func (db *DrifterDB) readView(opts *ReadOptions) (*ReadView, func(), error) {
+	snapshot, release := (*Snapshot)(nil), func() {}
+	if opts != nil && opts.Snapshot != nil {
+		snapshot = opts.Snapshot
+		if snapshot.released {
+			return nil, nil, ErrSnapshotReleased
+		}
+	} else {
+		snapshot = db.GetSnapshot()
+		release = func() { db.ReleaseSnapshot(snapshot) }
+	}
+	return &ReadView{
+		db:             db,
+		readSeq:        snapshot.seq,
+		IsolationLevel: common.RepeatableRead,
+		version:        snapshot.version,
+		memtables:      snapshot.memtables,
+		invisible:      snapshot.invisible,
+	}, release, nil
+}
+
+// visible reports whether the version in a memtable pinned by the snapshot is visible to the query.
+func (rv *ReadView) visible(key, query *common.MVCCKey) bool {
+	if _, ok := rv.invisible[key.Seq]; ok {
+		return false
+	}
+	return skiplist.Visible(key, query)
+}
+
+// getPinned looks up the key in the memtables pinned by the snapshot, found is false if no version of the key
+// in the memtables is visible, and the value is nil if the visible version is deleted.
+func (rv *ReadView) getPinned(mvccKey *common.MVCCKey) (value []byte, found bool) {
+	for _, table := range rv.memtables {
+		i := table.Iterator()
+		for i.Seek(mvccKey); i.Valid(); i.Next() {
+			key := i.Key().(*common.MVCCKey)
+			if !bytes.Equal(key.Content, mvccKey.Content) {
+				break
+			}
+			if !rv.visible(key, mvccKey) {
+				continue
+			}
+			if key.KT == common.OpDelete {
+				return nil, true
+			}
+			return i.Value(), true
+		}
+	}
+	return nil, false
+}
+
+// rangePinned returns the first count visible records of [start, end) in the memtable pinned by the snapshot,
+// the deleted keys are skipped as the Range of the memtables does.
+func (rv *ReadView) rangePinned(table Memtable, start, end *common.MVCCKey, count int) []*Element {
+	result := make([]*Element, 0)
+	var prevContent []byte = nil
+	i := table.Iterator()
+	for i.Seek(start); i.Valid() && len(result) < count; i.Next() {
+		key := i.Key().(*common.MVCCKey)
+		if bytes.Compare(key.Content, end.Content) >= 0 {
+			break
+		}
+		if prevContent != nil && bytes.Equal(key.Content, prevContent) || !rv.visible(key, start) {
+			continue
+		}
+		prevContent = key.Content
+		if key.KT != common.OpDelete {
+			result = append(result, &Element{key: key, value: i.Value()})
+		}
+	}
+	return result
+}
+
+func (db *DrifterDB) GetWithOptions(opts *ReadOptions, key []byte) ([]byte, error) {
+	rv, release, err := db.readView(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return rv.Get(key), nil
+}
+
+func (db *DrifterDB) RangeWithOptions(opts *ReadOptions, start, end []byte, count, offset int) ([]*Element, error) {
+	rv, release, err := db.readView(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return rv.Range(start, end, count, offset), nil
+}
+
+func (db *DrifterDB) PrefixRangeWithOptions(opts *ReadOptions, prefix []byte, count, offset int) ([]*Element, error) {
+	rv, release, err := db.readView(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return rv.PrefixRange(prefix, count, offset), nil
+}
@@ -0,0 +1,89 @@
+package drifterdb
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestDrifterDB_GetSnapshot(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	db.Put([]byte("k1"), []byte("old"))
+	db.Put([]byte("k2"), []byte("old"))
+	snapshot := db.GetSnapshot()
+	db.Put([]byte("k1"), []byte("new"))
+	db.Put([]byte("k3"), []byte("new"))
+	opts := &ReadOptions{Snapshot: snapshot}
+	if v, err := db.GetWithOptions(opts, []byte("k1")); err != nil || string(v) != "old" {
+		t.Errorf("the snapshot is supposed to read the old value, got %s, %v", v, err)
+	}
+	if v, _ := db.GetWithOptions(nil, []byte("k1")); string(v) != "new" {
+		t.Errorf("the read without snapshot is supposed to read the latest value, got %s", v)
+	}
+	result, err := db.RangeWithOptions(opts, []byte("k"), []byte("l"), 10, 0)
+	if err != nil || len(result) != 2 {
+		t.Errorf("the range of the snapshot is supposed to return 2 records, got %v, %v", len(result), err)
+	}
+	if seq, ok := db.OldestSnapshotSeq(); !ok || seq != snapshot.Seq() {
+		t.Errorf("the oldest snapshot is supposed to be %v, got %v", snapshot.Seq(), seq)
+	}
+	db.ReleaseSnapshot(snapshot)
+	db.ReleaseSnapshot(snapshot)
+	if _, ok := db.OldestSnapshotSeq(); ok {
+		t.Errorf("no snapshot is supposed to be left")
+	}
+	if _, err := db.GetWithOptions(opts, []byte("k1")); err != ErrSnapshotReleased {
+		t.Errorf("the read with the released snapshot is supposed to fail, got %v", err)
+	}
+}
+
+func TestDrifterDB_GetSnapshot_UncommittedWrites(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	db.Put([]byte("k1"), []byte("old"))
+	trx := db.StartTransaction()
+	if err := trx.Put([]byte("k1"), []byte("new")); err != nil {
+		t.Fatalf("the write is supposed to succeed, got %v", err)
+	}
+	if err := trx.Put([]byte("k2"), []byte("new")); err != nil {
+		t.Fatalf("the write is supposed to succeed, got %v", err)
+	}
+	snapshot := db.GetSnapshot()
+	defer db.ReleaseSnapshot(snapshot)
+	if err := db.CommitTransaction(trx); err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	opts := &ReadOptions{Snapshot: snapshot}
+	if v, _ := db.GetWithOptions(opts, []byte("k1")); string(v) != "old" {
+		t.Errorf("the writes committed after the snapshot are supposed to be invisible, got %s", v)
+	}
+	if v, _ := db.GetWithOptions(opts, []byte("k2")); v != nil {
+		t.Errorf("the writes committed after the snapshot are supposed to be invisible, got %s", v)
+	}
+	result, _ := db.RangeWithOptions(opts, []byte("k"), []byte("l"), 10, 0)
+	if len(result) != 1 || string(result[0].Value()) != "old" {
+		t.Errorf("the range of the snapshot is supposed to return the old record only, got %v", result)
+	}
+	if v, _ := db.GetWithOptions(nil, []byte("k1")); string(v) != "new" {
+		t.Errorf("the read without snapshot is supposed to read the committed value, got %s", v)
+	}
+}
+
+func TestDrifterDB_GetSnapshot_Flush(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	addImmutableMemtables(db, 1, 10)
+	atomic.StoreUint64(&db.seq, 10)
+	snapshot := db.GetSnapshot()
+	defer db.ReleaseSnapshot(snapshot)
+	job := db.claimFlushJob()
+	job.run(db.storage)
+	db.installFlushJob(job)
+	opts := &ReadOptions{Snapshot: snapshot}
+	if v, _ := db.GetWithOptions(opts, []byte("key003")); string(v) != "value0" {
+		t.Errorf("the memtable flushed after the snapshot is supposed to be read by the snapshot, got %s", v)
+	}
+	if result, _ := db.RangeWithOptions(opts, []byte("key"), []byte("kez"), 20, 0); len(result) != 10 {
+		t.Errorf("the range of the snapshot is supposed to return 10 records, got %v", len(result))
+	}
+}
@@ -0,0 +1,264 @@
+package drifterdb
+
+import (
+	"bytes"
+	"github.com/LaJunkai/drifterdb/common"
+	"sync"
+)
+
+/*
+Serializable Snapshot Isolation
+
+Serializable transactions read the snapshot as the repeatable read transactions do, and their read sets (keys and
+ranges) and write sets are tracked by the ssiTracker to detect the rw-antidependencies among the concurrent transactions.
+A rw-antidependency T1 -> T2 exists if T1 read a key which is written by the concurrent transaction T2,
+which means T1 must be serialized before T2.
+
+A commit is rejected with ErrSerializationFailure if the transaction is the pivot of a dangerous structure
+(T0 -> T1 -> T2), or the transaction forms a dangerous structure together with a committed pivot.
+The detection is conservative, so false positives are possible and the rejected transactions should be retried.
+*/
+
+type ssiTransaction struct {
+	trxId    uint32
+	snapshot uint64
+	// commitSeq is 0 until the transaction is committed
+	commitSeq uint64
+	aborted   bool
+	reads     *readSet
+	writeKeys [][]byte
+	// in: the transactions which have a rw-antidependency to the transaction
+	// out: the transactions which the transaction has a rw-antidependency to
+	in  map[*ssiTransaction]struct{}
+	out map[*ssiTransaction]struct{}
+}
+
+// ssiPreparedSeq is the commitSeq of the prepared transactions, which is larger than any snapshot.
+const ssiPreparedSeq uint64 = 0xFFFFFFFFFFFFFFFF
+
+func (t *ssiTransaction) committed() bool {
+	return t.commitSeq != 0
+}
+
+// concurrentWith reports whether the other transaction is invisible to the snapshot of the transaction.
+func (t *ssiTransaction) concurrentWith(other *ssiTransaction) bool {
+	return !other.aborted && (!other.committed() || other.commitSeq > t.snapshot)
+}
+
+// readSet records the keys and the [start, end) ranges read by a transaction.
+type readSet struct {
+	keys   [][]byte
+	ranges [][2][]byte
+}
+
+func newReadSet() *readSet {
+	return &readSet{keys: make([][]byte, 0), ranges: make([][2][]byte, 0)}
+}
+
+func (r *readSet) AddKey(key []byte) {
+	r.keys = append(r.keys, key)
+}
+
+func (r *readSet) AddRange(start, end []byte) {
+	r.ranges = append(r.ranges, [2][]byte{start, end})
+}
+
+func (r *readSet) Contains(key []byte) bool {
+	for _, k := range r.keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	for _, rg := range r.ranges {
+		if bytes.Compare(rg[0], key) <= 0 && bytes.Compare(key, rg[1]) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *ssiTransaction) hasRead(key []byte) bool {
+	return t.reads.Contains(key)
+}
+
+func (t *ssiTransaction) hasWrittenIn(start, end []byte) bool {
+	for _, k := range t.writeKeys {
+		if bytes.Compare(start, k) <= 0 && bytes.Compare(k, end) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *ssiTransaction) hasWritten(key []byte) bool {
+	for _, k := range t.writeKeys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// countLive returns the number of the edges which are not aborted.
+func countLive(edges map[*ssiTransaction]struct{}) int {
+	n := 0
+	for t := range edges {
+		if !t.aborted {
+			n += 1
+		}
+	}
+	return n
+}
+
+type ssiTracker struct {
+	lock         sync.Mutex
+	transactions map[uint32]*ssiTransaction
+}
+
+func newSSITracker() *ssiTracker {
+	return &ssiTracker{transactions: make(map[uint32]*ssiTransaction)}
+}
+
+func (s *ssiTracker) Begin(trxId uint32, snapshot uint64) *ssiTransaction {
+	t := &ssiTransaction{
+		trxId:     trxId,
+		snapshot:  snapshot,
+		reads:     newReadSet(),
+		writeKeys: make([][]byte, 0),
+		in:        make(map[*ssiTransaction]struct{}),
+		out:       make(map[*ssiTransaction]struct{}),
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.transactions[trxId] = t
+	return t
+}
+
+func addConflict(reader, writer *ssiTransaction) {
+	reader.out[writer] = struct{}{}
+	writer.in[reader] = struct{}{}
+}
+
+// OnRead records the key read by the transaction, the key is copied since the caller may reuse it.
+func (s *ssiTracker) OnRead(t *ssiTransaction, key []byte) {
+	key = common.CopyBytes(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t.reads.AddKey(key)
+	for _, other := range s.transactions {
+		if other != t && t.concurrentWith(other) && other.hasWritten(key) {
+			addConflict(t, other)
+		}
+	}
+}
+
+func (s *ssiTracker) OnRange(t *ssiTransaction, start, end []byte) {
+	start, end = common.CopyBytes(start), common.CopyBytes(end)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t.reads.AddRange(start, end)
+	for _, other := range s.transactions {
+		if other != t && t.concurrentWith(other) && other.hasWrittenIn(start, end) {
+			addConflict(t, other)
+		}
+	}
+}
+
+func (s *ssiTracker) OnWrite(t *ssiTransaction, key []byte) {
+	key = common.CopyBytes(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t.writeKeys = append(t.writeKeys, key)
+	for _, other := range s.transactions {
+		if other != t && t.concurrentWith(other) && other.hasRead(key) {
+			addConflict(other, t)
+		}
+	}
+}
+
+// Commit validate the transaction and mark it committed with the commitSeq,
+// the transaction is aborted and ErrSerializationFailure is returned if it may break the serializability.
+// The writes of the transaction are supposed to be made visible in the same critical section as the commitSeq
+// is taken, and no serializable transaction is supposed to take its snapshot in between, otherwise the transaction
+// taking the snapshot would be treated as serialized after the commit while it can not see the writes.
+func (s *ssiTracker) Commit(t *ssiTransaction, nextSeq func() uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.validate(t); err != nil {
+		return err
+	}
+	t.commitSeq = nextSeq()
+	s.gc()
+	return nil
+}
+
+// Prepare validate the prepared transaction which is treated as committed but concurrent with all the transactions
+// until CommitPrepared, since its writes are not visible to any snapshot before that.
+func (s *ssiTracker) Prepare(t *ssiTransaction) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.validate(t); err != nil {
+		return err
+	}
+	t.commitSeq = ssiPreparedSeq
+	return nil
+}
+
+// CommitPrepared takes the commitSeq of the prepared transaction, the same as Commit it is supposed to be called in
+// the critical section making the writes visible.
+func (s *ssiTracker) CommitPrepared(t *ssiTransaction, nextSeq func() uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t.commitSeq = nextSeq()
+	s.gc()
+}
+
+// validate aborts the transaction if it may break the serializability.
+func (s *ssiTracker) validate(t *ssiTransaction) error {
+	nIn, nOut := countLive(t.in), countLive(t.out)
+	failed := nIn > 0 && nOut > 0
+	for other := range t.out {
+		// t -> committed pivot -> any
+		if !failed && other.committed() && countLive(other.out) > 0 {
+			failed = true
+		}
+	}
+	for other := range t.in {
+		// any -> committed pivot -> t
+		if !failed && other.committed() && countLive(other.in) > 0 {
+			failed = true
+		}
+	}
+	if failed {
+		s.abort(t)
+		return ErrSerializationFailure
+	}
+	return nil
+}
+
+func (s *ssiTracker) Abort(t *ssiTransaction) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.abort(t)
+}
+
+func (s *ssiTracker) abort(t *ssiTransaction) {
+	t.aborted = true
+	delete(s.transactions, t.trxId)
+	s.gc()
+}
+
+// gc remove the committed transactions which are not concurrent with any active transaction.
+func (s *ssiTracker) gc() {
+	var oldestSnapshot uint64 = 0xFFFFFFFFFFFFFFFF
+	for _, t := range s.transactions {
+		if !t.committed() && t.snapshot < oldestSnapshot {
+			oldestSnapshot = t.snapshot
+		}
+	}
+	for trxId, t := range s.transactions {
+		if t.committed() && t.commitSeq <= oldestSnapshot {
+			delete(s.transactions, trxId)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package drifterdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"testing"
+)
+
+type ssiTestClock struct {
+	seq uint64
+}
+
+func (c *ssiTestClock) next() uint64 {
+	c.seq += 1
+	return c.seq
+}
+
+func TestSSITracker_WriteSkew(t *testing.T) {
+	clock := &ssiTestClock{}
+	tracker := newSSITracker()
+	t1 := tracker.Begin(1, clock.next())
+	t2 := tracker.Begin(2, clock.next())
+	// both doctors check the on-call list and leave
+	tracker.OnRange(t1, []byte("oncall:"), []byte("oncall;"))
+	tracker.OnRange(t2, []byte("oncall:"), []byte("oncall;"))
+	tracker.OnWrite(t1, []byte("oncall:alice"))
+	tracker.OnWrite(t2, []byte("oncall:bob"))
+	if err := tracker.Commit(t1, clock.next); err != ErrSerializationFailure {
+		t.Errorf("the first commit is supposed to fail with the serialization failure, got %v", err)
+	}
+	if err := tracker.Commit(t2, clock.next); err != nil {
+		t.Errorf("the second commit is supposed to succeed after the first one is aborted, got %v", err)
+	}
+}
+
+func TestSSITracker_CommittedPivot(t *testing.T) {
+	clock := &ssiTestClock{}
+	tracker := newSSITracker()
+	t1 := tracker.Begin(1, clock.next())
+	t2 := tracker.Begin(2, clock.next())
+	tracker.OnRead(t1, []byte("y"))
+	tracker.OnWrite(t1, []byte("x"))
+	tracker.OnWrite(t2, []byte("y"))
+	// t1 -> t2
+	if err := tracker.Commit(t1, clock.next); err != nil {
+		t.Fatalf("t1 is supposed to be committed, got %v", err)
+	}
+	// t2 -> t1, t2 can not see the write of t1
+	tracker.OnRead(t2, []byte("x"))
+	if err := tracker.Commit(t2, clock.next); err != ErrSerializationFailure {
+		t.Errorf("t2 is supposed to fail with the serialization failure, got %v", err)
+	}
+}
+
+func TestSSITracker_NoConflict(t *testing.T) {
+	clock := &ssiTestClock{}
+	tracker := newSSITracker()
+	t1 := tracker.Begin(1, clock.next())
+	t2 := tracker.Begin(2, clock.next())
+	tracker.OnRead(t1, []byte("a"))
+	tracker.OnWrite(t1, []byte("a"))
+	tracker.OnRead(t2, []byte("b"))
+	tracker.OnWrite(t2, []byte("a"))
+	if err := tracker.Commit(t1, clock.next); err != nil {
+		t.Errorf("t1 is supposed to be committed, got %v", err)
+	}
+	if err := tracker.Commit(t2, clock.next); err != nil {
+		t.Errorf("t2 is supposed to be committed, got %v", err)
+	}
+	// the committed transactions are collected once no active transaction is concurrent with them
+	t3 := tracker.Begin(3, clock.next())
+	tracker.OnRead(t3, []byte("a"))
+	if len(t3.out) != 0 || len(tracker.transactions) != 1 {
+		t.Errorf("the committed transactions are supposed to be invisible to t3")
+	}
+}
+
+func TestSSI_SnapshotDuringCommit(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	ts := db.transactionSet
+	opts := NewTransactionOptions(common.Serializable)
+	for i := 0; i < 100; i++ {
+		value := []byte(fmt.Sprintf("value-%v", i))
+		writer := ts.GetTransactionWithOptions(context.Background(), opts)
+		if err := writer.Put([]byte("key"), value); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error)
+		go func() {
+			done <- ts.CommitTransaction(writer)
+		}()
+		for committing := true; committing; {
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+				committing = false
+			default:
+			}
+			// the reader which can not see the write is supposed to be concurrent with the writer
+			reader := ts.GetTransactionWithOptions(context.Background(), opts)
+			visible := bytes.Equal(reader.Get([]byte("key")), value)
+			ts.ssi.lock.Lock()
+			concurrent := reader.ssi.concurrentWith(writer.ssi)
+			ts.ssi.lock.Unlock()
+			if !visible && !concurrent {
+				t.Fatalf("the reader of the snapshot %v misses the write committed at %v", reader.readSeq, writer.ssi.commitSeq)
+			}
+			ts.RollbackTransaction(reader)
+		}
+	}
+}
+
+func TestSSI_SnapshotDuringPrepared(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	ts := db.transactionSet
+	opts := NewTransactionOptions(common.Serializable)
+	writer := ts.GetTransactionWithOptions(context.Background(), opts)
+	if err := writer.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.PrepareTransaction(writer, "writer"); err != nil {
+		t.Fatal(err)
+	}
+	// the writes of the prepared transaction are not visible until it is committed
+	reader := ts.GetTransactionWithOptions(context.Background(), opts)
+	if reader.Get([]byte("key")) != nil {
+		t.Fatalf("the writes of the prepared transaction are not supposed to be visible")
+	}
+	if err := ts.CommitPrepared("writer"); err != nil {
+		t.Fatal(err)
+	}
+	if !reader.ssi.concurrentWith(writer.ssi) {
+		t.Errorf("the reader is supposed to be concurrent with the prepared transaction")
+	}
+	ts.RollbackTransaction(reader)
+}
+
+func TestSSITracker_CopyKeys(t *testing.T) {
+	tracker := newSSITracker()
+	t1 := tracker.Begin(1, 1)
+	key := []byte("a")
+	tracker.OnRead(t1, key)
+	key[0] = 'b'
+	if !t1.hasRead([]byte("a")) || t1.hasRead([]byte("b")) {
+		t.Errorf("the read key is not supposed to be changed by the caller")
+	}
+}
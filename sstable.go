@@ -41,13 +41,40 @@ data record
 | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
 |          checksum         | kvll | drty |    key length      |      |      |      |      |      |      |      |
 
+
+extension blocks (optional, written behind the data block, e.g. index partitions)
+named blocks are registered in the meta index and the meta index is located by the footer.
+
+meta index record
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+|        name length        |                         offset                        |       size......
+
+| 16   | 17   | 18   | 19   | 20   | 21   | 22   | 23   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+           size            |         name......
+
+footer (the last 32 bytes of the table, tables of the legacy format end with the data block)
+| 0    | 1    | 2    | 3    | 4    | 5    | 6    | 7    | 8    | 9    | 10   | 11   | 12   | 13   | 14   | 15   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+|                   meta index offset                   |     meta index length     |      format version   |
+
+| 16   | 17   | 18   | 19   | 20   | 21   | 22   | 23   | 24   | 25   | 26   | 27   | 28   | 29   | 30   | 31   |
+| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |
+|  h   |  o   |  m   |  e   |  .   |  d   |  r   |  i   |  f   |  t   |  e   |  r   |  .   |  v   |  i   |  p   |
+
 */
 
 const MagicString = "home.drifter.vip"
 const MagicLength = 16
-const BloomFilterK = 4
 const BlockSize = 1 << 12
 const LL = 24
+const FooterLength = 32
+
+const (
+	LegacyTableFormat  = 1
+	TableFormatVersion = 2
+)
 
 type Block struct {
 	offset uint64
@@ -76,12 +103,17 @@ type Table struct {
 	path             string
 	tableSeq         int
 	dataBlockIndex   BlockIndex
-	filter           *bloomfilter.Filter
+	filter           bloomfilter.Filter
 	file             *os.File
 	header           *Header
 	min, max         common.MVCCKey
 	countVersionRefs int
 	level            int
+	// formatVersion and metaBlocks are set up by the footer of the table.
+	formatVersion int
+	metaBlocks    map[string]*Block
+	cache         *BlockCache
+	properties    *TableProperties
 }
 
 func (t *Table) LoadHeaderInfo() {
@@ -125,6 +157,40 @@ func (t *Table) LoadHeaderInfo() {
 	}
 }
 
+// LoadMetaIndex read the footer and the meta index of the table, nothing is loaded for the tables of the legacy format.
+func (t *Table) LoadMetaIndex() {
+	t.formatVersion = LegacyTableFormat
+	t.metaBlocks = make(map[string]*Block)
+	info, err := t.file.Stat()
+	common.Throw(err)
+	dataEnd := t.header.dataBlock.offset + t.header.dataBlock.size
+	if uint64(info.Size()) < dataEnd+FooterLength {
+		return
+	}
+	footer := (&Block{offset: uint64(info.Size()) - FooterLength, size: FooterLength, table: t}).LoadBytes()
+	if string(footer[16:]) != MagicString {
+		return
+	}
+	t.formatVersion = int(binary.LittleEndian.Uint32(footer[12:16]))
+	metaIndexBytes := (&Block{
+		offset: binary.LittleEndian.Uint64(footer[0:8]),
+		size:   uint64(binary.LittleEndian.Uint32(footer[8:12])),
+		table:  t,
+	}).LoadBytes()
+	var cursor uint64 = 0
+	for cursor < uint64(len(metaIndexBytes)) {
+		nameLength := uint64(binary.LittleEndian.Uint32(metaIndexBytes[cursor : cursor+4]))
+		block := &Block{
+			offset: binary.LittleEndian.Uint64(metaIndexBytes[cursor+4 : cursor+12]),
+			size:   binary.LittleEndian.Uint64(metaIndexBytes[cursor+12 : cursor+20]),
+			table:  t,
+		}
+		cursor += 20
+		t.metaBlocks[string(metaIndexBytes[cursor:cursor+nameLength])] = block
+		cursor += nameLength
+	}
+}
+
 // load index block && filter block && minKey && maxKey && data block
 func (t *Table) LoadFullHeader() {
 	br := &BlockReader{}
@@ -138,11 +204,17 @@ func (t *Table) LoadFullHeader() {
 	br.Prepare(t.header.maxKeyBlock, maxKeyBytes)
 	br.Read()
 
-	t.dataBlockIndex = NewLinearIndex(indexBytes, t, t.header.dataBlock.size, minKeyBytes, maxKeyBytes)
+	if topLevelBlock, existed := t.metaBlocks[PartitionedIndexBlockName]; existed {
+		t.dataBlockIndex = NewPartitionedIndex(topLevelBlock.LoadBytes(), t, minKeyBytes, maxKeyBytes)
+	} else {
+		t.dataBlockIndex = NewLinearIndex(indexBytes, t, t.header.dataBlock.size, minKeyBytes, maxKeyBytes)
+	}
 	t.dataBlockIndex.SetBaseOffset(t.header.dataBlock.offset)
-	t.filter = bloomfilter.LoadFilterFromBytes(filterBytes)
+	// filters of the partitioned index are stored along with the partitions
+	t.filter = loadTableFilter(filterBytes)
 	t.min = *common.ParseMVCCKey(minKeyBytes)
 	t.max = *common.ParseMVCCKey(maxKeyBytes)
+	t.loadProperties()
 }
 
 func (t *Table) Get(key *common.MVCCKey) *Element {
@@ -152,7 +224,7 @@ func (t *Table) Get(key *common.MVCCKey) *Element {
 	if cmp := bytes.Compare(key.Content, t.min.Content); cmp < 0 {
 		return nil
 	}
-	if existed := t.filter.Exists(key.Content); !existed {
+	if existed := t.keyMayMatch(key.Content); !existed {
 		return nil
 	}
 	// read from the disk
@@ -169,21 +241,59 @@ func (t *Table) Get(key *common.MVCCKey) *Element {
 
 }
 
+// keyMayMatch consult the filter of the table or the filter of the index partition.
+func (t *Table) keyMayMatch(content []byte) bool {
+	if t.filter != nil {
+		return t.filter.Exists(content)
+	}
+	if partitioned, ok := t.dataBlockIndex.(*PartitionedIndex); ok {
+		return partitioned.KeyMayMatch(content)
+	}
+	return true
+}
+
 func (t *Table) Range(start, end *common.MVCCKey, count, offset int) []*Element {
+	return t.rangeWithPrefix(start, end, count, offset, nil, nil)
+}
+
+// rangeWithPrefix skips the table or the blocks if their filter rejects the prefix,
+// the filters are only consulted if the table is dumped with the same prefix extractor.
+func (t *Table) rangeWithPrefix(start, end *common.MVCCKey, count, offset int, prefix []byte, extractor PrefixExtractor) []*Element {
 	if cmp := bytes.Compare(start.Content, t.max.Content); cmp > 0 {
 		return nil
 	}
 	if cmp := bytes.Compare(end.Content, t.min.Content); cmp < 0 {
 		return nil
 	}
+	var probe []byte = nil
+	partitioned, _ := t.dataBlockIndex.(*PartitionedIndex)
+	if prefix != nil {
+		probe = t.prefixProbe(prefix, extractor)
+		if probe != nil && t.filter != nil && !t.filter.Exists(probe) {
+			return nil
+		}
+	}
 	result := make([]*Element, 0, count)
 	currentCount, currentOffset := 0, 0
 	var prev *common.MVCCKey = nil
-	for index, targetBlock := t.dataBlockIndex.Find(start.Content); targetBlock != nil; targetBlock = t.dataBlockIndex.GetByIndex(index) {
+	// the index finds nothing for the key smaller than the min key of the table
+	seekKey := start.Content
+	if bytes.Compare(seekKey, t.min.Content) < 0 {
+		seekKey = t.min.Content
+	}
+	for index, targetBlock := t.dataBlockIndex.Find(seekKey); targetBlock != nil; targetBlock = t.dataBlockIndex.GetByIndex(index) {
+		if probe != nil && partitioned != nil && !partitioned.BlockMayMatch(index, probe) {
+			index += 1
+			continue
+		}
 		recordsBytes := targetBlock.LoadBytes()
 		elements := RowRecordBytesToElement(recordsBytes)
 		for _, element := range elements {
 			elementKey := element.Key().(*common.MVCCKey)
+			// the elements are sorted, no more element would be in the range
+			if bytes.Compare(elementKey.Content, end.Content) > 0 {
+				return result
+			}
 			if common.TypeMVCCBytes.ModifyCompare(start, elementKey) <= 0 {
 				if common.TypeMVCCBytes.ModifyCompare(end, elementKey) > 0 {
 					if currentOffset >= offset {
@@ -218,9 +328,56 @@ func IndexBlockRecord(key []byte, offset uint64) []byte {
 	return indexBytes
 }
 
+func MetaIndexRecord(name string, offset, size uint64) []byte {
+	recordBytes := make([]byte, 4+8+8+len(name))
+	binary.LittleEndian.PutUint32(recordBytes[:4], uint32(len(name)))
+	binary.LittleEndian.PutUint64(recordBytes[4:12], offset)
+	binary.LittleEndian.PutUint64(recordBytes[12:20], size)
+	copy(recordBytes[20:], name)
+	return recordBytes
+}
+
+// tableExtension collects the blocks written behind the data block, named blocks are registered in the meta index.
+type tableExtension struct {
+	baseOffset uint64
+	content    []byte
+	metaIndex  []byte
+}
+
+func newTableExtension(baseOffset uint64) *tableExtension {
+	return &tableExtension{
+		baseOffset: baseOffset,
+		content:    make([]byte, 0),
+		metaIndex:  make([]byte, 0),
+	}
+}
+
+// Append append the block and return the offset of the block in the table file.
+func (ext *tableExtension) Append(blockBytes []byte) uint64 {
+	offset := ext.baseOffset + uint64(len(ext.content))
+	ext.content = append(ext.content, blockBytes...)
+	return offset
+}
+
+func (ext *tableExtension) AppendNamed(name string, blockBytes []byte) {
+	offset := ext.Append(blockBytes)
+	ext.metaIndex = append(ext.metaIndex, MetaIndexRecord(name, offset, uint64(len(blockBytes)))...)
+}
+
+// Finish return the extension blocks followed by the meta index and the footer.
+func (ext *tableExtension) Finish() []byte {
+	metaIndexOffset := ext.Append(ext.metaIndex)
+	footer := make([]byte, FooterLength)
+	binary.LittleEndian.PutUint64(footer[0:8], metaIndexOffset)
+	binary.LittleEndian.PutUint32(footer[8:12], uint32(len(ext.metaIndex)))
+	binary.LittleEndian.PutUint32(footer[12:16], TableFormatVersion)
+	copy(footer[16:], MagicString)
+	return common.ConcatBytes(ext.content, footer)
+}
+
 func parseSSTablePath(path string) (basePath, tableName string, seq int, level int) {
 	tableFullPath := strings.Split(strings.Replace(path, "\\", "/", math.MaxInt32), "/")
-	basePath = filepath.Join(tableFullPath[:len(tableFullPath)-1]...)
+	basePath = filepath.FromSlash(strings.Join(tableFullPath[:len(tableFullPath)-1], "/"))
 	tableName = tableFullPath[len(tableFullPath)-1]
 	_, err := fmt.Sscanf(tableName, "%02dL%010d.sst", &level, &seq)
 	common.Debug("[parse sstable path]",tableName, level, seq)
@@ -239,6 +396,7 @@ func LoadTable(path string) *Table {
 		level:    level,
 	}
 	newTable.LoadHeaderInfo()
+	newTable.LoadMetaIndex()
 	newTable.LoadFullHeader()
 	common.Debug("[load table]", "index block", newTable.header.indexBlock)
 	common.Debug("[load table]", "filter block", newTable.header.filterBlock)
@@ -257,6 +415,12 @@ func (t *Table) FullPath() string {
 }
 
 func DumpTable(memtable Memtable, path string, memtableSeq int) *Table {
+	return DumpTableWithOption(memtable, path, memtableSeq, 0, DefaultOption())
+}
+
+// DumpTableWithOption dumps the memtable into a table of the level, the filter of the table is built by the filter
+// policy of the level.
+func DumpTableWithOption(memtable Memtable, path string, memtableSeq int, level int, option *Option) *Table {
 	start := time.Now()
 	defer func() {
 		common.Debug("[dump table]", "time cost: ", time.Since(start).Seconds(), "s")
@@ -267,11 +431,20 @@ func DumpTable(memtable Memtable, path string, memtableSeq int) *Table {
 	newTable := &Table{
 		path:     path,
 		tableSeq: memtableSeq,
-		filter:   bloomfilter.NewFrozenFilter(common.MaxInt(int(math.Log2(float64(memtable.Size()))), 7), BloomFilterK),
+		filter:   nil,
 		file:     nil,
 		header:   nil,
-		level:    0,
+		level:    level,
 	}
+	// the partitioned index build the filters along with the index partitions
+	var partitionedIndex *partitionedIndexBuilder
+	filterPolicy := option.FilterPolicyOf(newTable.level)
+	properties := newTablePropertiesBuilder(option)
+	if option.PartitionedIndex {
+		partitionedIndex = newPartitionedIndexBuilder(option.IndexPartitionSize, filterPolicy, option.PrefixExtractor)
+	}
+	// the distinct user keys and prefixes to build the filter
+	filterKeys := newFilterKeysBuilder(option.PrefixExtractor)
 	offset := 0
 	prev := 0
 	tableFile, err := os.OpenFile(
@@ -294,19 +467,31 @@ func DumpTable(memtable Memtable, path string, memtableSeq int) *Table {
 			prev += offset / BlockSize
 			offset %= BlockSize
 			indexOffset := uint64(prev)*uint64(BlockSize) + uint64(offset)
-			indexBytes = common.ConcatBytes(
-				indexBytes, IndexBlockRecord(
-					keyBytes, indexOffset,
-				),
-			)
+			if partitionedIndex != nil {
+				partitionedIndex.AddBlock(keyBytes, indexOffset)
+			} else {
+				indexBytes = common.ConcatBytes(
+					indexBytes, IndexBlockRecord(
+						keyBytes, indexOffset,
+					),
+				)
+			}
+		} else if partitionedIndex != nil && dataBytesCursor == 0 {
+			partitionedIndex.AddBlock(keyBytes, 0)
+		}
+		// add user key to the filter
+		content := e.Key().(*common.MVCCKey).Content
+		if partitionedIndex != nil {
+			partitionedIndex.AddKey(content)
+		} else {
+			filterKeys.Add(content)
 		}
-		// add key to the bloom filter
-		newTable.filter.Add(keyBytes)
 		//
 		keyLength := len(keyBytes)
 		valueLength := len(e.Value())
 		// make redundant space for the record
 		recordBytes, rLength := ElementToRowRecordBytes(e, keyLength, valueLength)
+		properties.Add(e.Key().(*common.MVCCKey), e.Value())
 		if dataBytesCursor + rLength >= len(dataBytes) {
 			newDataBytes := make([]byte, len(dataBytes) + initDataBytesSize)
 			copy(newDataBytes, dataBytes)
@@ -317,18 +502,14 @@ func DumpTable(memtable Memtable, path string, memtableSeq int) *Table {
 	}
 	dataBytes = dataBytes[:dataBytesCursor]
 
-	// setup block index
 	minKey := common.TypeMVCCBytes.DumpBytes(memtable.First().Key())
 	maxKey := common.TypeMVCCBytes.DumpBytes(memtable.Last().Key())
-	newTable.dataBlockIndex = NewLinearIndex(
-		indexBytes,
-		newTable,
-		uint64(len(dataBytes)),
-		minKey,
-		maxKey,
-	)
 	//
-	filterBytes := newTable.filter.DumpBytes()
+	filterBytes := make([]byte, 0)
+	if partitionedIndex == nil && filterPolicy != nil {
+		filterBytes = filterPolicy.CreateFilter(filterKeys.keys)
+		newTable.filter = loadTableFilter(filterBytes)
+	}
 	filterBlockLength := len(filterBytes)
 	headerBytes := make([]byte, LL)
 	indexBlockLength := len(indexBytes)
@@ -339,6 +520,41 @@ func DumpTable(memtable Memtable, path string, memtableSeq int) *Table {
 	binary.LittleEndian.PutUint32(headerBytes[12:20], uint32(len(dataBytes)))
 	binary.LittleEndian.PutUint32(headerBytes[20:24], uint32(len(minKey)))
 	// patch, forget the data length in the previous implementation Orz.
+
+	// setup block index
+	ext := newTableExtension(uint64(MagicLength + headerLength + len(dataBytes)))
+	if partitionedIndex != nil {
+		newTable.dataBlockIndex = NewPartitionedIndex(
+			partitionedIndex.Finish(ext, uint64(len(dataBytes))),
+			newTable,
+			minKey,
+			maxKey,
+		)
+	} else {
+		newTable.dataBlockIndex = NewLinearIndex(
+			indexBytes,
+			newTable,
+			uint64(len(dataBytes)),
+			minKey,
+			maxKey,
+		)
+	}
+	newTable.properties = properties.properties
+	newTable.properties.DataSize = uint64(len(dataBytes))
+	if partitionedIndex != nil {
+		newTable.properties.IndexSize = partitionedIndex.indexSize
+		newTable.properties.FilterSize = partitionedIndex.filterSize
+	} else {
+		newTable.properties.IndexSize = uint64(indexBlockLength)
+		newTable.properties.FilterSize = uint64(filterBlockLength)
+	}
+	if filterPolicy != nil {
+		newTable.properties.FilterPolicy = filterPolicy.Name()
+		if option.PrefixExtractor != nil {
+			newTable.properties.PrefixExtractor = option.PrefixExtractor.Name()
+		}
+	}
+	ext.AppendNamed(PropertiesBlockName, properties.Finish())
 	// write table
 	common.UnsafeWrite(tableFile, []byte(MagicString))
 	common.UnsafeWrite(tableFile, headerBytes)
@@ -347,10 +563,14 @@ func DumpTable(memtable Memtable, path string, memtableSeq int) *Table {
 	common.UnsafeWrite(tableFile, minKey)
 	common.UnsafeWrite(tableFile, maxKey)
 	common.UnsafeWrite(tableFile, dataBytes)
+	common.UnsafeWrite(tableFile, ext.Finish())
 	return newTable
 }
 
 // RemoveFile remove file that is deprecated by the compaction procedure.
 func (t *Table) RemoveFile() {
-	os.Remove(t.path)
+	if t.cache != nil {
+		t.cache.Erase(t.FullPath())
+	}
+	os.Remove(t.FullPath())
 }
@@ -3,6 +3,7 @@ package drifterdb
 import (
 	"bytes"
 	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
 	"os"
 	"testing"
 )
@@ -40,4 +41,116 @@ func TestLoadTable(t *testing.T) {
 
 func TestLoadTable2(t *testing.T) {
 
-}
\ No newline at end of file
+}
+
+func TestTable_RemoveFile(t *testing.T) {
+	memtable := NewSkiplistMemtable(common.TypeMVCCBytes)
+	for i := 0; i < 100; i++ {
+		key := common.MakeMVCCKey([]byte(fmt.Sprintf("key-%06d", i)), uint64(i+1), common.OpPut, 0)
+		memtable.Put(key, []byte(fmt.Sprintf("value-%06d", i)))
+	}
+	// the absolute path keeps its leading separator
+	dir := t.TempDir()
+	DumpTable(memtable, dir, 1)
+	table := LoadTable(TableFullPath(dir, 0, 1))
+	if table.path != dir {
+		t.Fatalf("wrong path %v of the table in %v", table.path, dir)
+	}
+	table.RemoveFile()
+	if _, err := os.Stat(TableFullPath(dir, 0, 1)); !os.IsNotExist(err) {
+		t.Errorf("the table file is supposed to be removed, got %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("the directory of the table is not supposed to be removed, got %v", err)
+	}
+}
+
+func TestDumpTableWithOption_PartitionedIndex(t *testing.T) {
+	memtable := NewSkiplistMemtable(common.TypeMVCCBytes)
+	total := 20000
+	for i := 0; i < total; i++ {
+		key := common.MakeMVCCKey([]byte(fmt.Sprintf("key-%06d", i)), uint64(i+1), common.OpPut, 0)
+		memtable.Put(key, []byte(fmt.Sprintf("value-%06d", i)))
+	}
+	option := DefaultOption()
+	option.PartitionedIndex = true
+	option.IndexPartitionSize = 256
+	dir := t.TempDir()
+	DumpTableWithOption(memtable, dir, 1, 0, option)
+	table := LoadTable(TableFullPath(dir, 0, 1))
+	table.cache = NewBlockCache(64 * KB)
+	index, ok := table.dataBlockIndex.(*PartitionedIndex)
+	if !ok {
+		t.Fatalf("the table is supposed to be loaded with a partitioned index")
+	}
+	if len(index.partitions) < 2 {
+		t.Errorf("the index is supposed to be split into partitions, got %v", len(index.partitions))
+	}
+	for i := 0; i < total; i += 7 {
+		key := common.MakeMVCCKey([]byte(fmt.Sprintf("key-%06d", i)), uint64(total+1), common.OpGet, 0)
+		e := table.Get(key)
+		if e == nil || string(e.Value()) != fmt.Sprintf("value-%06d", i) {
+			t.Errorf("wrong value of %v: %v", string(key.Content), e)
+		}
+	}
+	if table.Get(common.MakeMVCCKey([]byte("key-9"), uint64(total+1), common.OpGet, 0)) != nil {
+		t.Errorf("key-9 is not supposed to be existed")
+	}
+	start := common.MakeMVCCKey([]byte("key-001000"), uint64(total+1), common.OpGet, 0)
+	end := common.MakeMVCCKey([]byte("key-003000"), uint64(total+1), common.OpGet, 0)
+	if result := table.Range(start, end, 5000, 0); len(result) != 2000 {
+		t.Errorf("range is supposed to return 2000 elements, got %v", len(result))
+	}
+	if table.cache.HitRatio() == 0 {
+		t.Errorf("partitions are supposed to be served by the block cache")
+	}
+}
+
+func TestDumpTableWithOption_FilterPolicy(t *testing.T) {
+	memtable := NewSkiplistMemtable(common.TypeMVCCBytes)
+	total := 5000
+	for i := 0; i < total; i++ {
+		key := common.MakeMVCCKey([]byte(fmt.Sprintf("key-%06d", i*2)), uint64(i+1), common.OpPut, 0)
+		memtable.Put(key, []byte(fmt.Sprintf("value-%06d", i)))
+	}
+	policies := []FilterPolicy{NewBloomFilterPolicy(DefaultBloomBitsPerKey), NewXorFilterPolicy(), NewRibbonFilterPolicy(),
+		NewBlockedBloomFilterPolicy(DefaultBloomBitsPerKey)}
+	for level, policy := range policies {
+		// each policy is set for a different level so that the level of the table picks the policy
+		option := DefaultOption()
+		option.FilterPolicy = nil
+		option.LevelFilterPolicies = make([]FilterPolicy, level+1)
+		option.LevelFilterPolicies[level] = policy
+		dir := t.TempDir()
+		DumpTableWithOption(memtable, dir, 1, level, option)
+		table := LoadTable(TableFullPath(dir, level, 1))
+		if table.filter == nil {
+			t.Fatalf("the table is supposed to be loaded with a filter of %v", policy.Name())
+		}
+		for i := 0; i < total; i++ {
+			if !table.keyMayMatch([]byte(fmt.Sprintf("key-%06d", i*2))) {
+				t.Fatalf("key-%06d is supposed to match the filter of %v", i*2, policy.Name())
+			}
+		}
+		wrong := 0
+		for i := 0; i < total; i++ {
+			if table.keyMayMatch([]byte(fmt.Sprintf("key-%06d", i*2+1))) {
+				wrong += 1
+			}
+		}
+		if rate := float64(wrong) / float64(total); rate > 0.05 {
+			t.Errorf("false positive rate %v of %v is too high", rate, policy.Name())
+		}
+		if table.Properties().FilterPolicy != policy.Name() {
+			t.Errorf("wrong filter policy %v", table.Properties().FilterPolicy)
+		}
+		if level == 0 {
+			continue
+		}
+		// the level without a policy takes the FilterPolicy, which builds no filter
+		DumpTableWithOption(memtable, dir, 2, 0, option)
+		if table := LoadTable(TableFullPath(dir, 0, 2)); table.filter != nil {
+			t.Errorf("the table of the level 0 is not supposed to be built with the filter of %v", policy.Name())
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 type Storage struct {
 	workDir          string
+	option           *Option
+	blockCache       *BlockCache
 	nFiles           int
 	levels           [][]*Table
 	deprecatedTables map[*Table]interface{}
@@ -18,16 +20,21 @@ type Storage struct {
 	// versions and ref count
 	versions       map[*Version]int
 	currentVersion *Version
+	// snapshots are the snapshots not released, guarded by the versionLock
+	snapshots map[*Snapshot]struct{}
 }
 
-func NewStorage(workDir string, nlevels int) *Storage {
+func NewStorage(workDir string, option *Option) *Storage {
 	newStorage := &Storage{
 		workDir:          workDir,
+		option:           option,
+		blockCache:       NewBlockCache(option.BlockCacheSize),
 		deprecatedTables: make(map[*Table]interface{}, 0),
 		versions:         make(map[*Version]int),
-		levels:           make([][]*Table, nlevels),
+		snapshots:        make(map[*Snapshot]struct{}),
+		levels:           make([][]*Table, option.Levels),
 	}
-	newStorage.currentVersion = LoadVersion(workDir, nlevels)
+	newStorage.currentVersion = LoadVersion(workDir, option.Levels, newStorage.blockCache)
 	newStorage.DumpVersion(newStorage.currentVersion)
 	return newStorage
 }
@@ -58,8 +65,11 @@ func (s *Storage) ReleaseVersion(v *Version) {
 	}
 }
 
-func (s *Storage) DumpMemtable(tableToDump Memtable, tableSeq int) *Table {
-	return DumpTable(tableToDump, s.workDir, tableSeq)
+// DumpMemtable dumps the memtable into a table of the level, the flushed memtables are always dumped into the level 0.
+func (s *Storage) DumpMemtable(tableToDump Memtable, tableSeq int, level int) *Table {
+	newTable := DumpTableWithOption(tableToDump, s.workDir, tableSeq, level, s.option)
+	newTable.cache = s.blockCache
+	return newTable
 }
 
 func (s *Storage) CompactionLoop() {
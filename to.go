@@ -1,15 +1,34 @@
 package drifterdb
 
-import "github.com/LaJunkai/drifterdb/common"
+import (
+	"github.com/LaJunkai/drifterdb/common"
+	"time"
+)
 
+// TransactionOptions controls a single transaction.
+// IsolationLevel: the isolation level of the transaction, the level of the db is used if it is 0.
+// LockTimeout: the max duration the transaction waits for a row lock, the lock timeout of the db option is used
+// if it is 0, and the transaction waits for ever if it is negative.
+// ReadOnly: the writes and the locks of the read-only transaction fail with ErrReadOnlyTransaction.
+// DeadlockDetect: whether the waiting of the transaction for the locks is checked by the deadlock detection.
+// Timeout: the max lifetime of the transaction, the transaction expires once the timeout elapses or the ctx it is
+// started with is done, the transaction timeout of the db option is used if it is 0, and the transaction never
+// expires by the time if it is negative.
+// MaxWriteSetSize: the max number of the writes of the transaction, no limit if it is not positive.
+// Optimistic: whether the writes are buffered and validated at the commit, the optimistic transactions always read
+// the snapshot as the repeatable read transactions do.
 type TransactionOptions struct {
-	isolationLevel uint8
+	IsolationLevel  uint8
+	LockTimeout     time.Duration
+	Timeout         time.Duration
+	ReadOnly        bool
+	DeadlockDetect  bool
+	MaxWriteSetSize int
+	Optimistic      bool
 }
 
 func NewTransactionOptions(isolationLevel uint8) *TransactionOptions {
-	return &TransactionOptions{isolationLevel: isolationLevel}
+	return &TransactionOptions{IsolationLevel: isolationLevel, DeadlockDetect: true}
 }
 
-
-
-var DefaultTrxOpt = NewTransactionOptions(common.ReadCommitted)
\ No newline at end of file
+var DefaultTrxOpt = NewTransactionOptions(common.ReadCommitted)
@@ -0,0 +1,87 @@
+package drifterdb
+
+import (
+	"github.com/LaJunkai/drifterdb/common"
+	"testing"
+	"time"
+)
+
+func TestTransactionOptions_IsolationLevel(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	db.Put([]byte("k"), []byte("v1"))
+	rc := db.StartTransactionWithOptions(NewTransactionOptions(common.ReadCommitted))
+	rr := db.StartTransactionWithOptions(NewTransactionOptions(common.RepeatableRead))
+	if rc.IsolationLevel != common.ReadCommitted || rr.IsolationLevel != common.RepeatableRead {
+		t.Fatalf("the isolation level of the options is supposed to be used, got %d and %d",
+			rc.IsolationLevel, rr.IsolationLevel)
+	}
+	db.Put([]byte("k"), []byte("v2"))
+	if v := rc.Get([]byte("k")); string(v) != "v2" {
+		t.Errorf("the read committed transaction is supposed to read v2, got %s", v)
+	}
+	if v := rr.Get([]byte("k")); string(v) != "v1" {
+		t.Errorf("the repeatable read transaction is supposed to read v1, got %s", v)
+	}
+	db.RollbackTransaction(rc)
+	db.RollbackTransaction(rr)
+}
+
+func TestTransactionOptions_ReadOnly(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	opts := NewTransactionOptions(common.RepeatableRead)
+	opts.ReadOnly = true
+	trx := db.StartTransactionWithOptions(opts)
+	if err := trx.Put([]byte("k"), []byte("v")); err != ErrReadOnlyTransaction {
+		t.Errorf("the put is supposed to fail with ErrReadOnlyTransaction, got %v", err)
+	}
+	if _, err := trx.GetForUpdate([]byte("k"), true); err != ErrReadOnlyTransaction {
+		t.Errorf("the lock is supposed to fail with ErrReadOnlyTransaction, got %v", err)
+	}
+	db.RollbackTransaction(trx)
+}
+
+func TestTransactionOptions_MaxWriteSetSize(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	opts := NewTransactionOptions(common.ReadCommitted)
+	opts.MaxWriteSetSize = 2
+	err := db.WithTransaction(func(trx *Transaction) {
+		for i, key := range []string{"a", "b", "c"} {
+			err := trx.Put([]byte(key), []byte("v"))
+			if i < 2 && err != nil {
+				t.Errorf("the write %d is supposed to succeed, got %v", i, err)
+			}
+			if i == 2 && err != ErrWriteSetTooLarge {
+				t.Errorf("the write over the limit is supposed to fail with ErrWriteSetTooLarge, got %v", err)
+			}
+		}
+	}, opts)
+	if err != nil {
+		t.Fatalf("the commit is supposed to succeed, got %v", err)
+	}
+	if v := db.Get([]byte("c")); v != nil {
+		t.Errorf("the rejected write is supposed to be absent, got %s", v)
+	}
+}
+
+func TestTransactionOptions_LockTimeout(t *testing.T) {
+	db := New(t.TempDir(), nil)
+	defer db.Close()
+	holder := db.StartTransaction()
+	holder.Put([]byte("k"), []byte("v"))
+	opts := NewTransactionOptions(common.ReadCommitted)
+	opts.LockTimeout = 10 * time.Millisecond
+	opts.DeadlockDetect = false
+	waiter := db.StartTransactionWithOptions(opts)
+	start := time.Now()
+	if err := waiter.Put([]byte("k"), []byte("w")); err != ErrLockTimeout {
+		t.Errorf("the put is supposed to fail with ErrLockTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the lock timeout of the options is supposed to be used, waited %v", elapsed)
+	}
+	db.RollbackTransaction(waiter)
+	db.RollbackTransaction(holder)
+}
@@ -2,8 +2,11 @@ package drifterdb
 
 import (
 	"bytes"
+	"context"
 	"github.com/LaJunkai/drifterdb/common"
 	"sort"
+	"sync"
+	"time"
 )
 
 /*
@@ -30,6 +33,7 @@ const (
 type TrxOpRecord struct {
 	table Memtable
 	key   *common.MVCCKey
+	value []byte
 }
 
 // ReadView ignore versions of the data newer than the readSeq.
@@ -39,7 +43,12 @@ type ReadView struct {
 	db             *DrifterDB
 	IsolationLevel uint8
 	version        *Version
-	// version
+	// ssi tracks the reads and writes of the serializable transaction, it is nil under other isolation levels.
+	ssi *ssiTransaction
+	// memtables and invisible are pinned by the snapshot of the reads out of the transactions, the live memtables
+	// are read if memtables is nil.
+	memtables []Memtable
+	invisible map[uint64]struct{}
 }
 
 func NewReadView(db *DrifterDB, isolationLevel uint8, version *Version) *ReadView {
@@ -58,6 +67,20 @@ func (rv *ReadView) Get(key []byte) []byte {
 		rv.readSeq = rv.db.getSeq()
 	}
 	mvccKey := common.MakeIsoMVCCKey(key, rv.readSeq, common.OpGet, 0, rv.IsolationLevel)
+	if rv.ssi != nil {
+		rv.db.transactionSet.ssi.OnRead(rv.ssi, key)
+	}
+	return rv.get(mvccKey)
+}
+
+// get looks up the key in the memtables and the tables of the version, the memtableLock is supposed to be held.
+func (rv *ReadView) get(mvccKey *common.MVCCKey) []byte {
+	if rv.memtables != nil {
+		if value, found := rv.getPinned(mvccKey); found {
+			return value
+		}
+		return rv.getTables(mvccKey)
+	}
 	if result := rv.db.memtable.Get(mvccKey); result != nil {
 		return result.Value()
 	}
@@ -72,8 +95,18 @@ func (rv *ReadView) Get(key []byte) []byte {
 			return result.Value()
 		}
 	}
-	// find kv in sstables of the version
-	for _, level := range rv.version.levels {
+	return rv.getTables(mvccKey)
+}
+
+// getTables looks up the key in the tables of the version.
+func (rv *ReadView) getTables(mvccKey *common.MVCCKey) []byte {
+	// find kv in sstables of the version, the newer level-0 tables shadow the older ones
+	for i := len(rv.version.levels[0]) - 1; i >= 0; i-- {
+		if result := rv.version.levels[0][i].Get(mvccKey); result != nil {
+			return result.Value()
+		}
+	}
+	for _, level := range rv.version.levels[1:] {
 		for _, table := range level {
 			if result := table.Get(mvccKey); result != nil {
 				return result.Value()
@@ -90,9 +123,30 @@ type Transaction struct {
 	trxId uint32
 	// modificationSeq is a array contains each modification operation sequence number carried by the trx.
 	modificationRecord []*TrxOpRecord
-	needRollback       bool
-	timeSince          int
-	refTables          []Memtable
+	// recordLock guards the modificationRecord against the snapshots while the memtableLock is shared by the writes.
+	recordLock   sync.Mutex
+	needRollback bool
+	refTables    []Memtable
+	// ctx carries the deadline of the transaction, the transaction expires and its waiting for the row locks
+	// is canceled once the ctx is done. lockTimeout is the max duration of each waiting.
+	ctx         context.Context
+	cancel      context.CancelFunc
+	state       int32
+	lockTimeout time.Duration
+	// deadlockDetect, readOnly and maxWriteSetSize are set by the TransactionOptions.
+	deadlockDetect  bool
+	readOnly        bool
+	maxWriteSetSize int
+	lockedKeys      [][]byte
+	lockedRanges    [][2][]byte
+	savepoints      []*savepoint
+	// prepared is the name given to Prepare, it is empty if the transaction is not prepared.
+	prepared string
+	// preparedOffset is the WAL offset of the OpPrepare record, the WAL is kept from it until the transaction is resolved.
+	preparedOffset uint64
+	// batch buffers the writes of the optimistic transaction and reads records its read set, both are nil otherwise.
+	batch *writeBatch
+	reads *readSet
 }
 
 // merge two sorted array
@@ -119,6 +173,11 @@ func MergeRangeResult(left, right []*Element) []*Element {
 }
 
 func (rv *ReadView) Range(start, end []byte, count, offset int) []*Element {
+	return rv.rangeWithPrefix(start, end, count, offset, nil)
+}
+
+// rangeWithPrefix skips the tables and blocks whose filter rejects the prefix if the prefix is not nil.
+func (rv *ReadView) rangeWithPrefix(start, end []byte, count, offset int, prefix []byte) []*Element {
 	result := make([]*Element, 0, 2*(count+offset))
 	rv.db.memtableLock.RLock()
 	defer rv.db.memtableLock.RUnlock()
@@ -127,19 +186,28 @@ func (rv *ReadView) Range(start, end []byte, count, offset int) []*Element {
 	}
 	startMvccKey := common.MakeIsoMVCCKey(start, rv.readSeq, common.OpGet, 0, rv.IsolationLevel)
 	endMvccKey := common.MakeIsoMVCCKey(end, rv.readSeq, common.OpGet, 0, rv.IsolationLevel)
-
-	result = MergeRangeResult(result, rv.version.memtable.Range(startMvccKey, endMvccKey, count, offset))
-	// find kv in other memtables
-	for _, table := range rv.version.frozenMemtable {
-		result = MergeRangeResult(result, table.Range(startMvccKey, endMvccKey, count, offset))
+	if rv.ssi != nil {
+		rv.db.transactionSet.ssi.OnRange(rv.ssi, start, end)
 	}
-	for _, table := range rv.version.ImmutableMemtable {
-		result = MergeRangeResult(result, table.Range(startMvccKey, endMvccKey, count, offset))
+
+	if rv.memtables != nil {
+		for _, table := range rv.memtables {
+			result = MergeRangeResult(result, rv.rangePinned(table, startMvccKey, endMvccKey, count+offset))
+		}
+	} else {
+		result = MergeRangeResult(result, rv.version.memtable.Range(startMvccKey, endMvccKey, count, offset))
+		// find kv in other memtables
+		for _, table := range rv.version.frozenMemtable {
+			result = MergeRangeResult(result, table.Range(startMvccKey, endMvccKey, count, offset))
+		}
+		for _, table := range rv.version.ImmutableMemtable {
+			result = MergeRangeResult(result, table.Range(startMvccKey, endMvccKey, count, offset))
+		}
 	}
 	//find kv in sstables of the version
 	for _, level := range rv.version.levels {
 		for _, table := range level {
-			result = MergeRangeResult(result, table.Range(startMvccKey, endMvccKey, count+offset, offset))
+			result = MergeRangeResult(result, table.rangeWithPrefix(startMvccKey, endMvccKey, count+offset, offset, prefix, rv.db.option.PrefixExtractor))
 		}
 	}
 	if len(result) < offset {
@@ -153,106 +221,177 @@ func (rv *ReadView) Range(start, end []byte, count, offset int) []*Element {
 	}
 }
 
-// checkLockOnFrozenMemtables check the lock by an optimistic way
-// [ important! ] and will acquire the lock of  trx.db.switchMemtableLock without release.
-func (trx *Transaction) checkLockOnFrozenMemtables(key []byte) {
-	trx.db.switchMemtableLock.RLock()
-	// search frozen tables first after lock the switch memtable
-	foundConflict := false
-	var conflictKey *common.MVCCKey = nil
-	var conflictMemtable Memtable = nil
-	tempKey := common.MakeIsoMVCCKey(key, 0xFFFFFFFFFFFFFFFF, common.OpGet, trx.trxId, common.ReadUncommitted)
-	for i := 0; i < len(trx.db.frozenMemtables); i++ {
-		table := trx.db.frozenMemtables[i]
-		if table.CountRefs() == 0 {
-			continue
-		}
-		if e := table.Get(tempKey); e != nil {
-			conflictKeyFound := e.ListEntry.Key().(*common.MVCCKey)
-			if conflictKeyFound.TrxId != 0 && conflictKeyFound.TrxId != trx.trxId {
-				foundConflict = true
-				conflictKey = conflictKeyFound
-				conflictMemtable = table
-				break
-			}
+// lock acquires the row lock of the key, the lock is held until the transaction is committed or rolled back.
+func (trx *Transaction) lock(key []byte, exclusive bool) error {
+	if err := trx.db.transactionSet.locks.Acquire(trx.ctx, trx.trxId, key, exclusive, trx.lockTimeout, trx.deadlockDetect); err != nil {
+		if err == trx.ctx.Err() {
+			return ErrTxnExpired
 		}
+		return err
+	}
+	trx.lockedKeys = append(trx.lockedKeys, key)
+	return nil
+}
+
+// releaseLocks is supposed to be called after the writes of the transaction are committed or rolled back.
+func (trx *Transaction) releaseLocks() {
+	for _, key := range trx.lockedKeys {
+		trx.db.transactionSet.locks.Release(trx.trxId, key)
+	}
+	trx.lockedKeys = nil
+	if len(trx.lockedRanges) != 0 {
+		trx.db.transactionSet.locks.ReleaseRanges(trx.trxId)
+		trx.lockedRanges = nil
+	}
+}
+
+// GetForUpdate locks the key in the shared or the exclusive mode and returns the latest committed value of the key,
+// the lock prevents other transactions from modifying the key until the transaction is committed or rolled back.
+func (trx *Transaction) GetForUpdate(key []byte, exclusive bool) ([]byte, error) {
+	if trx.readOnly {
+		return nil, ErrReadOnlyTransaction
+	}
+	if trx.prepared != "" {
+		return nil, ErrTransactionPrepared
+	}
+	if err := trx.enter(); err != nil {
+		return nil, err
+	}
+	defer trx.leave()
+	if err := trx.lock(key, exclusive); err != nil {
+		return nil, err
 	}
-	if foundConflict && conflictKey != nil && conflictMemtable != nil {
-		// unref when stop waiting
-		conflictMemtable.Ref(trx)
-		trx.refTables = append(trx.refTables, conflictMemtable)
-		trx.db.switchMemtableLock.RUnlock()
-		for conflictKey.TrxId != 0 {
-			if trx.timeout() {
-				common.Error("Transaction timeout during waiting a lock on frozen memtable.")
+	if trx.batch != nil {
+		if op := trx.batch.Get(key); op != nil {
+			if op.kt == common.OpDelete {
+				return nil, nil
 			}
+			return op.value, nil
 		}
-		trx.db.switchMemtableLock.RLock()
-		conflictMemtable.CancelRef(trx)
 	}
+	trx.db.memtableLock.RLock()
+	defer trx.db.memtableLock.RUnlock()
+	if trx.ssi != nil {
+		trx.db.transactionSet.ssi.OnRead(trx.ssi, key)
+	}
+	// the versions committed after the snapshot are visible since the key is locked
+	mvccKey := common.MakeIsoMVCCKey(key, trx.db.getSeq(), common.OpGet, trx.trxId, common.ReadCommitted)
+	return trx.get(mvccKey), nil
 }
 
-func (trx *Transaction) Put(key, value []byte) bool {
-
-	mvccKey := common.MakeMVCCKey(key, 0, common.OpPut, trx.trxId) // add trx record
-	trx.checkLockOnFrozenMemtables(key)
-	for {
-		//
-		trx.db.memtable.Ref(trx)
-		trx.refTables = append(trx.refTables, trx.db.memtable)
-		// fragile design, unlock the mutex locked in the func checkLockOnFrozenMemtables
-		trx.db.memtableLock.Lock()
-		mvccKey.Seq = trx.db.getSeq()
-		trx.modificationRecord = append(trx.modificationRecord, &TrxOpRecord{
-			table: trx.db.memtable,
-			key:   mvccKey,
-		})
-		e, done := trx.db.put(mvccKey, value)
-		trx.db.memtableLock.Unlock()
-		if done {
-			trx.db.switchMemtableLock.RUnlock()
-			return true
-		} else {
-			trx.modificationRecord = trx.modificationRecord[:len(trx.modificationRecord)-1]
-			for e.ListEntry.Key().(*common.MVCCKey).TrxId != 0 {
-				if trx.timeout() {
-					trx.db.switchMemtableLock.RUnlock()
-					common.Error("Transaction timeout during Waiting a lock on active memtable.")
-				}
-			}
+// LockRange takes the gap lock of the [start, end) range, other transactions can not write the keys in the range
+// until the transaction is committed or rolled back, so the range read by the transaction has no phantom.
+func (trx *Transaction) LockRange(start, end []byte) error {
+	if trx.readOnly {
+		return ErrReadOnlyTransaction
+	}
+	if trx.prepared != "" {
+		return ErrTransactionPrepared
+	}
+	if err := trx.enter(); err != nil {
+		return err
+	}
+	defer trx.leave()
+	if err := trx.db.transactionSet.locks.LockRange(trx.ctx, trx.trxId, start, end, trx.lockTimeout, trx.deadlockDetect); err != nil {
+		if err == trx.ctx.Err() {
+			return ErrTxnExpired
 		}
+		return err
 	}
+	trx.lockedRanges = append(trx.lockedRanges, [2][]byte{start, end})
+	return nil
 }
 
-func (trx *Transaction) Delete(key []byte) bool {
-	mvccKey := common.MakeMVCCKey(key, 0, common.OpDelete, trx.trxId) // add trx record
-	trx.checkLockOnFrozenMemtables(key)
-	for {
-		//
-		trx.db.memtable.Ref(trx)
-		trx.refTables = append(trx.refTables, trx.db.memtable)
-		// fragile design, unlock the mutex locked in the func checkLockOnFrozenMemtables
-		trx.db.memtableLock.Lock()
-		mvccKey.Seq = trx.db.getSeq()
-		trx.modificationRecord = append(trx.modificationRecord, &TrxOpRecord{
-			table: trx.db.memtable,
-			key:   mvccKey,
-		})
-		e, done := trx.db.put(mvccKey, []byte(""))
-		trx.db.memtableLock.Unlock()
-		if done {
-			trx.db.switchMemtableLock.RUnlock()
-			return true
-		} else {
-			trx.modificationRecord = trx.modificationRecord[:len(trx.modificationRecord)-1]
-			for e.ListEntry.Key().(*common.MVCCKey).TrxId != 0 {
-				if trx.timeout() {
-					trx.db.switchMemtableLock.RUnlock()
-					common.Error("Transaction timeout during Waiting a lock on active memtable.")
-				}
-			}
+// SetLockTimeout sets the max duration the transaction waits for a row lock, it waits for ever if d is not positive.
+func (trx *Transaction) SetLockTimeout(d time.Duration) {
+	trx.lockTimeout = d
+}
+
+func (trx *Transaction) Put(key, value []byte) error {
+	if err := trx.checkWrite(key); err != nil {
+		return err
+	}
+	if err := trx.enter(); err != nil {
+		return err
+	}
+	defer trx.leave()
+	if trx.batch != nil {
+		trx.batch.Put(key, value)
+		return nil
+	}
+	return trx.write(common.MakeMVCCKey(key, 0, common.OpPut, trx.trxId), value)
+}
+
+func (trx *Transaction) Delete(key []byte) error {
+	if err := trx.checkWrite(key); err != nil {
+		return err
+	}
+	if err := trx.enter(); err != nil {
+		return err
+	}
+	defer trx.leave()
+	if trx.batch != nil {
+		trx.batch.Delete(key)
+		return nil
+	}
+	return trx.write(common.MakeMVCCKey(key, 0, common.OpDelete, trx.trxId), []byte(""))
+}
+
+// checkWrite checks the write against the read-only flag and the max write set size of the transaction.
+func (trx *Transaction) checkWrite(key []byte) error {
+	if trx.readOnly {
+		return ErrReadOnlyTransaction
+	}
+	if trx.prepared != "" {
+		return ErrTransactionPrepared
+	}
+	if trx.maxWriteSetSize <= 0 {
+		return nil
+	}
+	if trx.batch != nil {
+		if trx.batch.Get(key) == nil && trx.batch.Len() >= trx.maxWriteSetSize {
+			return ErrWriteSetTooLarge
 		}
+	} else if len(trx.modificationRecord) >= trx.maxWriteSetSize {
+		return ErrWriteSetTooLarge
+	}
+	return nil
+}
+
+func (trx *Transaction) write(mvccKey *common.MVCCKey, value []byte) error {
+	if trx.ssi != nil {
+		trx.db.transactionSet.ssi.OnWrite(trx.ssi, mvccKey.Content)
+	}
+	if err := trx.lock(mvccKey.Content, true); err != nil {
+		return err
+	}
+	// the writer is stalled before it takes the memtable locks which the flushes need
+	if err := trx.db.waitForWriteBuffer(trx.ctx); err != nil {
+		return ErrWriteStall
+	}
+	if err := trx.db.delayWrite(trx.ctx, len(mvccKey.Content)+len(value)); err != nil {
+		return ErrWriteStall
+	}
+	trx.db.switchMemtableLock.RLock()
+	defer trx.db.switchMemtableLock.RUnlock()
+	trx.db.memtable.Ref(trx)
+	trx.refTables = append(trx.refTables, trx.db.memtable)
+	unlock := trx.db.lockMemtable()
+	defer unlock()
+	// the version is recorded together with its seq, so the snapshots taking a later seq never miss it
+	trx.recordLock.Lock()
+	mvccKey.Seq = trx.db.getSeq()
+	trx.modificationRecord = append(trx.modificationRecord, &TrxOpRecord{
+		table: trx.db.memtable,
+		key:   mvccKey,
+		value: value,
+	})
+	trx.recordLock.Unlock()
+	if _, done := trx.db.put(mvccKey, value); !done {
+		// the versions written by other transactions are committed or rolled back before their locks are released
+		common.Error("Uncommitted version found on a key locked by the transaction.")
 	}
+	return nil
 }
 
 func (trx *Transaction) SetCommit() {
@@ -266,14 +405,19 @@ func (trx *Transaction) SetRollback() {
 func (trx *Transaction) commit() {
 	trx.db.switchMemtableLock.RLock()
 	defer trx.db.switchMemtableLock.RUnlock()
+	// the readers see either all or none of the writes
+	trx.db.memtableLock.Lock()
 	for _, r := range trx.modificationRecord {
 		r.key.TrxId = 0
 	}
+	trx.db.memtableLock.Unlock()
+	trx.releaseLocks()
 	// release the version and release the memtable
 	for _, t := range trx.refTables {
 		t.CancelRef(trx)
 	}
 	trx.db.storage.ReleaseVersion(trx.version)
+	trx.cancel()
 }
 
 func (trx *Transaction) rollback() {
@@ -286,20 +430,13 @@ func (trx *Transaction) rollback() {
 		r.table.Delete(r.key)
 		r.key.TrxId = 0
 	}
+	trx.releaseLocks()
 	// release the version and release the memtable
 	for _, t := range trx.refTables {
 		t.CancelRef(trx)
 	}
 	trx.db.storage.ReleaseVersion(trx.version)
-
-}
-
-func (trx *Transaction) timeout() bool {
-	return trx.timeSince > TransactionTimeout
-}
-
-func (trx *Transaction) updateTimeSince() {
-	trx.timeSince += 1
+	trx.cancel()
 }
 
 func (trx *Transaction) TrxID() uint32 {
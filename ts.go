@@ -1,10 +1,10 @@
 package drifterdb
 
 import (
+	"context"
 	"github.com/LaJunkai/drifterdb/common"
 	"sync"
 	"sync/atomic"
-	"time"
 )
 
 type TransactionSet struct {
@@ -16,8 +16,18 @@ type TransactionSet struct {
 	undoLog UndoLog
 	// db
 	db *DrifterDB
-	// timer lock
-	timerLock sync.RWMutex
+	// levelLock guards the default IsolationLevel
+	levelLock sync.RWMutex
+	// ssi detects the conflicts among the serializable transactions
+	ssi *ssiTracker
+	// commitLock serializes the validation of the optimistic transactions and the records of the commit log
+	commitLock sync.Mutex
+	commitLog  *commitLog
+	// locks are the row locks of the keys written by the pessimistic transactions
+	locks *LockManager
+	// prepared maps the names to the prepared transactions
+	preparedLock sync.Mutex
+	prepared     map[string]*Transaction
 }
 
 func NewTransactionSet(isolationLevel uint8, db *DrifterDB) *TransactionSet {
@@ -26,25 +36,96 @@ func NewTransactionSet(isolationLevel uint8, db *DrifterDB) *TransactionSet {
 		db:             db,
 		TrxId:          0,
 		undoLog:        UndoLog{},
+		ssi:            newSSITracker(),
+		commitLog:      newCommitLog(),
+		locks:          NewLockManager(),
+		prepared:       make(map[string]*Transaction),
 	}
 }
 
 // GetTransaction get a new transaction from transaction set and set up version ref (memtable ref is setup when first accessing the specified memetable)
 func (ts *TransactionSet) GetTransaction() *Transaction {
+	return ts.GetTransactionWithOptions(context.Background(), nil)
+}
+
+// GetTransactionContext get a new transaction which expires once the ctx is done or its timeout elapses.
+func (ts *TransactionSet) GetTransactionContext(ctx context.Context) *Transaction {
+	return ts.GetTransactionWithOptions(ctx, nil)
+}
+
+// GetOptimisticTransaction get a new optimistic transaction which buffers the writes until the commit.
+func (ts *TransactionSet) GetOptimisticTransaction() *Transaction {
+	opts := NewTransactionOptions(0)
+	opts.Optimistic = true
+	return ts.GetTransactionWithOptions(context.Background(), opts)
+}
+
+// GetTransactionWithOptions get a new transaction controlled by the options, the default options are used if opts is nil.
+func (ts *TransactionSet) GetTransactionWithOptions(ctx context.Context, opts *TransactionOptions) *Transaction {
+	if opts == nil {
+		opts = NewTransactionOptions(0)
+	}
+	isolationLevel := opts.IsolationLevel
+	if isolationLevel == 0 {
+		ts.levelLock.RLock()
+		isolationLevel = ts.IsolationLevel
+		ts.levelLock.RUnlock()
+	}
+	if opts.Optimistic {
+		isolationLevel = common.RepeatableRead
+	}
+	lockTimeout := opts.LockTimeout
+	if lockTimeout == 0 {
+		lockTimeout = ts.db.option.LockTimeout
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = ts.db.option.TransactionTimeout
+	}
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
 	newTrxId := atomic.AddUint32(&ts.TrxId, 1)
 	newTransaction := &Transaction{
-		ReadView:           *NewReadView(ts.db, ts.IsolationLevel, ts.db.storage.GetVersion()),
+		ReadView:           *NewReadView(ts.db, isolationLevel, ts.db.storage.GetVersion()),
 		trxId:              newTrxId,
 		modificationRecord: make([]*TrxOpRecord, 0, 8),
 		needRollback:       false,
 		refTables:          make([]Memtable, 0, 1),
+		ctx:                ctx,
+		cancel:             cancel,
+		lockTimeout:        lockTimeout,
+		deadlockDetect:     opts.DeadlockDetect,
+		readOnly:           opts.ReadOnly,
+		maxWriteSetSize:    opts.MaxWriteSetSize,
+	}
+	if opts.Optimistic {
+		newTransaction.batch = newWriteBatch()
+		newTransaction.reads = newReadSet()
+		ts.commitLock.Lock()
+		ts.commitLog.Begin(newTrxId, newTransaction.readSeq)
+		ts.commitLock.Unlock()
+	} else if newTransaction.IsolationLevel == common.Serializable {
+		// the snapshot is not taken while a serializable commit is making its writes visible
+		ts.commitLock.Lock()
+		newTransaction.readSeq = ts.db.getSeq()
+		newTransaction.ssi = ts.ssi.Begin(newTrxId, newTransaction.readSeq)
+		ts.commitLock.Unlock()
 	}
-	ts.timerLock.RLock()
-	defer ts.timerLock.RUnlock()
 	ts.Transactions.Store(newTrxId, newTransaction)
 	return newTransaction
 }
 
+// SetIsolationLevel sets the default isolation level of the new transactions, the open transactions are not affected.
+func (ts *TransactionSet) SetIsolationLevel(level uint8) {
+	ts.levelLock.Lock()
+	defer ts.levelLock.Unlock()
+	ts.IsolationLevel = level
+}
+
 func (ts *TransactionSet) MapTransaction(trxId uint32) *Transaction {
 	v, ok := ts.Transactions.Load(trxId)
 	if !ok {
@@ -54,10 +135,31 @@ func (ts *TransactionSet) MapTransaction(trxId uint32) *Transaction {
 	return v.(*Transaction)
 }
 
+// RollbackTransaction rollback the transaction, the prepared transaction is rolled back by its name.
 func (ts *TransactionSet) RollbackTransaction(trx *Transaction) {
+	if trx.prepared != "" {
+		if err := ts.RollbackPrepared(trx.prepared); err != nil {
+			common.Warning("Prepared transaction is already resolved, so it can't be rollback.")
+		}
+		return
+	}
+	if trx.finish() != nil {
+		// the expired transaction is already rolled back
+		return
+	}
+	ts.rollbackTransaction(trx)
+}
+
+func (ts *TransactionSet) rollbackTransaction(trx *Transaction) {
+	if trx.ssi != nil {
+		ts.ssi.Abort(trx.ssi)
+	}
+	if trx.batch != nil {
+		ts.commitLock.Lock()
+		ts.commitLog.End(trx.trxId)
+		ts.commitLock.Unlock()
+	}
 	trx.rollback()
-	ts.timerLock.RLock()
-	defer ts.timerLock.RUnlock()
 	ts.Transactions.Delete(trx.trxId)
 	ts.db.storage.ReleaseVersion(trx.version)
 }
@@ -68,44 +170,71 @@ func (ts *TransactionSet) RollbackTransactionByID(trxId uint32) {
 		common.Warning("Transaction is not opened, so it can't be rollback.")
 		return
 	}
-	trx := v.(*Transaction)
-	trx.rollback()
-	ts.timerLock.RLock()
-	defer ts.timerLock.RUnlock()
-	ts.Transactions.Delete(trxId)
-	ts.db.storage.ReleaseVersion(trx.version)
+	ts.RollbackTransaction(v.(*Transaction))
+}
+
+// CommitTransaction commit the transaction, the serializable transaction which fails the validation is rolled back
+// and ErrSerializationFailure is returned, the optimistic one is rolled back and ErrTransactionConflict is returned,
+// or ErrWriteStall is returned if its writes are stalled until its ctx is done.
+// The prepared transaction is committed by its name, and ErrTxnExpired is returned if the transaction is expired.
+func (ts *TransactionSet) CommitTransaction(trx *Transaction) error {
+	if trx.prepared != "" {
+		return ts.CommitPrepared(trx.prepared)
+	}
+	if err := trx.finish(); err != nil {
+		return err
+	}
+	return ts.commitTransaction(trx)
 }
 
-func (ts *TransactionSet) CommitTransaction(trx *Transaction) {
+func (ts *TransactionSet) commitTransaction(trx *Transaction) error {
+	if trx.batch != nil {
+		if err := ts.db.waitForOptimisticWrite(trx); err != nil {
+			trx.rollback()
+			ts.Transactions.Delete(trx.trxId)
+			ts.db.storage.ReleaseVersion(trx.version)
+			return ErrWriteStall
+		}
+		ts.commitLock.Lock()
+		err := trx.commitOptimistic(ts.commitLog, ts.locks)
+		ts.commitLog.End(trx.trxId)
+		ts.commitLock.Unlock()
+		if err != nil {
+			trx.rollback()
+		} else {
+			trx.commit()
+		}
+		ts.Transactions.Delete(trx.trxId)
+		ts.db.storage.ReleaseVersion(trx.version)
+		return err
+	}
+	// the keys are recorded before they are visible so that no optimistic transaction misses them
+	ts.commitLock.Lock()
+	if trx.ssi != nil && trx.prepared != "" {
+		ts.ssi.CommitPrepared(trx.ssi, ts.db.getSeq)
+	} else if trx.ssi != nil {
+		// the commitSeq is taken in the same critical section as the writes are made visible
+		if err := ts.ssi.Commit(trx.ssi, ts.db.getSeq); err != nil {
+			ts.commitLock.Unlock()
+			trx.rollback()
+			ts.Transactions.Delete(trx.trxId)
+			ts.db.storage.ReleaseVersion(trx.version)
+			return err
+		}
+	}
+	ts.commitLog.Append(ts.db.getSeq(), trx.writtenKeys())
 	trx.commit()
-	ts.timerLock.RLock()
-	defer ts.timerLock.RUnlock()
+	ts.commitLock.Unlock()
 	ts.Transactions.Delete(trx.trxId)
 	ts.db.storage.ReleaseVersion(trx.version)
+	return nil
 }
 
-func (ts *TransactionSet) CommitTransactionByID(trxId uint32)  {
+func (ts *TransactionSet) CommitTransactionByID(trxId uint32) error {
 	v, ok := ts.Transactions.Load(trxId)
 	if !ok {
 		common.Warning("Transaction is not opened, so it can't be rollback.")
-		return
-	}
-	trx := v.(*Transaction)
-	trx.commit()
-	ts.timerLock.RLock()
-	defer ts.timerLock.RUnlock()
-	ts.Transactions.Delete(trxId)
-	ts.db.storage.ReleaseVersion(trx.version)
-}
-
-func (ts *TransactionSet) StartTimer() {
-	for {
-		time.Sleep(time.Second)
-		ts.timerLock.Lock()
-		ts.Transactions.Range(func(key, value interface{}) bool {
-			value.(*Transaction).updateTimeSince()
-			return true
-		})
-		ts.timerLock.Unlock()
+		return nil
 	}
+	return ts.CommitTransaction(v.(*Transaction))
 }
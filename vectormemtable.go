@@ -0,0 +1,181 @@
+package drifterdb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/LaJunkai/drifterdb/common"
+	"github.com/LaJunkai/drifterdb/skiplist"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// VectorMemtable appends the records to a vector and sorts them once it is frozen, it suits the bulk loads which
+// write much more than they read. The lookups before the freezing scan the whole vector, and the conflicts of the
+// writes are not checked since the row locks already keep the writers of a key exclusive.
+type VectorMemtable struct {
+	comparable common.Comparable
+	// lock guards the elements, the readers and the writers are not serialized by the db once the memtable is frozen.
+	lock      sync.RWMutex
+	elements  []*Element
+	sorted    bool
+	byteSize  int
+	RefTrx    sync.Map
+	countRefs int32
+}
+
+func NewVectorMemtable(comparable common.Comparable) *VectorMemtable {
+	return &VectorMemtable{
+		comparable: comparable,
+		elements:   make([]*Element, 0, 1024),
+	}
+}
+
+// Freeze sorts the records, it is called once the memtable is frozen and receives no more new records.
+func (v *VectorMemtable) Freeze() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.sort()
+}
+
+func (v *VectorMemtable) sort() {
+	if !v.sorted {
+		sortElements(v.comparable, v.elements)
+		v.sorted = true
+	}
+}
+
+func (v *VectorMemtable) Put(key interface{}, value []byte) (*Element, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	e := &Element{key: key, value: value}
+	v.elements = append(v.elements, e)
+	v.sorted = false
+	return e, true
+}
+
+// Get returns the newest version of the key visible to the query among the versions not newer than the query.
+func (v *VectorMemtable) Get(key interface{}) *Element {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	query := key.(*common.MVCCKey)
+	var result *Element = nil
+	v.versions(query.Content, func(e *Element) bool {
+		version := e.key.(*common.MVCCKey)
+		if v.comparable.QueryCompare(key, e.key) != 0 || !skiplist.Visible(version, query) {
+			return true
+		}
+		if result == nil || version.Seq > result.key.(*common.MVCCKey).Seq {
+			result = e
+		}
+		// the first visible version is the newest one if the elements are sorted
+		return !v.sorted
+	})
+	if result == nil || v.comparable.OpType(result.key) != common.OpPut {
+		return nil
+	}
+	return result
+}
+
+// versions calls the f with the versions of the content, newer versions first if the elements are sorted,
+// the iteration stops once f returns false.
+func (v *VectorMemtable) versions(content []byte, f func(e *Element) bool) {
+	if !v.sorted {
+		for _, e := range v.elements {
+			if bytes.Equal(e.key.(*common.MVCCKey).Content, content) && !f(e) {
+				return
+			}
+		}
+		return
+	}
+	from := sort.Search(len(v.elements), func(i int) bool {
+		return bytes.Compare(v.elements[i].key.(*common.MVCCKey).Content, content) >= 0
+	})
+	for _, e := range v.elements[from:] {
+		if !bytes.Equal(e.key.(*common.MVCCKey).Content, content) || !f(e) {
+			return
+		}
+	}
+}
+
+// Delete removes the version equal to the key.
+func (v *VectorMemtable) Delete(key interface{}) *Element {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	for i, e := range v.elements {
+		if v.comparable.ModifyCompare(key, e.key) == 0 {
+			v.elements = append(v.elements[:i], v.elements[i+1:]...)
+			return e
+		}
+	}
+	return nil
+}
+
+// Range sorts the records first if the memtable is not frozen yet.
+func (v *VectorMemtable) Range(start, end interface{}, count, offset int) []*Element {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.sort()
+	return rangeOfSorted(v.comparable, v.elements, start, end, count+offset)
+}
+
+func (v *VectorMemtable) Exists(key interface{}) bool {
+	return v.Get(key) != nil
+}
+
+func (v *VectorMemtable) Size() int {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return len(v.elements)
+}
+
+func (v *VectorMemtable) BytesSize() int {
+	return v.byteSize
+}
+
+func (v *VectorMemtable) IncreaseBytesSize(delta int) {
+	v.byteSize += delta
+}
+
+// Iterator iterates a sorted copy of the records.
+func (v *VectorMemtable) Iterator() MemtableIterator {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.sort()
+	elements := make([]*Element, len(v.elements))
+	copy(elements, v.elements)
+	return &sliceMemtableIterator{comparable: v.comparable, elements: elements}
+}
+
+func (v *VectorMemtable) First() *Element {
+	return v.Iterator().First()
+}
+
+func (v *VectorMemtable) Last() *Element {
+	return v.Iterator().Back()
+}
+
+func (v *VectorMemtable) Ref(trx *Transaction) {
+	if _, existed := v.RefTrx.LoadOrStore(trx, nil); !existed {
+		atomic.AddInt32(&v.countRefs, 1)
+	}
+}
+
+func (v *VectorMemtable) CancelRef(trx *Transaction) {
+	if _, existed := v.RefTrx.LoadAndDelete(trx); existed {
+		atomic.AddInt32(&v.countRefs, -1)
+	}
+}
+
+func (v *VectorMemtable) CountRefs() int {
+	return int(atomic.LoadInt32(&v.countRefs))
+}
+
+func (v *VectorMemtable) InlinePreview() {
+	for i := v.Iterator(); i.HasNext(); {
+		n := i.Next()
+		k := n.Key().(*common.MVCCKey)
+		fmt.Printf("[%v](%v, %v): [%v]     ", string(k.Content), k.Seq, k.KT, string(n.Value()))
+	}
+	fmt.Println()
+}
@@ -60,8 +60,8 @@ func NewVersion(levels [][]*Table, memtable Memtable, frozenMemtable []Memtable,
 	}
 }
 
-// LoadVersion method load the version metadata and load header of the tables
-func LoadVersion(path string, defaultLevels int) *Version {
+// LoadVersion method load the version metadata and load header of the tables, the tables share the block cache.
+func LoadVersion(path string, defaultLevels int, cache *BlockCache) *Version {
 	versionBytes, err := ioutil.ReadFile(filepath.Join(path, "version.json"))
 	if err != nil {
 		common.Regular("[storage] Default version not found, use back up instead.")
@@ -76,11 +76,15 @@ func LoadVersion(path string, defaultLevels int) *Version {
 	tablesToDelete := make([]*Table, 0)
 	for i, level := range versionJson.Levels {
 		for _, tablePath := range level {
-			levels[i] = append(levels[i], LoadTable(tablePath))
+			table := LoadTable(tablePath)
+			table.cache = cache
+			levels[i] = append(levels[i], table)
 		}
 	}
 	for _, tableName := range versionJson.TablesToDelete {
-		tablesToDelete = append(tablesToDelete, LoadTable(tableName))
+		table := LoadTable(tableName)
+		table.cache = cache
+		tablesToDelete = append(tablesToDelete, table)
 	}
 	return NewVersion(
 		levels,
@@ -69,6 +69,12 @@ func (wal *WALWriter) Op2Log(o *common.Operation) ([]byte, uint64) {
 
 // Flush function flush the log record from buffer to the disk and reset the buffer array.
 func (wal *WALWriter) Flush()  {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	wal.flush()
+}
+
+func (wal *WALWriter) flush() {
 	if wal.i != 0 {
 		i, err := wal.w.Write(wal.buffer[:wal.i])
 		if err != nil {
@@ -79,9 +85,10 @@ func (wal *WALWriter) Flush()  {
 	}
 }
 
-// MakeRoom makes room for large kv record, it will call the Flush method at first
+// MakeRoom makes room for large kv record, it will flush the buffer at first.
+// It is supposed to be called with the lock held.
 func (wal *WALWriter) MakeRoom(size uint64) {
-	wal.Flush()
+	wal.flush()
 	wal.buffer = make([]byte, size)
 	wal.bufferSize = size
 }
@@ -91,10 +98,11 @@ func (wal *WALWriter) Append(o *common.Operation) uint64 {
 	wal.lock.Lock()
 	defer wal.lock.Unlock()
 	// write WAL log if modified
-	if o.KeyType() == common.OpPut || o.KeyType() == common.OpDelete {
+	if o.KeyType() == common.OpPut || o.KeyType() == common.OpDelete || o.KeyType() == common.OpBatch ||
+		o.KeyType() == common.OpPrepare || o.KeyType() == common.OpCommitPrepared || o.KeyType() == common.OpRollbackPrepared {
 		log, length := wal.Op2Log(o)
 		if length+wal.i > wal.bufferSize {
-			wal.Flush()
+			wal.flush()
 			if length > wal.bufferSize {
 				wal.MakeRoom(length)
 			}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/LaJunkai/drifterdb/common"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -39,4 +40,15 @@ func TestNewWALReader(t *testing.T) {
 	a := make([]int, 10)
 	b := a[10:]
 	fmt.Println(b)
-}
\ No newline at end of file
+}
+
+func TestNew_WALWritable(t *testing.T) {
+	dir := t.TempDir()
+	db := New(dir, nil)
+	db.Put([]byte("key-1"), []byte("value-1"))
+	db.Close()
+	info, err := os.Stat(filepath.Join(dir, "wal00000000.log"))
+	if err != nil || info.Size() == 0 {
+		t.Errorf("the put is supposed to be written into the WAL, got %v", err)
+	}
+}
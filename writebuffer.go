@@ -0,0 +1,150 @@
+package drifterdb
+
+import (
+	"context"
+	"sync"
+)
+
+// WriteBufferManager caps the memory of the memtables of the dbs sharing it, the active, frozen and immutable
+// memtables are all counted until they are dumped. The largest active memtable is frozen to be flushed once
+// the usage exceeds 7/8 of the buffer size, and the writers are stalled while the usage reaches the buffer size.
+type WriteBufferManager struct {
+	bufferSize int64
+
+	lock sync.Mutex
+	// usage is the bytes of the memtables of each db, and active is the part of its active memtable.
+	usage  map[*DrifterDB]int64
+	active map[*DrifterDB]int64
+	total  int64
+	// changed is closed and replaced once the memory is released, the stalled writers wait on it.
+	changed chan struct{}
+}
+
+func NewWriteBufferManager(bufferSize int) *WriteBufferManager {
+	return &WriteBufferManager{
+		bufferSize: int64(bufferSize),
+		usage:      make(map[*DrifterDB]int64),
+		active:     make(map[*DrifterDB]int64),
+		changed:    make(chan struct{}),
+	}
+}
+
+func (m *WriteBufferManager) BufferSize() int {
+	return int(m.bufferSize)
+}
+
+// MemoryUsage returns the bytes of the memtables of all the dbs.
+func (m *WriteBufferManager) MemoryUsage() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return int(m.total)
+}
+
+func (m *WriteBufferManager) register(db *DrifterDB) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.usage[db] = 0
+	m.active[db] = 0
+}
+
+// unregister releases the memory of the closed db.
+func (m *WriteBufferManager) unregister(db *DrifterDB) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.total -= m.usage[db]
+	delete(m.usage, db)
+	delete(m.active, db)
+	m.notify()
+}
+
+// reserveActive adds the bytes of the active memtable of the db grown to the size, the memtables written concurrently
+// are accounted by the size instead of the bytes of each write, so no write is counted twice.
+func (m *WriteBufferManager) reserveActive(db *DrifterDB, size int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	n := int64(size) - m.active[db]
+	if n <= 0 {
+		return
+	}
+	m.usage[db] += n
+	m.active[db] += n
+	m.total += n
+}
+
+// frozen is called once the active memtable of the db is frozen.
+func (m *WriteBufferManager) frozen(db *DrifterDB) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.active[db] = 0
+}
+
+// free releases the bytes of the memtable dumped by the db.
+func (m *WriteBufferManager) free(db *DrifterDB, n int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.usage[db]; !ok {
+		return
+	}
+	m.usage[db] -= int64(n)
+	m.total -= int64(n)
+	m.notify()
+}
+
+func (m *WriteBufferManager) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// flushIfNeeded freezes the largest active memtable if the usage exceeds 7/8 of the buffer size.
+func (m *WriteBufferManager) flushIfNeeded() {
+	m.lock.Lock()
+	if m.total <= m.bufferSize/8*7 {
+		m.lock.Unlock()
+		return
+	}
+	var largest *DrifterDB = nil
+	for db, n := range m.active {
+		if n > 0 && (largest == nil || n > m.active[largest]) {
+			largest = db
+		}
+	}
+	m.lock.Unlock()
+	if largest != nil {
+		// the same locks as the writes so that the freezing loop is excluded
+		largest.switchMemtableLock.RLock()
+		largest.memtableLock.Lock()
+		largest.FrozeMemtable()
+		largest.memtableLock.Unlock()
+		largest.switchMemtableLock.RUnlock()
+	}
+}
+
+// stall blocks the writer while the usage reaches the buffer size, the error of the ctx is returned
+// if it is done before the memory is released.
+func (m *WriteBufferManager) stall(ctx context.Context) error {
+	for {
+		m.lock.Lock()
+		if m.total < m.bufferSize {
+			m.lock.Unlock()
+			return nil
+		}
+		changed := m.changed
+		m.lock.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitForWriteBuffer is supposed to be called before the write takes the locks of the memtables,
+// it flushes the largest memtable and stalls the write if the write buffer manager is over its budget.
+func (db *DrifterDB) waitForWriteBuffer(ctx context.Context) error {
+	m := db.option.WriteBufferManager
+	if m == nil {
+		return nil
+	}
+	m.flushIfNeeded()
+	return m.stall(ctx)
+}
@@ -0,0 +1,83 @@
+package drifterdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWriteBufferManager_Stall(t *testing.T) {
+	m := NewWriteBufferManager(100)
+	m.register(nil)
+	m.reserveActive(nil, 120)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.stall(ctx); err == nil {
+		t.Fatalf("the writer is supposed to be stalled while the usage exceeds the buffer size")
+	}
+	done := make(chan error)
+	go func() {
+		done <- m.stall(context.Background())
+	}()
+	m.free(nil, 60)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("the stalled writer is supposed to continue, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the stalled writer is supposed to continue once the memory is released")
+	}
+	if m.MemoryUsage() != 60 {
+		t.Errorf("the usage is supposed to be 60, got %d", m.MemoryUsage())
+	}
+}
+
+func TestWriteBufferManager_SharedByDBs(t *testing.T) {
+	m := NewWriteBufferManager(16 * KB)
+	dbs := make([]*DrifterDB, 2)
+	for i := range dbs {
+		option := DefaultOption()
+		option.WriteBufferManager = m
+		dbs[i] = New(t.TempDir(), option)
+	}
+	value := make([]byte, 100)
+	for i := 0; i < 400; i++ {
+		if !dbs[i%2].Put([]byte(fmt.Sprintf("key%05d", i)), value) {
+			t.Fatalf("the put is supposed to succeed")
+		}
+	}
+	if m.MemoryUsage() >= m.BufferSize() {
+		t.Errorf("the usage is supposed to be kept under the buffer size, got %d", m.MemoryUsage())
+	}
+	for i, db := range dbs {
+		if len(db.storage.currentVersion.levels[0]) == 0 {
+			t.Errorf("the memtables of the db %d are supposed to be flushed", i)
+		}
+	}
+	for _, db := range dbs {
+		db.Close()
+	}
+	if m.MemoryUsage() != 0 {
+		t.Errorf("the memory of the closed dbs is supposed to be released, got %d", m.MemoryUsage())
+	}
+}
+
+func TestWriteBufferManager_Optimistic(t *testing.T) {
+	m := NewWriteBufferManager(16 * MB)
+	option := DefaultOption()
+	option.WriteBufferManager = m
+	db := New(t.TempDir(), option)
+	defer db.Close()
+	for i := 0; i < 10; i++ {
+		trx := db.StartOptimisticTransaction()
+		trx.Put([]byte(fmt.Sprintf("key%05d", i)), make([]byte, 100))
+		if err := db.CommitTransaction(trx); err != nil {
+			t.Fatalf("the commit is supposed to succeed, got %v", err)
+		}
+	}
+	if usage, size := m.MemoryUsage(), db.memtable.BytesSize(); usage != size {
+		t.Errorf("the usage is supposed to be the bytes size of the memtable %d, got %d", size, usage)
+	}
+}
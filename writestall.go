@@ -0,0 +1,229 @@
+package drifterdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+Write Stall
+The writes are delayed once the background work falls behind, and stopped until it catches up if it falls further behind:
+* level-0 tables: delayed at Level0SlowdownWritesTrigger and stopped at Level0StopWritesTrigger.
+* unflushed memtables (frozen and immutable): delayed at UnflushedMemtablesSlowdownTrigger and stopped at
+  MaxUnflushedMemtables.
+* compaction debt: delayed at SoftPendingCompactionBytesLimit and stopped at HardPendingCompactionBytesLimit.
+The delayed writes are limited to DelayedWriteRate bytes per second. The condition is updated by the background
+goroutines once the memtables are frozen, collected or dumped.
+The level-0 tables and the compaction debt are never drained before the compaction is implemented, so their triggers
+are disabled by default, otherwise the writes would be stopped for ever once enough memtables are flushed.
+*/
+
+const (
+	DefaultLevel0SlowdownWritesTrigger       = 0
+	DefaultLevel0StopWritesTrigger           = 0
+	DefaultMaxUnflushedMemtables             = 4
+	DefaultUnflushedMemtablesSlowdownTrigger = 3
+	DefaultSoftPendingCompactionBytesLimit   = 0
+	DefaultHardPendingCompactionBytesLimit   = 0
+	DefaultDelayedWriteRate                  = 16 * MB
+)
+
+type WriteStallCondition int
+
+const (
+	WriteStallNormal WriteStallCondition = iota
+	WriteStallDelayed
+	WriteStallStopped
+)
+
+func (c WriteStallCondition) String() string {
+	switch c {
+	case WriteStallDelayed:
+		return "delayed"
+	case WriteStallStopped:
+		return "stopped"
+	default:
+		return "normal"
+	}
+}
+
+const (
+	WriteStallCauseNone              = ""
+	WriteStallCauseLevel0Tables      = "level0-tables"
+	WriteStallCauseUnflushedMemtable = "unflushed-memtables"
+	WriteStallCauseCompactionDebt    = "pending-compaction-bytes"
+)
+
+// WriteStallInfo is passed to the OnWriteStall callback once the condition changes.
+type WriteStallInfo struct {
+	Condition     WriteStallCondition
+	PrevCondition WriteStallCondition
+	Cause         string
+}
+
+// WriteStallStats is the accumulated durations the writers are delayed or stopped.
+type WriteStallStats struct {
+	Condition       WriteStallCondition
+	DelayedDuration time.Duration
+	StoppedDuration time.Duration
+	DelayedWrites   uint64
+	StoppedWrites   uint64
+}
+
+// writeController guards the writeSlowDown and writePaused of the db.
+type writeController struct {
+	lock      sync.Mutex
+	condition WriteStallCondition
+	// changed is closed and replaced once the condition changes, the stopped writers wait on it.
+	changed chan struct{}
+	// nextWrite is the time the next delayed write is allowed.
+	nextWrite time.Time
+	stats     WriteStallStats
+}
+
+func newWriteController() *writeController {
+	return &writeController{changed: make(chan struct{})}
+}
+
+// writeStallCondition returns the condition of the counts, a trigger is disabled if it is not positive.
+func (o *Option) writeStallCondition(level0, unflushed int, debt int64) (WriteStallCondition, string) {
+	if o.Level0StopWritesTrigger > 0 && level0 >= o.Level0StopWritesTrigger {
+		return WriteStallStopped, WriteStallCauseLevel0Tables
+	}
+	if o.MaxUnflushedMemtables > 0 && unflushed >= o.MaxUnflushedMemtables {
+		return WriteStallStopped, WriteStallCauseUnflushedMemtable
+	}
+	if o.HardPendingCompactionBytesLimit > 0 && debt >= o.HardPendingCompactionBytesLimit {
+		return WriteStallStopped, WriteStallCauseCompactionDebt
+	}
+	if o.Level0SlowdownWritesTrigger > 0 && level0 >= o.Level0SlowdownWritesTrigger {
+		return WriteStallDelayed, WriteStallCauseLevel0Tables
+	}
+	if o.UnflushedMemtablesSlowdownTrigger > 0 && unflushed >= o.UnflushedMemtablesSlowdownTrigger {
+		return WriteStallDelayed, WriteStallCauseUnflushedMemtable
+	}
+	if o.SoftPendingCompactionBytesLimit > 0 && debt >= o.SoftPendingCompactionBytesLimit {
+		return WriteStallDelayed, WriteStallCauseCompactionDebt
+	}
+	return WriteStallNormal, WriteStallCauseNone
+}
+
+// estimatedCompactionDebt sums the bytes of each level over its target size, all the level-0 tables are supposed
+// to be compacted and the target size of the level n is the MemtableSize * AmplificationRatio^n.
+func estimatedCompactionDebt(version *Version, option *Option) int64 {
+	var debt int64 = 0
+	target := int64(option.MemtableSize)
+	for level, tables := range version.levels {
+		var size int64 = 0
+		for _, table := range tables {
+			size += int64(table.Properties().DataSize)
+		}
+		if level == 0 {
+			debt += size
+		} else if size > target {
+			debt += size - target
+		}
+		target *= int64(option.AmplificationRatio)
+	}
+	return debt
+}
+
+// updateWriteStall recomputes the condition of the writes, the switchMemtableLock is not supposed to be held.
+func (db *DrifterDB) updateWriteStall() {
+	db.switchMemtableLock.RLock()
+	level0 := len(db.storage.currentVersion.levels[0])
+	unflushed := len(db.frozenMemtables) + len(db.immutableMemtables)
+	debt := estimatedCompactionDebt(db.storage.currentVersion, db.option)
+	db.switchMemtableLock.RUnlock()
+	condition, cause := db.option.writeStallCondition(level0, unflushed, debt)
+
+	c := db.writeController
+	c.lock.Lock()
+	prev := c.condition
+	if prev == condition {
+		c.lock.Unlock()
+		return
+	}
+	c.condition = condition
+	c.stats.Condition = condition
+	db.writeSlowDown = condition == WriteStallDelayed
+	db.writePaused = condition == WriteStallStopped
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.lock.Unlock()
+	if db.option.OnWriteStall != nil {
+		db.option.OnWriteStall(WriteStallInfo{Condition: condition, PrevCondition: prev, Cause: cause})
+	}
+}
+
+// delayWrite is supposed to be called before the write takes the locks of the memtables, it waits until the writes
+// are not stopped and then delays the write of the size if the writes are delayed. The error of the ctx is returned
+// if it is done before the write is allowed.
+func (db *DrifterDB) delayWrite(ctx context.Context, size int) error {
+	c := db.writeController
+	start := time.Now()
+	stopped := false
+	for {
+		c.lock.Lock()
+		if !db.writePaused {
+			break
+		}
+		if !stopped {
+			stopped = true
+			c.stats.StoppedWrites += 1
+		}
+		changed := c.changed
+		c.lock.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			c.lock.Lock()
+			c.stats.StoppedDuration += time.Since(start)
+			c.lock.Unlock()
+			return ctx.Err()
+		}
+	}
+	if stopped {
+		c.stats.StoppedDuration += time.Since(start)
+	}
+	if !db.writeSlowDown || db.option.DelayedWriteRate <= 0 {
+		c.lock.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if c.nextWrite.Before(now) {
+		c.nextWrite = now
+	}
+	delay := c.nextWrite.Sub(now)
+	c.nextWrite = c.nextWrite.Add(time.Duration(int64(size) * int64(time.Second) / int64(db.option.DelayedWriteRate)))
+	c.stats.DelayedWrites += 1
+	c.stats.DelayedDuration += delay
+	c.lock.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForOptimisticWrite stalls the commit of the optimistic transaction whose buffered writes are applied at once.
+func (db *DrifterDB) waitForOptimisticWrite(trx *Transaction) error {
+	if err := db.waitForWriteBuffer(trx.ctx); err != nil {
+		return err
+	}
+	return db.delayWrite(trx.ctx, trx.batch.Size())
+}
+
+// WriteStallStats returns the condition of the writes and the durations the writers are delayed or stopped.
+func (db *DrifterDB) WriteStallStats() WriteStallStats {
+	db.writeController.lock.Lock()
+	defer db.writeController.lock.Unlock()
+	return db.writeController.stats
+}
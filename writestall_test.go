@@ -0,0 +1,119 @@
+package drifterdb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOption_WriteStallCondition(t *testing.T) {
+	option := DefaultOption()
+	// the level-0 tables and the compaction debt are not drained by default
+	if condition, _ := option.writeStallCondition(1000, 0, 1024*GB); condition != WriteStallNormal {
+		t.Errorf("the level-0 and the compaction debt triggers are supposed to be disabled by default, got %v", condition)
+	}
+	option.Level0SlowdownWritesTrigger = 20
+	option.Level0StopWritesTrigger = 36
+	option.SoftPendingCompactionBytesLimit = 64 * GB
+	option.HardPendingCompactionBytesLimit = 256 * GB
+	cases := []struct {
+		level0, unflushed int
+		debt              int64
+		condition         WriteStallCondition
+		cause             string
+	}{
+		{0, 0, 0, WriteStallNormal, WriteStallCauseNone},
+		{20, 0, 0, WriteStallDelayed, WriteStallCauseLevel0Tables},
+		{36, 0, 0, WriteStallStopped, WriteStallCauseLevel0Tables},
+		{0, DefaultUnflushedMemtablesSlowdownTrigger, 0, WriteStallDelayed, WriteStallCauseUnflushedMemtable},
+		{0, DefaultMaxUnflushedMemtables, 0, WriteStallStopped, WriteStallCauseUnflushedMemtable},
+		{0, 0, 64 * GB, WriteStallDelayed, WriteStallCauseCompactionDebt},
+		{20, 0, 256 * GB, WriteStallStopped, WriteStallCauseCompactionDebt},
+	}
+	for _, c := range cases {
+		condition, cause := option.writeStallCondition(c.level0, c.unflushed, c.debt)
+		if condition != c.condition || cause != c.cause {
+			t.Errorf("%v is supposed to be %v by %v, got %v by %v", c, c.condition, c.cause, condition, cause)
+		}
+	}
+}
+
+func TestOption_UnflushedMemtablesSlowdownTrigger(t *testing.T) {
+	option := DefaultOption()
+	option.MaxUnflushedMemtables = 8
+	option.UnflushedMemtablesSlowdownTrigger = 5
+	if condition, _ := option.writeStallCondition(0, 4, 0); condition != WriteStallNormal {
+		t.Errorf("the writes are supposed to be normal below the slowdown trigger, got %v", condition)
+	}
+	if condition, cause := option.writeStallCondition(0, 5, 0); condition != WriteStallDelayed || cause != WriteStallCauseUnflushedMemtable {
+		t.Errorf("the writes are supposed to be delayed at the slowdown trigger, got %v by %v", condition, cause)
+	}
+	option.UnflushedMemtablesSlowdownTrigger = 0
+	if condition, _ := option.writeStallCondition(0, 7, 0); condition != WriteStallNormal {
+		t.Errorf("the slowdown trigger is supposed to be disabled if it is not positive, got %v", condition)
+	}
+}
+
+func TestDrifterDB_WriteStall(t *testing.T) {
+	var lock sync.Mutex
+	events := make([]WriteStallInfo, 0)
+	option := DefaultOption()
+	option.Level0SlowdownWritesTrigger = 1
+	option.Level0StopWritesTrigger = 2
+	option.DelayedWriteRate = 10 * KB
+	option.OnWriteStall = func(info WriteStallInfo) {
+		lock.Lock()
+		events = append(events, info)
+		lock.Unlock()
+	}
+	db := New(t.TempDir(), option)
+	defer db.Close()
+	// flush dumps a level-0 table and waits for the condition
+	flush := func(condition WriteStallCondition) {
+		db.Put([]byte(fmt.Sprintf("key-%v", condition)), []byte("value"))
+		db.switchMemtableLock.RLock()
+		db.memtableLock.Lock()
+		db.FrozeMemtable()
+		db.memtableLock.Unlock()
+		db.switchMemtableLock.RUnlock()
+		for deadline := time.Now().Add(5 * time.Second); db.WriteStallStats().Condition != condition; {
+			if time.Now().After(deadline) {
+				t.Fatalf("the writes are supposed to be %v once the memtable is flushed", condition)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	flush(WriteStallDelayed)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		db.Put([]byte(fmt.Sprintf("delayed%05d", i)), make([]byte, KB))
+	}
+	if time.Since(start) < 500*time.Millisecond {
+		t.Errorf("the writes are supposed to be delayed to %v bytes per second, cost %v", option.DelayedWriteRate, time.Since(start))
+	}
+	flush(WriteStallStopped)
+	db.WithTransaction(func(trx *Transaction) {
+		if err := trx.Put([]byte("stopped"), []byte("value")); err != ErrWriteStall {
+			t.Errorf("the stopped write is supposed to fail with ErrWriteStall, got %v", err)
+		}
+	}, &TransactionOptions{Timeout: 100 * time.Millisecond})
+	opts := NewTransactionOptions(0)
+	opts.Optimistic = true
+	opts.Timeout = 100 * time.Millisecond
+	trx := db.StartTransactionWithOptions(opts)
+	trx.Put([]byte("stopped"), []byte("value"))
+	if err := db.CommitTransaction(trx); err != ErrWriteStall {
+		t.Errorf("the stopped optimistic commit is supposed to fail with ErrWriteStall, got %v", err)
+	}
+	stats := db.WriteStallStats()
+	if stats.DelayedWrites == 0 || stats.StoppedWrites == 0 || stats.StoppedDuration < 100*time.Millisecond {
+		t.Errorf("the stalls are supposed to be recorded, got %+v", stats)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(events) != 2 || events[0].Condition != WriteStallDelayed || events[1].Condition != WriteStallStopped ||
+		events[1].PrevCondition != WriteStallDelayed || events[1].Cause != WriteStallCauseLevel0Tables {
+		t.Errorf("the changes of the condition are supposed to be reported, got %+v", events)
+	}
+}